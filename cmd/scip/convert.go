@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/pprof"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/klauspost/compress/zstd"
@@ -25,8 +31,45 @@ const (
 	chunkSizeHint = 200 // Number of occurrences per chunk
 )
 
+// Strategies for splitting the occurrences of a document into chunks.
+const (
+	// chunkByLines splits the occurrences into chunks of about chunkSize
+	// occurrences, without splitting the occurrences of a line.
+	chunkByLines = "lines"
+	// chunkByDefinitions also starts a new chunk at the start of the
+	// enclosing range of each multi-line definition and after its end, so
+	// that a chunk usually covers a single function.
+	chunkByDefinitions = "definitions"
+)
+
+func checkChunkStrategy(strategy string) error {
+	switch strategy {
+	case chunkByLines, chunkByDefinitions:
+		return nil
+	}
+	return errors.Newf("unknown chunking strategy %q, expected %q or %q", strategy, chunkByLines, chunkByDefinitions)
+}
+
+type convertFlags struct {
+	output          string
+	cpuProfile      string
+	chunkSize       int
+	chunkStrategy   string
+	reverse         bool
+	externalSymbols bool
+	appendIndex     bool
+	repo            string
+	commit          string
+	indexID         int64
+	migrate         bool
+	indexText       bool
+	localSymbols    bool
+	jobs            int
+}
+
 func convertCommand() cli.Command {
-	var indexPath, outputPath, cpuProfilePath string
+	var indexPath string
+	flags := convertFlags{chunkSize: chunkSizeHint, chunkStrategy: chunkByLines}
 
 	command := cli.Command{
 		Name:  "expt-convert",
@@ -36,30 +79,155 @@ func convertCommand() cli.Command {
 For inspecting the data, use the SQLite CLI.
 For inspecting the schema, use .schema.
 
-Occurrences are stored opaquely as a blob to prevent the DB size from growing very quickly.`,
+Occurrences are stored opaquely as a blob to prevent the DB size from growing very quickly.
+Each blob holds a chunk of the occurrences of a document, which is decompressed
+as a whole by queries. With --chunk-by=lines, chunks hold about --chunk-size
+occurrences. With --chunk-by=definitions, chunks are also split at the
+boundaries of multi-line definitions, so that a chunk usually covers a single
+function; this makes more, smaller chunks.
+
+A database can hold several indexes, e.g. for different repositories or
+commits. Use --append to add an index to an existing database. An index
+for the same --repo and --commit as an existing one replaces it. The repo
+defaults to the project root from the index metadata.
+
+With --reverse, the argument is a database created by this command, which is
+converted back to a SCIP index written to --output (default: index.scip).
+If the database holds several indexes, select one with --index.
+The documents are canonicalized, and information not stored in the database
+(such as external symbols unless --external-symbols was used) is missing.
+
+Diagnostics of occurrences are stored in the diagnostics table. Mentions of
+local symbols are only stored with --local-symbols, in the local_mentions table.
+
+Symbols are indexed for full-text search with 'scip query search'. To also
+search the text of documents, use --index-text.
+
+Databases record the version of their schema. Databases created by older
+versions of this command can't be queried or converted back to SCIP until
+they're upgraded with --migrate, which takes the database as the argument.
+Adding an index with --append upgrades the database automatically.
+
+Documents are canonicalized, chunked and compressed by --jobs goroutines in
+parallel, and written to the database by a single one. The throughput is
+reported at the end; use --cpu-profile to see where the time goes.`,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "output",
-				Usage:       "Path to output SQLite database file",
-				Destination: &outputPath,
+				Aliases:     []string{"o"},
+				Usage:       "Path to output SQLite database file (or SCIP index with --reverse)",
+				Destination: &flags.output,
 				Value:       "index.db",
 			},
 			&cli.StringFlag{
 				Name:        "cpu-profile",
 				Usage:       "Path to output prof file",
-				Destination: &cpuProfilePath,
+				Destination: &flags.cpuProfile,
 				Value:       "",
 			},
+			&cli.IntFlag{
+				Name:        "chunk-size",
+				Usage:       "Maximum number of occurrences per chunk, unless a single line has more",
+				Destination: &flags.chunkSize,
+				Value:       chunkSizeHint,
+			},
+			&cli.StringFlag{
+				Name:        "chunk-by",
+				Usage:       "Strategy for splitting the occurrences of documents into chunks: " + chunkByLines + " or " + chunkByDefinitions,
+				Destination: &flags.chunkStrategy,
+				Value:       chunkByLines,
+			},
+			&cli.BoolFlag{
+				Name:        "reverse",
+				Usage:       "Convert a SQLite database back to a SCIP index",
+				Destination: &flags.reverse,
+			},
+			&cli.BoolFlag{
+				Name:        "external-symbols",
+				Usage:       "Also store the SymbolInformation for external symbols",
+				Destination: &flags.externalSymbols,
+			},
+			&cli.BoolFlag{
+				Name:        "append",
+				Usage:       "Add the index to an existing database instead of overwriting it",
+				Destination: &flags.appendIndex,
+			},
+			&cli.StringFlag{
+				Name:        "repo",
+				Usage:       "Repository name to record for the index (default: the project root)",
+				Destination: &flags.repo,
+			},
+			&cli.StringFlag{
+				Name:        "commit",
+				Usage:       "Commit to record for the index",
+				Destination: &flags.commit,
+			},
+			&cli.Int64Flag{
+				Name:        "index",
+				Usage:       "ID of the index to convert with --reverse",
+				Destination: &flags.indexID,
+			},
+			&cli.BoolFlag{
+				Name:        "index-text",
+				Usage:       "Also index the text of documents for full-text search",
+				Destination: &flags.indexText,
+			},
+			&cli.BoolFlag{
+				Name:        "local-symbols",
+				Usage:       "Also store the mentions of local symbols in each document",
+				Destination: &flags.localSymbols,
+			},
+			&cli.IntFlag{
+				Name:        "jobs",
+				Aliases:     []string{"j"},
+				Usage:       "Number of goroutines preparing documents for insertion",
+				Destination: &flags.jobs,
+				DefaultText: "the number of CPUs",
+			},
+			&cli.BoolFlag{
+				Name:        "migrate",
+				Usage:       "Upgrade a SQLite database created by an older version of this command",
+				Destination: &flags.migrate,
+			},
 		},
 		Action: func(c *cli.Context) error {
 			indexPath = c.Args().Get(0)
+			if flags.migrate {
+				if indexPath == "" {
+					return errors.New("missing argument for path to SQLite database")
+				}
+				err := migrateMain(indexPath)
+				if err == nil {
+					fmt.Fprintf(c.App.Writer, "Successfully upgraded SQLite database at %s to schema version %d\n", indexPath, schemaVersion)
+				}
+				return err
+			}
+			if flags.reverse {
+				if indexPath == "" {
+					return errors.New("missing argument for path to SQLite database")
+				}
+				if !c.IsSet("output") {
+					flags.output = "index.scip"
+				}
+				err := reverseConvertMain(indexPath, flags.output, flags.indexID)
+				if err == nil {
+					fmt.Fprintf(c.App.Writer, "Successfully converted SQLite database to SCIP index at %s\n", flags.output)
+				}
+				return err
+			}
 			if indexPath == "" {
 				return errors.New("missing argument for path to SCIP index")
 			}
+			if flags.chunkSize < 1 {
+				return errors.Newf("--chunk-size must be at least 1, got %d", flags.chunkSize)
+			}
+			if err := checkChunkStrategy(flags.chunkStrategy); err != nil {
+				return err
+			}
 
-			err := convertMain(indexPath, outputPath, cpuProfilePath, chunkSizeHint, c.App.Writer)
+			err := convertMain(indexPath, flags, c.App.Writer)
 			if err == nil {
-				fmt.Fprintf(c.App.Writer, "Successfully converted SCIP index to SQLite database at %s\n", outputPath)
+				fmt.Fprintf(c.App.Writer, "Successfully converted SCIP index to SQLite database at %s\n", flags.output)
 			}
 			return err
 		},
@@ -67,11 +235,15 @@ Occurrences are stored opaquely as a blob to prevent the DB size from growing ve
 	return command
 }
 
-func convertMain(indexPath, sqliteDBPath, cpuProfilePath string, chunkSize int, out io.Writer) (err error) {
-	index, err := readFromOption(indexPath)
+func convertMain(indexPath string, flags convertFlags, out io.Writer) (err error) {
+	sqliteDBPath := flags.output
+	// The index is parsed incrementally, so that large indexes don't need
+	// to fit in memory.
+	scipReader, err := openFromOption(indexPath)
 	if err != nil {
 		return err
 	}
+	defer scipReader.Close()
 
 	// Create the output directory if it doesn't exist
 	outputDir := filepath.Dir(sqliteDBPath)
@@ -80,21 +252,26 @@ func convertMain(indexPath, sqliteDBPath, cpuProfilePath string, chunkSize int,
 			return errors.Wrapf(err, "failed to create output directory %s", outputDir)
 		}
 	}
-	file, err := os.Create(sqliteDBPath) // truncates file if present
-	if err != nil {
-		return err
-	}
-	if err = file.Close(); err != nil {
-		panic(err)
+	if !flags.appendIndex {
+		file, err := os.Create(sqliteDBPath) // truncates file if present
+		if err != nil {
+			return errors.Wrapf(err, "failed to truncate %s", sqliteDBPath)
+		}
+		if err := file.Close(); err != nil {
+			return errors.Wrapf(err, "failed to truncate %s", sqliteDBPath)
+		}
 	}
 
-	if cpuProfilePath != "" {
-		f, err := os.Create(cpuProfilePath)
-		if err != nil {
-			log.Fatal(err)
+	if flags.cpuProfile != "" {
+		var profile *os.File
+		if profile, err = os.Create(flags.cpuProfile); err != nil {
+			return errors.Wrap(err, "failed to create CPU profile")
 		}
-		if err = pprof.StartCPUProfile(f); err != nil {
-			log.Fatal(err)
+		defer func() {
+			err = errors.CombineErrors(err, profile.Close())
+		}()
+		if err := pprof.StartCPUProfile(profile); err != nil {
+			return errors.Wrap(err, "failed to start CPU profile")
 		}
 		defer pprof.StopCPUProfile()
 	}
@@ -108,33 +285,66 @@ func convertMain(indexPath, sqliteDBPath, cpuProfilePath string, chunkSize int,
 		err = errors.CombineErrors(err, db.Close())
 	}()
 
-	writer, err := zstd.NewWriter(bytes.NewBuffer(nil))
-	if err != nil {
-		return errors.Wrap(err, "zstd writer creation")
-	}
 	// Convert the SCIP index to the SQLite database
-	converter := NewConverter(db, chunkSize, writer)
-	if err := converter.Convert(index); err != nil {
-		return err
+	converter := NewConverter(db, flags.chunkSize)
+	converter.chunkStrategy = flags.chunkStrategy
+	converter.jobs = flags.jobs
+	if converter.jobs <= 0 {
+		converter.jobs = runtime.GOMAXPROCS(0)
 	}
+	converter.importExternalSymbols = flags.externalSymbols
+	converter.repo = flags.repo
+	converter.commit = flags.commit
+	converter.indexText = flags.indexText
+	converter.indexLocalSymbols = flags.localSymbols
+	input := &countingReader{r: scipReader}
+	start := time.Now()
+	if err := converter.ConvertStreaming(context.Background(), input); err != nil {
+		return errors.Wrapf(err, "converting SCIP index at path %s", indexPath)
+	}
+	elapsed := time.Since(start)
 	if err := prepareIndexes(db); err != nil {
 		return err
 	}
 
+	seconds := max(elapsed.Seconds(), 1e-9)
+	fmt.Fprintf(out, "Converted %d documents with %d occurrences in %s (%.0f documents/s, %.1f MB/s, --jobs=%d)\n",
+		converter.documents, converter.occurrences, elapsed.Round(time.Millisecond),
+		float64(converter.documents)/seconds, float64(input.n)/(1<<20)/seconds, converter.jobs)
 	return nil
 }
 
-func prepareIndexes(conn *sqlite.Conn) error {
+// countingReader counts the bytes read from r, for reporting throughput.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func prepareIndexes(conn *sqlite.Conn) (err error) {
 	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
 	defer endFn(&err)
 
 	indexCreationStatements := []string{
-		`CREATE INDEX idx_chunks_line_range ON chunks(document_id, start_line, end_line);`,
-		`CREATE INDEX idx_mentions_symbol_id_role ON mentions(symbol_id, role);`,
-		`CREATE INDEX idx_defn_enclosing_ranges_symbol_id ON defn_enclosing_ranges(symbol_id);`,
-		`CREATE INDEX idx_defn_enclosing_ranges_document ON defn_enclosing_ranges(document_id, start_line, end_line);`,
-		`CREATE INDEX idx_chunks_doc_id ON chunks(document_id)`,
-		`CREATE INDEX idx_global_symbols_symbol ON global_symbols(symbol);`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_line_range ON chunks(document_id, start_line, end_line);`,
+		`CREATE INDEX IF NOT EXISTS idx_mentions_symbol_id_role ON mentions(symbol_id, role);`,
+		`CREATE INDEX IF NOT EXISTS idx_defn_enclosing_ranges_symbol_id ON defn_enclosing_ranges(symbol_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_defn_enclosing_ranges_document ON defn_enclosing_ranges(document_id, start_line, end_line);`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_doc_id ON chunks(document_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_global_symbols_symbol ON global_symbols(symbol);`,
+		`CREATE INDEX IF NOT EXISTS idx_document_symbols_symbol_id ON document_symbols(symbol_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_relationships_related_symbol_id ON relationships(related_symbol_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_indexes_repo ON indexes(repo, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_diagnostics_document ON diagnostics(document_id, start_line);`,
+		`CREATE INDEX IF NOT EXISTS idx_local_mentions_document_symbol ON local_mentions(document_id, symbol, role);`,
 	}
 	return executeAll(conn, indexCreationStatements)
 }
@@ -164,60 +374,8 @@ func createSQLiteDatabase(path string) (conn *sqlite.Conn, err error) {
 		return conn, err
 	}
 
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to start transaction")
-	}
-
-	txStatements := []string{
-		`CREATE TABLE documents (
-			id INTEGER PRIMARY KEY,
-			language TEXT,
-			relative_path TEXT NOT NULL UNIQUE,
-			position_encoding TEXT,
-			text TEXT
-		);`,
-		`CREATE TABLE chunks (
-			id INTEGER PRIMARY KEY,
-			document_id INTEGER NOT NULL,
-			chunk_index INTEGER NOT NULL,
-			start_line INTEGER NOT NULL,
-			end_line INTEGER NOT NULL,
-			occurrences BLOB NOT NULL,
-			FOREIGN KEY (document_id) REFERENCES documents(id)
-		);`,
-		`CREATE TABLE global_symbols (
-			id INTEGER PRIMARY KEY,
-			symbol TEXT NOT NULL UNIQUE,
-			display_name TEXT,
-			kind INTEGER,
-			documentation TEXT,
-			signature BLOB,
-			enclosing_symbol TEXT,
-			relationships BLOB
-		);`,
-		`CREATE TABLE mentions (
-			chunk_id INTEGER NOT NULL,
-			symbol_id INTEGER NOT NULL,
-			role INTEGER NOT NULL,
-			PRIMARY KEY (chunk_id, symbol_id, role),
-			FOREIGN KEY (chunk_id) REFERENCES chunks(id),
-			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
-		);`,
-		`CREATE TABLE defn_enclosing_ranges (
-			id INTEGER PRIMARY KEY,
-			document_id INTEGER NOT NULL,
-			symbol_id INTEGER NOT NULL,
-			start_line INTEGER NOT NULL,
-			start_char INTEGER NOT NULL,
-			end_line INTEGER NOT NULL,
-			end_char INTEGER NOT NULL,
-			FOREIGN KEY (document_id) REFERENCES documents(id),
-			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
-		);`,
-	}
-
-	err = executeAll(conn, txStatements)
-	return conn, nil
+	err = migrateSchema(conn)
+	return conn, err
 }
 
 func executeAll(conn *sqlite.Conn, statements []string) error {
@@ -231,127 +389,479 @@ func executeAll(conn *sqlite.Conn, statements []string) error {
 
 // Converter handles the conversion from SCIP to SQLite
 type Converter struct {
-	conn       *sqlite.Conn
-	chunkSize  int
-	zstdWriter *zstd.Encoder
+	conn      *sqlite.Conn
+	chunkSize int
+	// chunkStrategy is chunkByLines or chunkByDefinitions.
+	chunkStrategy string
+	// jobs is the number of goroutines preparing documents for insertion
+	// (see convertPipeline).
+	jobs int
+	// importExternalSymbols makes Convert store Index.ExternalSymbols
+	// in global_symbols, in addition to the symbols from documents.
+	importExternalSymbols bool
+	// repo and commit identify the index in the indexes table. If repo
+	// is empty, the project root from the metadata is used.
+	repo, commit string
+	// indexText makes Convert index the text of documents for full-text
+	// search. Symbols are always indexed.
+	indexText bool
+	// indexLocalSymbols makes Convert store the mentions of local symbols
+	// in local_mentions, in addition to the mentions of global symbols.
+	indexLocalSymbols bool
+	// indexID is the ID of the index being converted.
+	indexID int64
+	// stmts are the statements for inserting the rows of the index.
+	stmts *converterStatements
+	// documents and occurrences count the converted documents and their
+	// occurrences, for reporting throughput.
+	documents, occurrences int64
 }
 
 // NewConverter creates a new converter instance
-func NewConverter(conn *sqlite.Conn, chunkSize int, writer *zstd.Encoder) *Converter {
+func NewConverter(conn *sqlite.Conn, chunkSize int) *Converter {
 	return &Converter{
-		conn,
-		chunkSize,
-		writer,
+		conn:          conn,
+		chunkSize:     chunkSize,
+		chunkStrategy: chunkByLines,
+		jobs:          1,
 	}
 }
 
-type DocPosition struct {
-	Index int
-	ID    int64
+// converterStatements are the statements used for inserting rows. They're
+// prepared once per conversion instead of being looked up for every row.
+type converterStatements struct {
+	document, chunk, mention, localMention, enclosingRange, diagnostic *sqlite.Stmt
+	lookupSymbol, insertSymbol, updateSymbol, documentSymbol           *sqlite.Stmt
+	deleteRelationships, relationship                                  *sqlite.Stmt
+}
+
+// prepareConverterStatements prepares the statements of a Converter. They're
+// cached by the connection, which finalizes them when it's closed.
+func prepareConverterStatements(conn *sqlite.Conn) (*converterStatements, error) {
+	var s converterStatements
+	queries := []struct {
+		stmt  **sqlite.Stmt
+		query string
+	}{
+		{&s.document, `INSERT INTO documents (language, relative_path, position_encoding, text, index_id)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(index_id, relative_path) DO NOTHING
+			RETURNING id`},
+		{&s.chunk, `INSERT INTO chunks (document_id, chunk_index, start_line, end_line, occurrences, index_id)
+			VALUES (?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&s.mention, `INSERT INTO mentions (chunk_id, symbol_id, role) VALUES (?, ?, ?)`},
+		{&s.localMention, `INSERT INTO local_mentions (document_id, chunk_id, symbol, role) VALUES (?, ?, ?, ?)`},
+		{&s.enclosingRange, `INSERT INTO defn_enclosing_ranges (document_id, symbol_id, start_line, start_char, end_line, end_char)
+			VALUES (?, ?, ?, ?, ?, ?)`},
+		{&s.diagnostic, `INSERT INTO diagnostics (document_id, start_line, start_char, end_line, end_char, severity, code, message, source, tags)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`},
+		{&s.lookupSymbol, `SELECT id, info_source FROM global_symbols WHERE index_id = ? AND symbol = ?`},
+		{&s.insertSymbol, `INSERT INTO global_symbols (display_name, kind, documentation, enclosing_symbol, signature, info_source, symbol, index_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id`},
+		{&s.updateSymbol, `UPDATE global_symbols
+			SET display_name = ?, kind = ?, documentation = ?, enclosing_symbol = ?, signature = ?, info_source = ?
+			WHERE id = ?
+			RETURNING id`},
+		{&s.documentSymbol, `INSERT INTO document_symbols (document_id, symbol_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`},
+		{&s.deleteRelationships, `DELETE FROM relationships WHERE symbol_id = ?`},
+		{&s.relationship, `INSERT INTO relationships (symbol_id, related_symbol_id, is_reference, is_implementation, is_type_definition, is_definition)
+			VALUES (?, ?, ?, ?, ?, ?)`},
+	}
+	for _, q := range queries {
+		stmt, err := conn.Prepare(q.query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to prepare statement: %s", q.query)
+		}
+		*q.stmt = stmt
+	}
+	return &s, nil
 }
 
+// symbolInfoSource is where the data in a global_symbols row comes from.
+//
+// Documents and external symbols may be visited in any order, so a row is
+// overwritten when SymbolInformation from a later source is found. This
+// way, SymbolInformation from documents takes precedence over external
+// symbols, and both take precedence over placeholders.
+type symbolInfoSource int64
+
+const (
+	// symbolInfoNone is used for placeholder rows for symbols which only
+	// appear in occurrences or relationships.
+	symbolInfoNone symbolInfoSource = iota
+	symbolInfoExternal
+	symbolInfoDocument
+)
+
 // Convert processes the SCIP index and writes it to the SQLite database
-func (c *Converter) Convert(index *scip.Index) (err error) {
+func (c *Converter) Convert(index *scip.Index) error {
+	return c.convert(func(p *convertPipeline) error {
+		if index.Metadata != nil {
+			if err := p.write(func() error { return c.insertMetadata(index.Metadata) }); err != nil {
+				return err
+			}
+		}
+		for i, doc := range index.Documents {
+			if err := p.document(i, doc); err != nil {
+				return err
+			}
+		}
+		for _, symbol := range index.ExternalSymbols {
+			if err := p.write(func() error { return c.convertExternalSymbol(symbol) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ConvertStreaming is like Convert, but reads the index from r one document
+// at a time, so that memory usage doesn't depend on the size of the index.
+func (c *Converter) ConvertStreaming(ctx context.Context, r io.Reader) error {
+	return c.convert(func(p *convertPipeline) error {
+		docIndex := 0
+		visitor := scip.IndexVisitor{
+			VisitMetadata: func(_ context.Context, metadata *scip.Metadata) error {
+				return p.write(func() error { return c.insertMetadata(metadata) })
+			},
+			VisitDocument: func(_ context.Context, doc *scip.Document) error {
+				docIndex++
+				return p.document(docIndex-1, doc)
+			},
+			VisitExternalSymbol: func(_ context.Context, symbol *scip.SymbolInformation) error {
+				return p.write(func() error { return c.convertExternalSymbol(symbol) })
+			},
+		}
+		return visitor.ParseStreaming(ctx, bufio.NewReader(r))
+	})
+}
+
+// convert converts an index in a single transaction. produce passes the
+// parts of the index to the pipeline in their order in the index.
+func (c *Converter) convert(produce func(p *convertPipeline) error) (err error) {
 	endFn, err := sqlitex.ImmediateTransaction(c.conn)
 	if err != nil {
 		return errors.Wrap(err, "failed to begin transaction")
 	}
 	defer endFn(&err)
 
-	docPositions := map[string]DocPosition{}
-	symbolToID := map[string]int64{}
+	if c.stmts, err = prepareConverterStatements(c.conn); err != nil {
+		return err
+	}
+	if err = c.insertIndex(); err != nil {
+		return err
+	}
+	p, err := newConvertPipeline(c)
+	if err != nil {
+		return err
+	}
+	p.fail(produce(p))
+	if err = p.wait(); err != nil {
+		return err
+	}
+	return c.finishIndex()
+}
 
-	for i, doc := range index.Documents {
-		if pos, ok := docPositions[doc.RelativePath]; ok {
-			slog.Warn("found multiple documents with identical relative path; ignoring duplicates",
-				slog.String("path", doc.RelativePath),
-				slog.Int("firstIndex", pos.Index),
-				slog.Int("duplicateIndex", i))
-			continue
+// insertIndex inserts the row for the index into the indexes table.
+func (c *Converter) insertIndex() error {
+	stmt, err := c.conn.Prepare(
+		`INSERT INTO indexes (repo, commit_id, created_at)
+		VALUES (?, ?, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+		RETURNING id`)
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare index insert statement")
+	}
+	bindTextOrNull(stmt, 1, c.repo)
+	bindTextOrNull(stmt, 2, c.commit)
+	if _, err = stmt.Step(); err != nil {
+		return errors.Wrap(err, "failed to insert index")
+	}
+	c.indexID = stmt.ColumnInt64(0)
+	return stmt.Reset()
+}
+
+// insertMetadata records the metadata of the index.
+func (c *Converter) insertMetadata(metadata *scip.Metadata) error {
+	var textEncoding any
+	switch metadata.TextDocumentEncoding {
+	case scip.TextEncoding_UnspecifiedTextEncoding:
+	case scip.TextEncoding_UTF8:
+		textEncoding = "UTF-8"
+	case scip.TextEncoding_UTF16:
+		textEncoding = "UTF-16"
+	default:
+		return errors.Errorf("unknown text encoding %d", metadata.TextDocumentEncoding)
+	}
+	var toolName, toolVersion, toolArguments any
+	if toolInfo := metadata.ToolInfo; toolInfo != nil {
+		toolName, toolVersion = nullIfEmpty(toolInfo.Name), nullIfEmpty(toolInfo.Version)
+		arguments, err := json.Marshal(toolInfo.Arguments)
+		if err != nil {
+			return errors.Wrap(err, "failed to serialize tool arguments")
 		}
-		doc = scip.CanonicalizeDocument(doc)
-		index.Documents[i] = doc
+		toolArguments = string(arguments)
+	}
+	err := sqlitex.Execute(c.conn,
+		`UPDATE indexes
+		SET repo = coalesce(repo, $project_root), project_root = $project_root,
+			tool_name = $tool_name, tool_version = $tool_version, tool_arguments = $tool_arguments,
+			text_encoding = $text_encoding, protocol_version = $protocol_version
+		WHERE id = $id`,
+		&sqlitex.ExecOptions{Named: map[string]any{
+			"$id":               c.indexID,
+			"$project_root":     nullIfEmpty(metadata.ProjectRoot),
+			"$tool_name":        toolName,
+			"$tool_version":     toolVersion,
+			"$tool_arguments":   toolArguments,
+			"$text_encoding":    textEncoding,
+			"$protocol_version": int64(metadata.Version),
+		}})
+	return errors.Wrap(err, "failed to insert metadata")
+}
 
-		docID, err := c.insertDocument(doc)
+// finishIndex checks the converted index, indexes it for full-text
+// search, and deletes older indexes for the same repo and commit, which the
+// index replaces.
+func (c *Converter) finishIndex() error {
+	if err := c.checkDefinitions(); err != nil {
+		return err
+	}
+	if err := indexSymbolsForSearch(c.conn, c.indexID); err != nil {
+		return err
+	}
+	if c.indexText {
+		err := sqlitex.Execute(c.conn,
+			`INSERT INTO documents_fts (rowid, text)
+			SELECT id, text FROM documents WHERE index_id = ? AND text IS NOT NULL`,
+			&sqlitex.ExecOptions{Args: []any{c.indexID}})
 		if err != nil {
-			return errors.Wrapf(err, "document at index %d", i)
+			return errors.Wrap(err, "indexing documents for search")
+		}
+	}
+	var replaced []int64
+	err := sqlitex.Execute(c.conn,
+		`SELECT old.id FROM indexes old, indexes new
+		WHERE new.id = $id AND old.id != new.id
+			AND old.repo IS new.repo AND old.commit_id IS new.commit_id`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$id": c.indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				replaced = append(replaced, stmt.ColumnInt64(0))
+				return nil
+			},
+		})
+	if err != nil {
+		return errors.Wrap(err, "looking up replaced indexes")
+	}
+	for _, indexID := range replaced {
+		if err = deleteIndex(c.conn, indexID); err != nil {
+			return err
 		}
-		docPositions[doc.RelativePath] = DocPosition{i, docID}
+	}
+	return nil
+}
 
-		for _, symbol := range doc.Symbols {
-			if symbol.Symbol == "" {
-				return errors.Newf("empty symbol in SymbolInformation for document %q", doc.RelativePath)
-			}
-			if scip.IsLocalSymbol(symbol.Symbol) {
-				continue
-			}
-			if _, ok := symbolToID[symbol.Symbol]; ok {
-				continue
-			}
-			symbolID, err := c.insertGlobalSymbols(symbol)
-			if err != nil {
-				return errors.Wrapf(err, "in document %q", doc.RelativePath)
-			}
-			symbolToID[symbol.Symbol] = symbolID
+// indexSymbolsForSearch adds the global symbols of the index which have
+// SymbolInformation to symbols_fts. Placeholders for symbols which are only
+// referenced are left out.
+func indexSymbolsForSearch(conn *sqlite.Conn, indexID int64) error {
+	insertStmt, err := conn.Prepare(
+		`INSERT INTO symbols_fts (rowid, display_name, descriptors, documentation) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare symbols_fts insert statement")
+	}
+	err = sqlitex.Execute(conn,
+		`SELECT id, symbol, display_name, documentation FROM global_symbols WHERE index_id = ? AND info_source != ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID, int64(symbolInfoNone)},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				insertStmt.BindInt64(1, stmt.ColumnInt64(0))
+				insertStmt.BindText(2, stmt.ColumnText(2))
+				insertStmt.BindText(3, descriptorNames(stmt.ColumnText(1)))
+				insertStmt.BindText(4, stmt.ColumnText(3))
+				if _, err := insertStmt.Step(); err != nil {
+					return errors.Wrapf(err, "failed to index symbol %s for search", stmt.ColumnText(1))
+				}
+				return insertStmt.Reset()
+			},
+		})
+	return errors.Wrap(err, "indexing symbols for search")
+}
+
+// descriptorNames returns the names of the descriptors of the symbol,
+// separated by spaces, so that symbols can be searched for by the names of
+// their enclosing packages and types. Symbols which can't be parsed have no
+// names.
+func descriptorNames(symbol string) string {
+	parsed, err := scip.ParseSymbol(symbol)
+	if err != nil {
+		return ""
+	}
+	names := make([]string, 0, len(parsed.Descriptors))
+	for _, descriptor := range parsed.Descriptors {
+		names = append(names, descriptor.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// deleteIndex deletes the index with the given ID and all its data.
+func deleteIndex(conn *sqlite.Conn, indexID int64) error {
+	statements := []string{
+		`DELETE FROM symbols_fts WHERE rowid IN (SELECT id FROM global_symbols WHERE index_id = $id)`,
+		`DELETE FROM documents_fts WHERE rowid IN (SELECT id FROM documents WHERE index_id = $id)`,
+		`DELETE FROM mentions WHERE chunk_id IN (SELECT id FROM chunks WHERE index_id = $id)`,
+		`DELETE FROM local_mentions WHERE chunk_id IN (SELECT id FROM chunks WHERE index_id = $id)`,
+		`DELETE FROM diagnostics WHERE document_id IN (SELECT id FROM documents WHERE index_id = $id)`,
+		`DELETE FROM relationships WHERE symbol_id IN (SELECT id FROM global_symbols WHERE index_id = $id)`,
+		`DELETE FROM document_symbols WHERE document_id IN (SELECT id FROM documents WHERE index_id = $id)`,
+		`DELETE FROM defn_enclosing_ranges WHERE document_id IN (SELECT id FROM documents WHERE index_id = $id)`,
+		`DELETE FROM chunks WHERE index_id = $id`,
+		`DELETE FROM global_symbols WHERE index_id = $id`,
+		`DELETE FROM documents WHERE index_id = $id`,
+		`DELETE FROM indexes WHERE id = $id`,
+	}
+	for _, stmt := range statements {
+		if err := sqlitex.Execute(conn, stmt, &sqlitex.ExecOptions{Named: map[string]any{"$id": indexID}}); err != nil {
+			return errors.Wrapf(err, "deleting index %d", indexID)
 		}
 	}
+	return nil
+}
 
-	for _, docPosition := range docPositions {
-		doc := index.Documents[docPosition.Index]
-		docID := docPosition.ID
-		if err = c.insertEnclosingRangeData(symbolToID, doc.Occurrences, docID); err != nil {
+// writeDocument inserts a document prepared by prepareDocument, unless a
+// document with the same relative path was inserted before.
+func (c *Converter) writeDocument(prepared preparedDocument) error {
+	doc := prepared.doc
+	docID, ok, err := c.insertDocument(doc)
+	if err != nil {
+		return errors.Wrapf(err, "document at index %d", prepared.index)
+	}
+	if !ok {
+		slog.Warn("found multiple documents with identical relative path; ignoring duplicates",
+			slog.String("path", doc.RelativePath),
+			slog.Int("duplicateIndex", prepared.index))
+		return nil
+	}
+	c.documents++
+	c.occurrences += int64(len(doc.Occurrences))
+
+	// Symbol IDs are cached per document, so that memory usage is bounded
+	// by the size of a document rather than the number of symbols.
+	symbolToID := map[string]int64{}
+	for _, symbol := range doc.Symbols {
+		if symbol.Symbol == "" {
+			return errors.Newf("empty symbol in SymbolInformation for document %q", doc.RelativePath)
+		}
+		if scip.IsLocalSymbol(symbol.Symbol) {
+			continue
+		}
+		symbolID, err := c.insertGlobalSymbol(symbol, symbolInfoDocument)
+		if err != nil {
 			return errors.Wrapf(err, "in document %q", doc.RelativePath)
 		}
-
-		if err = c.insertOccurrenceData(doc, docID, symbolToID); err != nil {
-			return err
+		symbolToID[symbol.Symbol] = symbolID
+		if err = c.insertDocumentSymbol(docID, symbolID); err != nil {
+			return errors.Wrapf(err, "in document %q", doc.RelativePath)
 		}
 	}
 
-	// We intentionally don't process external symbols
-
+	if err = c.insertEnclosingRangeData(symbolToID, doc.Occurrences, docID); err != nil {
+		return errors.Wrapf(err, "in document %q", doc.RelativePath)
+	}
+	if err = insertDiagnostics(c.stmts.diagnostic, docID, doc.Occurrences); err != nil {
+		return errors.Wrapf(err, "in document %q", doc.RelativePath)
+	}
+	if err = c.insertOccurrenceData(prepared.chunks, docID, symbolToID); err != nil {
+		return errors.Wrapf(err, "in document %q", doc.RelativePath)
+	}
 	return nil
 }
 
-func (c *Converter) insertOccurrenceData(doc *scip.Document, docID int64, symbolToID map[string]int64) error {
-	chunkedOccurrences := chunkOccurrences(doc.Occurrences, c.chunkSize)
+func (c *Converter) convertExternalSymbol(symbol *scip.SymbolInformation) error {
+	if !c.importExternalSymbols {
+		return nil
+	}
+	if symbol.Symbol == "" {
+		return errors.New("empty symbol in external SymbolInformation")
+	}
+	if scip.IsLocalSymbol(symbol.Symbol) {
+		return nil
+	}
+	_, err := c.insertGlobalSymbol(scip.CanonicalizeSymbol(symbol), symbolInfoExternal)
+	return errors.Wrap(err, "in external symbols")
+}
 
-	mentionStmt, err := c.conn.Prepare("INSERT INTO mentions (chunk_id, symbol_id, role) VALUES (?, ?, ?)")
+// checkDefinitions checks that symbols with definition occurrences with
+// an enclosing range have SymbolInformation. This can only be done once
+// all documents have been inserted.
+func (c *Converter) checkDefinitions() error {
+	var missing string
+	err := sqlitex.ExecuteTransient(c.conn,
+		`SELECT g.symbol FROM defn_enclosing_ranges r
+		JOIN global_symbols g ON g.id = r.symbol_id
+		WHERE g.index_id = ? AND g.info_source = ? LIMIT 1`,
+		&sqlitex.ExecOptions{
+			Args: []any{c.indexID, int64(symbolInfoNone)},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				missing = stmt.ColumnText(0)
+				return nil
+			},
+		})
+	if err != nil {
+		return errors.Wrap(err, "checking definitions")
+	}
+	if missing != "" {
+		return errors.Newf("symbol %q has definition occurrence, but no SymbolInformation", missing)
+	}
+	return nil
+}
+
+// symbolID returns the ID of the symbol, inserting a placeholder row into
+// global_symbols if needed.
+func (c *Converter) symbolID(symbolToID map[string]int64, symbol string) (int64, error) {
+	if symbolID, ok := symbolToID[symbol]; ok {
+		return symbolID, nil
+	}
+	symbolID, err := c.insertGlobalSymbol(&scip.SymbolInformation{Symbol: symbol}, symbolInfoNone)
 	if err != nil {
-		return errors.Wrap(err, "failed to prepare mention statement")
+		return 0, err
 	}
+	symbolToID[symbol] = symbolID
+	return symbolID, nil
+}
 
-	for chunkIndex, chunk := range chunkedOccurrences {
+func (c *Converter) insertOccurrenceData(chunks []preparedChunk, docID int64, symbolToID map[string]int64) error {
+	mentionStmt, localMentionStmt := c.stmts.mention, c.stmts.localMention
+	for chunkIndex, chunk := range chunks {
 		chunkID, err := c.insertChunk(chunk, docID, chunkIndex)
 		if err != nil {
 			return errors.Wrapf(err, "failed to insert chunk %d", chunkIndex)
 		}
 
-		// Prepare data for entry into mentions table
-		symbolRoles := make(map[string]map[int32]struct{})
-		for _, occ := range chunk.Occurrences {
-			if scip.IsLocalSymbol(occ.Symbol) {
-				continue
-			}
-			if symbolRoles[occ.Symbol] == nil {
-				symbolRoles[occ.Symbol] = make(map[int32]struct{})
-			}
-			symbolRoles[occ.Symbol][occ.SymbolRoles] = struct{}{}
-			if _, ok := symbolToID[occ.Symbol]; !ok {
-				symbolToID[occ.Symbol], err = c.insertGlobalSymbols(&scip.SymbolInformation{Symbol: occ.Symbol})
-				if err != nil {
-					return errors.Wrapf(err, "inserting symbol %q for occurrence", occ.Symbol)
+		// Local symbols are only unique within the document, so they're
+		// stored by name instead of in global_symbols.
+		for symbol, roleMap := range chunk.localSymbolRoles {
+			for role := range roleMap {
+				localMentionStmt.BindInt64(1, docID)
+				localMentionStmt.BindInt64(2, chunkID)
+				localMentionStmt.BindText(3, symbol)
+				localMentionStmt.BindInt64(4, int64(role))
+				if _, err = localMentionStmt.Step(); err != nil {
+					return errors.Wrapf(err, "failed to insert mention for local symbol %q with role %d", symbol, role)
+				}
+				if err = localMentionStmt.Reset(); err != nil {
+					return errors.Wrap(err, "resetting insert into local_mentions statement")
 				}
 			}
 		}
 
 		// Add mentions for each symbol in this chunk
-		for symbol, roleMap := range symbolRoles {
-			symbolID, ok := symbolToID[symbol]
-			if !ok {
-				panic(fmt.Sprintf("invariant violation: symbol %q not found in symbolToID, "+
-					"but expected it to have been inserted when inserting rows for doc.symbols "+
-					"or doc.occurrences", symbol))
+		for symbol, roleMap := range chunk.symbolRoles {
+			symbolID, err := c.symbolID(symbolToID, symbol)
+			if err != nil {
+				return errors.Wrapf(err, "inserting symbol %q for occurrence", symbol)
 			}
 
 			for role := range roleMap {
@@ -371,11 +881,54 @@ func (c *Converter) insertOccurrenceData(doc *scip.Document, docID int64, symbol
 	return nil
 }
 
-func (c *Converter) insertEnclosingRangeData(symbolToID map[string]int64, occs []*scip.Occurrence, docID int64) error {
-	defnEnclRangesStmt, err := c.conn.Prepare("INSERT INTO defn_enclosing_ranges (document_id, symbol_id, start_line, start_char, end_line, end_char) VALUES (?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return errors.Wrap(err, "failed to prepare defn_enclosing_ranges insert statement")
+// insertDiagnostics inserts the diagnostics attached to the occurrences
+// into the diagnostics table, with the ranges of the occurrences.
+// stmt is the diagnostic statement of converterStatements.
+func insertDiagnostics(stmt *sqlite.Stmt, docID int64, occs []*scip.Occurrence) error {
+	for _, occ := range occs {
+		if len(occ.Diagnostics) == 0 {
+			continue
+		}
+		occRange, err := scip.NewRange(occ.Range)
+		if err != nil {
+			return errors.Wrapf(err, "bad range %v for diagnostics of symbol %q", occ.Range, occ.Symbol)
+		}
+		for _, diagnostic := range occ.Diagnostics {
+			stmt.BindInt64(1, docID)
+			stmt.BindInt64(2, int64(occRange.Start.Line))
+			stmt.BindInt64(3, int64(occRange.Start.Character))
+			stmt.BindInt64(4, int64(occRange.End.Line))
+			stmt.BindInt64(5, int64(occRange.End.Character))
+			if diagnostic.Severity == scip.Severity_UnspecifiedSeverity {
+				stmt.BindNull(6)
+			} else {
+				stmt.BindInt64(6, int64(diagnostic.Severity))
+			}
+			bindTextOrNull(stmt, 7, diagnostic.Code)
+			bindTextOrNull(stmt, 8, diagnostic.Message)
+			bindTextOrNull(stmt, 9, diagnostic.Source)
+			if len(diagnostic.Tags) == 0 {
+				stmt.BindNull(10)
+			} else {
+				tags, err := json.Marshal(diagnostic.Tags)
+				if err != nil {
+					return errors.Wrap(err, "failed to serialize diagnostic tags")
+				}
+				stmt.BindText(10, string(tags))
+			}
+			if _, err = stmt.Step(); err != nil {
+				return errors.Wrap(err, "failed to insert diagnostic")
+			}
+			if err = stmt.Reset(); err != nil {
+				return errors.Wrap(err, "resetting insert into diagnostics statement")
+			}
+		}
 	}
+	return nil
+}
+
+func (c *Converter) insertEnclosingRangeData(symbolToID map[string]int64, occs []*scip.Occurrence, docID int64) error {
+	defnEnclRangesStmt := c.stmts.enclosingRange
 
 	// Look for definition occurrences with enclosing ranges
 	for _, occ := range occs {
@@ -386,9 +939,11 @@ func (c *Converter) insertEnclosingRangeData(symbolToID map[string]int64, occs [
 			len(occ.EnclosingRange) < 3 {
 			continue
 		}
-		symbolID, ok := symbolToID[occ.Symbol]
-		if !ok {
-			return errors.Newf("symbol %q has definition occurrence, but no SymbolInformation", occ.Symbol)
+		// The SymbolInformation may be in a later document, so this is
+		// checked by checkDefinitions at the end.
+		symbolID, err := c.symbolID(symbolToID, occ.Symbol)
+		if err != nil {
+			return errors.Wrapf(err, "inserting symbol %q for definition", occ.Symbol)
 		}
 		enclRange, err := scip.NewRange(occ.EnclosingRange)
 		if err != nil {
@@ -414,50 +969,133 @@ func (c *Converter) insertEnclosingRangeData(symbolToID map[string]int64, occs [
 	return nil
 }
 
-func (c *Converter) insertGlobalSymbols(symbol *scip.SymbolInformation) (symbolID int64, err error) {
-	documentation := strings.Join(symbol.Documentation, "\n")
-
-	insertStmt, err := c.conn.Prepare(
-		`INSERT INTO global_symbols (symbol, display_name, kind, documentation, enclosing_symbol)
-		VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(symbol) DO NOTHING
-		RETURNING id`)
+// insertGlobalSymbol returns the ID of the symbol in global_symbols. The
+// row is inserted, or overwritten if its data comes from an earlier
+// source (see symbolInfoSource).
+func (c *Converter) insertGlobalSymbol(symbol *scip.SymbolInformation, source symbolInfoSource) (symbolID int64, err error) {
+	lookupStmt := c.stmts.lookupSymbol
+	lookupStmt.BindInt64(1, c.indexID)
+	lookupStmt.BindText(2, symbol.Symbol)
+	found, err := lookupStmt.Step()
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to prepare symbol insert statement")
+		return 0, errors.Wrapf(err, "failed to look up symbol %s", symbol.Symbol)
+	}
+	var existingSource symbolInfoSource
+	if found {
+		symbolID = lookupStmt.ColumnInt64(0)
+		existingSource = symbolInfoSource(lookupStmt.ColumnInt64(1))
+	}
+	if err = lookupStmt.Reset(); err != nil {
+		return 0, errors.Wrap(err, "resetting symbol lookup statement")
+	}
+	if found && existingSource >= source {
+		return symbolID, nil
+	}
+
+	stmt := c.stmts.insertSymbol
+	if found {
+		stmt = c.stmts.updateSymbol
 	}
 
-	insertStmt.BindText(1, symbol.Symbol)
 	if symbol.DisplayName == "" {
-		insertStmt.BindNull(2)
+		stmt.BindNull(1)
 	} else {
-		insertStmt.BindText(2, symbol.DisplayName)
+		stmt.BindText(1, symbol.DisplayName)
 	}
 	if symbol.Kind == scip.SymbolInformation_UnspecifiedKind {
-		insertStmt.BindNull(3)
+		stmt.BindNull(2)
 	} else {
-		insertStmt.BindInt64(3, int64(symbol.Kind))
+		stmt.BindInt64(2, int64(symbol.Kind))
 	}
-	if documentation == "" {
-		insertStmt.BindNull(4)
+	if documentation := strings.Join(symbol.Documentation, "\n"); documentation == "" {
+		stmt.BindNull(3)
 	} else {
-		insertStmt.BindText(4, documentation)
+		stmt.BindText(3, documentation)
 	}
 	if symbol.EnclosingSymbol == "" {
-		insertStmt.BindNull(5)
+		stmt.BindNull(4)
+	} else {
+		stmt.BindText(4, symbol.EnclosingSymbol)
+	}
+	if symbol.SignatureDocumentation == nil {
+		stmt.BindNull(5)
+	} else {
+		signature, err := proto.Marshal(symbol.SignatureDocumentation)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to serialize signature of symbol %s", symbol.Symbol)
+		}
+		stmt.BindBytes(5, signature)
+	}
+	stmt.BindInt64(6, int64(source))
+	if found {
+		stmt.BindInt64(7, symbolID)
 	} else {
-		insertStmt.BindText(5, symbol.EnclosingSymbol)
+		stmt.BindText(7, symbol.Symbol)
+		stmt.BindInt64(8, c.indexID)
 	}
 
-	if _, err = insertStmt.Step(); err != nil {
+	if _, err = stmt.Step(); err != nil {
 		return 0, errors.Wrapf(err, "failed to insert symbol %s", symbol.Symbol)
 	}
-	if c.conn.Changes() == 0 {
-		log.Fatal(fmt.Errorf("expected map to de-duplicate inserts eagerly, but attempted to insert symbol %q"+
-			"despite it existing for ID: %d", symbol.Symbol, symbolID))
+	symbolID = stmt.ColumnInt64(0)
+	if err = stmt.Reset(); err != nil {
+		return 0, err
+	}
+	return symbolID, c.insertRelationships(symbolID, symbol.Relationships, found)
+}
+
+// insertRelationships inserts the relationships of a symbol, replacing the
+// existing ones if needed. Related symbols without SymbolInformation get a
+// placeholder row in global_symbols. Relationships to local symbols are
+// skipped.
+func (c *Converter) insertRelationships(symbolID int64, relationships []*scip.Relationship, replace bool) error {
+	if replace {
+		deleteStmt := c.stmts.deleteRelationships
+		deleteStmt.BindInt64(1, symbolID)
+		if _, err := deleteStmt.Step(); err != nil {
+			return errors.Wrap(err, "failed to delete relationships")
+		}
+		if err := deleteStmt.Reset(); err != nil {
+			return errors.Wrap(err, "resetting delete from relationships statement")
+		}
+	}
+
+	stmt := c.stmts.relationship
+	for _, rel := range relationships {
+		if rel.Symbol == "" || scip.IsLocalSymbol(rel.Symbol) {
+			continue
+		}
+		relatedID, err := c.insertGlobalSymbol(&scip.SymbolInformation{Symbol: rel.Symbol}, symbolInfoNone)
+		if err != nil {
+			return errors.Wrapf(err, "inserting symbol %q for relationship", rel.Symbol)
+		}
+
+		stmt.BindInt64(1, symbolID)
+		stmt.BindInt64(2, relatedID)
+		stmt.BindBool(3, rel.IsReference)
+		stmt.BindBool(4, rel.IsImplementation)
+		stmt.BindBool(5, rel.IsTypeDefinition)
+		stmt.BindBool(6, rel.IsDefinition)
+		if _, err = stmt.Step(); err != nil {
+			return errors.Wrapf(err, "failed to insert relationship to symbol %q", rel.Symbol)
+		}
+		if err = stmt.Reset(); err != nil {
+			return errors.Wrap(err, "resetting insert into relationships statement")
+		}
+	}
+	return nil
+}
+
+// insertDocumentSymbol records that the document lists the SymbolInformation
+// for the symbol, so that the document can be reconstructed from the database.
+func (c *Converter) insertDocumentSymbol(docID, symbolID int64) error {
+	stmt := c.stmts.documentSymbol
+	stmt.BindInt64(1, docID)
+	stmt.BindInt64(2, symbolID)
+	if _, err := stmt.Step(); err != nil {
+		return errors.Wrapf(err, "failed to insert into document_symbols for symbol ID %d", symbolID)
 	}
-	symbolID = insertStmt.ColumnInt64(0)
-	err = insertStmt.Reset()
-	return symbolID, err
+	return stmt.Reset()
 }
 
 func (c *Chunk) toDBFormat(encoder *zstd.Encoder) ([]byte, error) {
@@ -496,24 +1134,14 @@ func (c *Chunk) fromDBFormat(reader *bytes.Reader, decoder *zstd.Decoder) error
 	return nil
 }
 
-func (c *Converter) insertChunk(chunk Chunk, docID int64, chunkIndex int) (chunkID int64, err error) {
-	compressedOccurrences, err := chunk.toDBFormat(c.zstdWriter)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to serialize chunk")
-	}
-
-	chunkStmt, err := c.conn.Prepare(
-		`INSERT INTO chunks (document_id, chunk_index, start_line, end_line, occurrences)
-		VALUES (?, ?, ?, ?, ?) RETURNING id`)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to prepare chunk statement")
-	}
-
+func (c *Converter) insertChunk(chunk preparedChunk, docID int64, chunkIndex int) (chunkID int64, err error) {
+	chunkStmt := c.stmts.chunk
 	chunkStmt.BindInt64(1, docID)
 	chunkStmt.BindInt64(2, int64(chunkIndex))
-	chunkStmt.BindInt64(3, int64(chunk.StartLine))
-	chunkStmt.BindInt64(4, int64(chunk.EndLine))
-	chunkStmt.BindBytes(5, compressedOccurrences)
+	chunkStmt.BindInt64(3, int64(chunk.startLine))
+	chunkStmt.BindInt64(4, int64(chunk.endLine))
+	chunkStmt.BindBytes(5, chunk.occurrences)
+	chunkStmt.BindInt64(6, c.indexID)
 
 	_, err = chunkStmt.Step()
 	if err != nil {
@@ -524,22 +1152,17 @@ func (c *Converter) insertChunk(chunk Chunk, docID int64, chunkIndex int) (chunk
 	return chunkID, err
 }
 
-func (c *Converter) insertDocument(doc *scip.Document) (docID int64, err error) {
-	docStmt, err := c.conn.Prepare(
-		`INSERT INTO documents (language, relative_path, position_encoding, text)
-		VALUES (?, ?, ?, ?)
-		RETURNING id`)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to prepare document statement")
-	}
-
+// insertDocument inserts the document, returning false if there already is
+// a document with the same relative path.
+func (c *Converter) insertDocument(doc *scip.Document) (docID int64, ok bool, err error) {
+	docStmt := c.stmts.document
 	if doc.Language == "" {
 		docStmt.BindNull(1)
 	} else {
 		docStmt.BindText(1, doc.Language)
 	}
 	if doc.RelativePath == "" {
-		return 0, errors.New("relative path must not be empty")
+		return 0, false, errors.New("relative path must not be empty")
 	}
 	docStmt.BindText(2, doc.RelativePath)
 	switch doc.PositionEncoding {
@@ -552,20 +1175,23 @@ func (c *Converter) insertDocument(doc *scip.Document) (docID int64, err error)
 	case scip.PositionEncoding_UTF32CodeUnitOffsetFromLineStart:
 		docStmt.BindText(3, "UTF-32")
 	default:
-		return 0, errors.Errorf("unknown position encoding %d", doc.PositionEncoding)
+		return 0, false, errors.Errorf("unknown position encoding %d", doc.PositionEncoding)
 	}
 	if doc.Text == "" {
 		docStmt.BindNull(4)
 	} else {
 		docStmt.BindText(4, doc.Text)
 	}
+	docStmt.BindInt64(5, c.indexID)
 
-	if _, err = docStmt.Step(); err != nil {
-		return 0, errors.Wrapf(err, "failed to insert document %s", doc.RelativePath)
+	if ok, err = docStmt.Step(); err != nil {
+		return 0, false, errors.Wrapf(err, "failed to insert document %s", doc.RelativePath)
+	}
+	if ok {
+		docID = docStmt.ColumnInt64(0)
 	}
-	docID = docStmt.ColumnInt64(0)
 	err = docStmt.Reset()
-	return docID, err
+	return docID, ok, err
 }
 
 type Chunk struct {
@@ -574,6 +1200,56 @@ type Chunk struct {
 	Occurrences []*scip.Occurrence
 }
 
+// chunk splits the occurrences of a document into chunks with the chunking
+// strategy of the converter.
+func (c *Converter) chunk(occurrences []*scip.Occurrence) []Chunk {
+	if c.chunkStrategy == chunkByDefinitions {
+		return chunkOccurrencesByDefinitions(occurrences, c.chunkSize)
+	}
+	return chunkOccurrences(occurrences, c.chunkSize)
+}
+
+// chunkOccurrencesByDefinitions splits occurrences at the start of the
+// enclosing ranges of multi-line definitions of global symbols, and at the
+// line after their end. Single-line definitions, such as fields, are
+// ignored, as they'd make chunks too small. The resulting parts are split
+// further into chunks of the specified size.
+func chunkOccurrencesByDefinitions(occurrences []*scip.Occurrence, chunkSize int) []Chunk {
+	var boundaries []int32
+	for _, occ := range occurrences {
+		if !scip.SymbolRole_Definition.Matches(occ) ||
+			scip.IsLocalSymbol(occ.Symbol) ||
+			len(occ.EnclosingRange) < 3 {
+			continue
+		}
+		enclRange, err := scip.NewRange(occ.EnclosingRange)
+		if err != nil || enclRange.Start.Line == enclRange.End.Line {
+			continue
+		}
+		boundaries = append(boundaries, enclRange.Start.Line, enclRange.End.Line+1)
+	}
+	slices.Sort(boundaries)
+	boundaries = slices.Compact(boundaries)
+
+	startLine := func(occ *scip.Occurrence) int32 {
+		return scip.NewRangeUnchecked(occ.Range).Start.Line
+	}
+	var chunks []Chunk
+	for lo := 0; lo < len(occurrences); {
+		// The part ends before the first boundary after the line of its
+		// first occurrence.
+		hi := len(occurrences)
+		if i, _ := slices.BinarySearch(boundaries, startLine(occurrences[lo])+1); i < len(boundaries) {
+			hi = lo + sort.Search(len(occurrences)-lo, func(j int) bool {
+				return startLine(occurrences[lo+j]) >= boundaries[i]
+			})
+		}
+		chunks = append(chunks, chunkOccurrences(occurrences[lo:hi], chunkSize)...)
+		lo = hi
+	}
+	return chunks
+}
+
 // chunkOccurrences splits occurrences into chunks of the specified size
 func chunkOccurrences(occurrences []*scip.Occurrence, chunkSize int) []Chunk {
 	if len(occurrences) == 0 {
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sourcegraph/conc/stream"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+// convertPipeline converts the documents of an index in parallel.
+//
+// Worker goroutines canonicalize, chunk and compress documents, which
+// doesn't need the database. The prepared documents are written by a single
+// goroutine in their order in the index, as a SQLite connection can't be
+// used concurrently, and the order determines which of several documents
+// with the same path is kept. Metadata and external symbols are written by
+// the same goroutine, in order with the documents.
+//
+// At most jobs documents are prepared at a time, and the stream only queues
+// a bounded number of prepared documents, so memory usage is still bounded
+// by the size of a few documents.
+type convertPipeline struct {
+	c      *Converter
+	stream *stream.Stream
+	// encoders holds one zstd encoder per worker.
+	encoders chan *zstd.Encoder
+
+	mu sync.Mutex
+	// err is the first error of the conversion. Once it is set, nothing
+	// else is written.
+	err error
+}
+
+func newConvertPipeline(c *Converter) (*convertPipeline, error) {
+	jobs := max(c.jobs, 1)
+	p := &convertPipeline{
+		c:        c,
+		stream:   stream.New().WithMaxGoroutines(jobs),
+		encoders: make(chan *zstd.Encoder, jobs),
+	}
+	for range jobs {
+		// Chunks are small, so the parallelism comes from the workers
+		// rather than from the encoders.
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, "zstd writer creation")
+		}
+		p.encoders <- encoder
+	}
+	return p, nil
+}
+
+// document schedules the conversion of the document at position i in the
+// index. It returns the error which stopped the pipeline, if any.
+func (p *convertPipeline) document(i int, doc *scip.Document) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	p.stream.Go(func() stream.Callback {
+		if p.failed() != nil {
+			return func() {}
+		}
+		encoder := <-p.encoders
+		prepared, err := p.c.prepareDocument(i, doc, encoder)
+		p.encoders <- encoder
+		return func() {
+			p.run(func() error {
+				if err != nil {
+					return err
+				}
+				return p.c.writeDocument(prepared)
+			})
+		}
+	})
+	return nil
+}
+
+// write schedules fn, which writes to the database, to run once the
+// documents scheduled before it have been written. It returns the error
+// which stopped the pipeline, if any.
+func (p *convertPipeline) write(fn func() error) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	p.stream.Go(func() stream.Callback {
+		return func() { p.run(fn) }
+	})
+	return nil
+}
+
+// run runs fn unless the pipeline has stopped.
+func (p *convertPipeline) run(fn func() error) {
+	if p.failed() == nil {
+		p.fail(fn())
+	}
+}
+
+// fail stops the pipeline with err, unless err is nil or the pipeline has
+// stopped already.
+func (p *convertPipeline) fail(err error) {
+	if err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *convertPipeline) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// wait waits until everything scheduled has been written, and returns the
+// error which stopped the pipeline, if any.
+func (p *convertPipeline) wait() error {
+	p.stream.Wait()
+	return p.failed()
+}
+
+// preparedDocument is a canonicalized document, with its occurrences split
+// into compressed chunks.
+type preparedDocument struct {
+	// index is the position of the document in the index.
+	index  int
+	doc    *scip.Document
+	chunks []preparedChunk
+}
+
+// preparedChunk is a chunk of occurrences in the format stored in the
+// chunks table.
+type preparedChunk struct {
+	startLine, endLine int32
+	occurrences        []byte
+	// symbolRoles maps the global symbols of the occurrences to their
+	// roles. localSymbolRoles does the same for local symbols, and is only
+	// filled if Converter.indexLocalSymbols is set.
+	symbolRoles, localSymbolRoles map[string]map[int32]struct{}
+}
+
+// prepareDocument does the part of converting a document which doesn't
+// need the database, so that it can run concurrently with the writes.
+func (c *Converter) prepareDocument(i int, doc *scip.Document, encoder *zstd.Encoder) (preparedDocument, error) {
+	doc = scip.CanonicalizeDocument(doc)
+	prepared := preparedDocument{index: i, doc: doc}
+	for chunkIndex, chunk := range c.chunk(doc.Occurrences) {
+		occurrences, err := chunk.toDBFormat(encoder)
+		if err != nil {
+			return preparedDocument{}, errors.Wrapf(err, "failed to serialize chunk %d of document %q", chunkIndex, doc.RelativePath)
+		}
+
+		// Prepare data for entry into mentions table
+		symbolRoles := make(map[string]map[int32]struct{})
+		localSymbolRoles := make(map[string]map[int32]struct{})
+		for _, occ := range chunk.Occurrences {
+			roles := symbolRoles
+			if scip.IsLocalSymbol(occ.Symbol) {
+				if !c.indexLocalSymbols {
+					continue
+				}
+				roles = localSymbolRoles
+			}
+			if roles[occ.Symbol] == nil {
+				roles[occ.Symbol] = make(map[int32]struct{})
+			}
+			roles[occ.Symbol][occ.SymbolRoles] = struct{}{}
+		}
+		prepared.chunks = append(prepared.chunks, preparedChunk{
+			startLine:        chunk.StartLine,
+			endLine:          chunk.EndLine,
+			occurrences:      occurrences,
+			symbolRoles:      symbolRoles,
+			localSymbolRoles: localSymbolRoles,
+		})
+	}
+	return prepared, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+// reverseConvertMain converts the index with the given ID back to a SCIP
+// index. If indexID is 0, the database must contain a single index.
+func reverseConvertMain(sqliteDBPath, indexPath string, indexID int64) (err error) {
+	conn, err := openConvertedDB(sqliteDBPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.CombineErrors(err, conn.Close())
+	}()
+
+	indexID, err = resolveIndexID(conn, indexID)
+	if err != nil {
+		return err
+	}
+	index, err := readIndexFromDB(conn, indexID)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize SCIP index")
+	}
+
+	outputDir := filepath.Dir(indexPath)
+	if outputDir != "." {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create output directory %s", outputDir)
+		}
+	}
+	return os.WriteFile(indexPath, data, 0644)
+}
+
+// resolveIndexID checks that the index with the given ID exists. If
+// indexID is 0, it returns the ID of the only index in the database.
+func resolveIndexID(conn *sqlite.Conn, indexID int64) (int64, error) {
+	var ids []int64
+	err := sqlitex.ExecuteTransient(conn, `SELECT id FROM indexes WHERE $id = 0 OR id = $id ORDER BY id`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$id": indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				ids = append(ids, stmt.ColumnInt64(0))
+				return nil
+			},
+		})
+	if err != nil {
+		return 0, errors.Wrap(err, "reading indexes")
+	}
+	switch {
+	case len(ids) == 1:
+		return ids[0], nil
+	case indexID != 0:
+		return 0, errors.Newf("index not found: %d", indexID)
+	case len(ids) == 0:
+		return 0, errors.New("database contains no indexes")
+	default:
+		return 0, errors.Newf("database contains %d indexes (IDs %v); select one with --index", len(ids), ids)
+	}
+}
+
+// readIndexFromDB reconstructs the SCIP index with the given ID from a
+// database created by Converter.Convert.
+//
+// The database doesn't store everything in the original index, so the
+// result differs from the canonicalized input in a few ways:
+//   - External symbols are missing unless they were imported (see
+//     Converter.importExternalSymbols).
+//   - Documents with a duplicate relative path are missing.
+//   - SymbolInformation for local symbols is missing, as are
+//     relationships to local symbols.
+//   - The documentation strings of SymbolInformation are joined into a
+//     single string.
+//   - If several documents have SymbolInformation for the same symbol,
+//     all of them get the information from the first document.
+func readIndexFromDB(conn *sqlite.Conn, indexID int64) (*scip.Index, error) {
+	index := &scip.Index{}
+	docs := map[int64]*scip.Document{}
+
+	metadata, err := readMetadata(conn, indexID)
+	if err != nil {
+		return nil, err
+	}
+	index.Metadata = metadata
+
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT id, language, relative_path, position_encoding, text FROM documents WHERE index_id = ? ORDER BY id`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				doc := &scip.Document{
+					Language:     stmt.ColumnText(1),
+					RelativePath: stmt.ColumnText(2),
+					Text:         stmt.ColumnText(4),
+				}
+				switch encoding := stmt.ColumnText(3); encoding {
+				case "":
+					doc.PositionEncoding = scip.PositionEncoding_UnspecifiedPositionEncoding
+				case "UTF-8":
+					doc.PositionEncoding = scip.PositionEncoding_UTF8CodeUnitOffsetFromLineStart
+				case "UTF-16":
+					doc.PositionEncoding = scip.PositionEncoding_UTF16CodeUnitOffsetFromLineStart
+				case "UTF-32":
+					doc.PositionEncoding = scip.PositionEncoding_UTF32CodeUnitOffsetFromLineStart
+				default:
+					return errors.Newf("unknown position encoding %q for document %q", encoding, doc.RelativePath)
+				}
+				docs[stmt.ColumnInt64(0)] = doc
+				index.Documents = append(index.Documents, doc)
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading documents")
+	}
+
+	zstdReader, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "zstd reader creation")
+	}
+	defer zstdReader.Close()
+
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT document_id, chunk_index, occurrences FROM chunks WHERE index_id = ? ORDER BY document_id, chunk_index`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				doc, ok := docs[stmt.ColumnInt64(0)]
+				if !ok {
+					return errors.Newf("chunk refers to missing document ID %d", stmt.ColumnInt64(0))
+				}
+				var chunk Chunk
+				if err := chunk.fromDBFormat(stmt.ColumnReader(2), zstdReader); err != nil {
+					return errors.Wrapf(err, "chunk %d of document %q", stmt.ColumnInt64(1), doc.RelativePath)
+				}
+				doc.Occurrences = append(doc.Occurrences, chunk.Occurrences...)
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading chunks")
+	}
+
+	infos := map[string][]*scip.SymbolInformation{}
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT ds.document_id, g.symbol, g.display_name, g.kind, g.documentation, g.enclosing_symbol, g.signature
+		FROM document_symbols ds
+		JOIN global_symbols g ON g.id = ds.symbol_id
+		WHERE g.index_id = ?
+		ORDER BY ds.document_id, g.symbol`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				doc, ok := docs[stmt.ColumnInt64(0)]
+				if !ok {
+					return errors.Newf("symbol refers to missing document ID %d", stmt.ColumnInt64(0))
+				}
+				info, err := readSymbolInformation(stmt, 1)
+				if err != nil {
+					return err
+				}
+				doc.Symbols = append(doc.Symbols, info)
+				infos[info.Symbol] = append(infos[info.Symbol], info)
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading symbols")
+	}
+
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT symbol, display_name, kind, documentation, enclosing_symbol, signature
+		FROM global_symbols WHERE index_id = ? AND info_source = ? ORDER BY symbol`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID, int64(symbolInfoExternal)},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				info, err := readSymbolInformation(stmt, 0)
+				if err != nil {
+					return err
+				}
+				index.ExternalSymbols = append(index.ExternalSymbols, info)
+				infos[info.Symbol] = append(infos[info.Symbol], info)
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading external symbols")
+	}
+
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT g.symbol, related.symbol, r.is_reference, r.is_implementation, r.is_type_definition, r.is_definition
+		FROM relationships r
+		JOIN global_symbols g ON g.id = r.symbol_id
+		JOIN global_symbols related ON related.id = r.related_symbol_id
+		WHERE g.index_id = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				for _, info := range infos[stmt.ColumnText(0)] {
+					info.Relationships = append(info.Relationships, &scip.Relationship{
+						Symbol:           stmt.ColumnText(1),
+						IsReference:      stmt.ColumnBool(2),
+						IsImplementation: stmt.ColumnBool(3),
+						IsTypeDefinition: stmt.ColumnBool(4),
+						IsDefinition:     stmt.ColumnBool(5),
+					})
+				}
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading relationships")
+	}
+
+	for i, doc := range index.Documents {
+		index.Documents[i] = scip.CanonicalizeDocument(doc)
+	}
+	for i, info := range index.ExternalSymbols {
+		index.ExternalSymbols[i] = scip.CanonicalizeSymbol(info)
+	}
+	return index, nil
+}
+
+// readMetadata reads the metadata of the index, which is nil if the index
+// had no metadata.
+func readMetadata(conn *sqlite.Conn, indexID int64) (*scip.Metadata, error) {
+	var metadata *scip.Metadata
+	err := sqlitex.ExecuteTransient(conn,
+		`SELECT protocol_version, project_root, text_encoding, tool_name, tool_version, tool_arguments
+		FROM indexes WHERE id = ? AND protocol_version IS NOT NULL`,
+		&sqlitex.ExecOptions{
+			Args: []any{indexID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				metadata = &scip.Metadata{
+					Version:     scip.ProtocolVersion(stmt.ColumnInt64(0)),
+					ProjectRoot: stmt.ColumnText(1),
+				}
+				switch encoding := stmt.ColumnText(2); encoding {
+				case "":
+				case "UTF-8":
+					metadata.TextDocumentEncoding = scip.TextEncoding_UTF8
+				case "UTF-16":
+					metadata.TextDocumentEncoding = scip.TextEncoding_UTF16
+				default:
+					return errors.Newf("unknown text encoding %q", encoding)
+				}
+				if stmt.ColumnType(5) != sqlite.TypeNull {
+					metadata.ToolInfo = &scip.ToolInfo{Name: stmt.ColumnText(3), Version: stmt.ColumnText(4)}
+					if err := json.Unmarshal([]byte(stmt.ColumnText(5)), &metadata.ToolInfo.Arguments); err != nil {
+						return errors.Wrap(err, "failed to parse tool arguments")
+					}
+				}
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading metadata")
+	}
+	return metadata, nil
+}
+
+// readSymbolInformation reads the symbol, display_name, kind,
+// documentation, enclosing_symbol and signature columns of global_symbols,
+// starting at column col.
+func readSymbolInformation(stmt *sqlite.Stmt, col int) (*scip.SymbolInformation, error) {
+	info := &scip.SymbolInformation{
+		Symbol:          stmt.ColumnText(col),
+		DisplayName:     stmt.ColumnText(col + 1),
+		Kind:            scip.SymbolInformation_Kind(stmt.ColumnInt64(col + 2)),
+		EnclosingSymbol: stmt.ColumnText(col + 4),
+	}
+	if documentation := stmt.ColumnText(col + 3); documentation != "" {
+		info.Documentation = []string{documentation}
+	}
+	if stmt.ColumnType(col+5) != sqlite.TypeNull {
+		info.SignatureDocumentation = &scip.Document{}
+		signature := make([]byte, stmt.ColumnLen(col+5))
+		stmt.ColumnBytes(col+5, signature)
+		if err := proto.Unmarshal(signature, info.SignatureDocumentation); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal signature of symbol %q", info.Symbol)
+		}
+	}
+	return info, nil
+}
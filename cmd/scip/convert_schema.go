@@ -0,0 +1,573 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+// Databases created by expt-convert record the version of their schema in
+// PRAGMA user_version. When changing the schema, bump schemaVersion, add a
+// migration from the previous version to schemaMigrations, and add a fixture
+// created with the previous version to testdata/convert.
+//
+// schemaTables and the queries of Converter always describe the latest
+// version, so migrations must not use them: each migration has its own copy
+// of the statements of the version which it upgrades to.
+
+// schemaVersion is the version of the schema created by schemaTables.
+const schemaVersion = 4
+
+// schemaMigrations maps each schema version to the migration which upgrades
+// a database from that version to the next one. Migrations run in a single
+// transaction, with foreign key checks disabled so that tables can be
+// rebuilt.
+var schemaMigrations = map[int]func(conn *sqlite.Conn) error{
+	1: migrateSchemaV1,
+	2: migrateSchemaV2,
+	3: migrateSchemaV3,
+}
+
+var schemaTables = slices.Concat(coreTables, searchTables, occurrenceTables)
+
+// coreTables hold the index, and were added in schema version 2.
+var coreTables = []string{
+	`CREATE TABLE indexes (
+		id INTEGER PRIMARY KEY,
+		repo TEXT,
+		commit_id TEXT,
+		project_root TEXT,
+		tool_name TEXT,
+		tool_version TEXT,
+		tool_arguments TEXT,
+		text_encoding TEXT,
+		protocol_version INTEGER,
+		created_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE documents (
+		id INTEGER PRIMARY KEY,
+		index_id INTEGER NOT NULL,
+		language TEXT,
+		relative_path TEXT NOT NULL,
+		position_encoding TEXT,
+		text TEXT,
+		UNIQUE (index_id, relative_path),
+		FOREIGN KEY (index_id) REFERENCES indexes(id)
+	);`,
+	`CREATE TABLE chunks (
+		id INTEGER PRIMARY KEY,
+		index_id INTEGER NOT NULL,
+		document_id INTEGER NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		start_line INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		occurrences BLOB NOT NULL,
+		FOREIGN KEY (index_id) REFERENCES indexes(id),
+		FOREIGN KEY (document_id) REFERENCES documents(id)
+	);`,
+	`CREATE TABLE global_symbols (
+		id INTEGER PRIMARY KEY,
+		index_id INTEGER NOT NULL,
+		symbol TEXT NOT NULL,
+		display_name TEXT,
+		kind INTEGER,
+		documentation TEXT,
+		signature BLOB,
+		enclosing_symbol TEXT,
+		info_source INTEGER NOT NULL,
+		UNIQUE (index_id, symbol),
+		FOREIGN KEY (index_id) REFERENCES indexes(id)
+	);`,
+	`CREATE TABLE relationships (
+		symbol_id INTEGER NOT NULL,
+		related_symbol_id INTEGER NOT NULL,
+		is_reference INTEGER NOT NULL,
+		is_implementation INTEGER NOT NULL,
+		is_type_definition INTEGER NOT NULL,
+		is_definition INTEGER NOT NULL,
+		PRIMARY KEY (symbol_id, related_symbol_id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id),
+		FOREIGN KEY (related_symbol_id) REFERENCES global_symbols(id)
+	);`,
+	`CREATE TABLE document_symbols (
+		document_id INTEGER NOT NULL,
+		symbol_id INTEGER NOT NULL,
+		PRIMARY KEY (document_id, symbol_id),
+		FOREIGN KEY (document_id) REFERENCES documents(id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+	);`,
+	`CREATE TABLE mentions (
+		chunk_id INTEGER NOT NULL,
+		symbol_id INTEGER NOT NULL,
+		role INTEGER NOT NULL,
+		PRIMARY KEY (chunk_id, symbol_id, role),
+		FOREIGN KEY (chunk_id) REFERENCES chunks(id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+	);`,
+	`CREATE TABLE defn_enclosing_ranges (
+		id INTEGER PRIMARY KEY,
+		document_id INTEGER NOT NULL,
+		symbol_id INTEGER NOT NULL,
+		start_line INTEGER NOT NULL,
+		start_char INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		end_char INTEGER NOT NULL,
+		FOREIGN KEY (document_id) REFERENCES documents(id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+	);`,
+}
+
+// searchTables are the full-text search tables, added in schema version 3.
+// Their rowids are the IDs of the rows in global_symbols and documents.
+var searchTables = []string{
+	`CREATE VIRTUAL TABLE symbols_fts USING fts5(display_name, descriptors, documentation);`,
+	`CREATE VIRTUAL TABLE documents_fts USING fts5(text);`,
+}
+
+// occurrenceTables are the tables with data from occurrences outside of
+// chunks, added in schema version 4. local_mentions is like mentions for
+// local symbols, and is only populated with Converter.indexLocalSymbols.
+var occurrenceTables = []string{
+	`CREATE TABLE diagnostics (
+		id INTEGER PRIMARY KEY,
+		document_id INTEGER NOT NULL,
+		start_line INTEGER NOT NULL,
+		start_char INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		end_char INTEGER NOT NULL,
+		severity INTEGER,
+		code TEXT,
+		message TEXT,
+		source TEXT,
+		tags TEXT,
+		FOREIGN KEY (document_id) REFERENCES documents(id)
+	);`,
+	`CREATE TABLE local_mentions (
+		document_id INTEGER NOT NULL,
+		chunk_id INTEGER NOT NULL,
+		symbol TEXT NOT NULL,
+		role INTEGER NOT NULL,
+		PRIMARY KEY (chunk_id, symbol, role),
+		FOREIGN KEY (document_id) REFERENCES documents(id),
+		FOREIGN KEY (chunk_id) REFERENCES chunks(id)
+	);`,
+}
+
+// migrateSchema creates the schema in an empty database, or upgrades the
+// schema of an existing database to schemaVersion.
+func migrateSchema(conn *sqlite.Conn) (err error) {
+	version, err := readSchemaVersion(conn)
+	if err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return errors.Newf("database has schema version %d, which is newer than the supported version %d; upgrade scip",
+			version, schemaVersion)
+	}
+	if version == schemaVersion {
+		return nil
+	}
+
+	// Foreign key checks can't be toggled inside a transaction.
+	if err := executeAll(conn, []string{`PRAGMA foreign_keys = OFF;`}); err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.CombineErrors(err, executeAll(conn, []string{`PRAGMA foreign_keys = ON;`}))
+	}()
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer endFn(&err)
+
+	if version == 0 {
+		if err := executeAll(conn, schemaTables); err != nil {
+			return err
+		}
+	}
+	for ; version > 0 && version < schemaVersion; version++ {
+		if err := schemaMigrations[version](conn); err != nil {
+			return errors.Wrapf(err, "failed to migrate schema from version %d to %d", version, version+1)
+		}
+	}
+	return executeAll(conn, []string{fmt.Sprintf(`PRAGMA user_version = %d;`, schemaVersion)})
+}
+
+// readSchemaVersion returns the schema version of the database, or 0 if the
+// database is empty.
+func readSchemaVersion(conn *sqlite.Conn) (int, error) {
+	var version, tables, v1Columns int
+	err := sqlitex.ExecuteTransient(conn, `PRAGMA user_version`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			version = stmt.ColumnInt(0)
+			return nil
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read schema version")
+	}
+	if version != 0 {
+		return version, nil
+	}
+
+	// Version 1 predates user_version, so it's recognized by the
+	// relationships column, which was later replaced by a table.
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT
+			(SELECT count(*) FROM sqlite_master WHERE type = 'table'),
+			(SELECT count(*) FROM pragma_table_info('global_symbols') WHERE name = 'relationships')`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				tables, v1Columns = stmt.ColumnInt(0), stmt.ColumnInt(1)
+				return nil
+			},
+		})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read schema")
+	}
+	switch {
+	case tables == 0:
+		return 0, nil
+	case v1Columns == 1:
+		return 1, nil
+	default:
+		return 0, errors.New("database has an unknown schema; is it a database created by 'scip expt-convert'?")
+	}
+}
+
+// openConvertedDB opens a database created by expt-convert for reading.
+// Readers don't upgrade databases, so the database must have the current
+// schema version.
+func openConvertedDB(path string) (*sqlite.Conn, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, errors.Wrapf(err, "failed to open SQLite database at %s", path)
+	}
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open SQLite database at %s", path)
+	}
+	version, err := readSchemaVersion(conn)
+	switch {
+	case err != nil:
+	case version == 0:
+		err = errors.Newf("database at %s is empty", path)
+	case version < schemaVersion:
+		err = errors.Newf("database at %s has schema version %d, but version %d is required; "+
+			"upgrade it with 'scip expt-convert --migrate %[1]s'", path, version, schemaVersion)
+	case version > schemaVersion:
+		err = errors.Newf("database at %s has schema version %d, which is newer than the supported version %d; upgrade scip",
+			path, version, schemaVersion)
+	}
+	if err != nil {
+		return nil, errors.CombineErrors(err, conn.Close())
+	}
+	return conn, nil
+}
+
+// migrateMain upgrades the schema of the database at the given path.
+func migrateMain(sqliteDBPath string) (err error) {
+	if _, err := os.Stat(sqliteDBPath); err != nil {
+		return errors.Wrapf(err, "failed to open SQLite database at %s", sqliteDBPath)
+	}
+	db, err := createSQLiteDatabase(sqliteDBPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.CombineErrors(err, db.Close())
+	}()
+	// Migrations may rebuild tables, which drops their indexes.
+	return prepareIndexes(db)
+}
+
+// migrateSchemaV1 upgrades a database from schema version 1, which held a
+// single index, to version 2, which supports multiple indexes.
+//
+// The index gets ID 1 and no metadata, which version 1 didn't store.
+// Version 1 didn't record which documents have SymbolInformation for a
+// symbol either, so converting the index back to SCIP loses the
+// SymbolInformation of documents. The signature and relationships
+// columns were never populated in version 1, so they're dropped.
+func migrateSchemaV1(conn *sqlite.Conn) error {
+	tables := []string{"documents", "chunks", "global_symbols", "mentions", "defn_enclosing_ranges"}
+	var statements []string
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf(`ALTER TABLE %s RENAME TO v1_%[1]s;`, table))
+	}
+	statements = append(statements,
+		`CREATE TABLE indexes (
+			id INTEGER PRIMARY KEY,
+			repo TEXT,
+			commit_id TEXT,
+			project_root TEXT,
+			tool_name TEXT,
+			tool_version TEXT,
+			tool_arguments TEXT,
+			text_encoding TEXT,
+			protocol_version INTEGER,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE documents (
+			id INTEGER PRIMARY KEY,
+			index_id INTEGER NOT NULL,
+			language TEXT,
+			relative_path TEXT NOT NULL,
+			position_encoding TEXT,
+			text TEXT,
+			UNIQUE (index_id, relative_path),
+			FOREIGN KEY (index_id) REFERENCES indexes(id)
+		);`,
+		`CREATE TABLE chunks (
+			id INTEGER PRIMARY KEY,
+			index_id INTEGER NOT NULL,
+			document_id INTEGER NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			occurrences BLOB NOT NULL,
+			FOREIGN KEY (index_id) REFERENCES indexes(id),
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		);`,
+		`CREATE TABLE global_symbols (
+			id INTEGER PRIMARY KEY,
+			index_id INTEGER NOT NULL,
+			symbol TEXT NOT NULL,
+			display_name TEXT,
+			kind INTEGER,
+			documentation TEXT,
+			signature BLOB,
+			enclosing_symbol TEXT,
+			info_source INTEGER NOT NULL,
+			UNIQUE (index_id, symbol),
+			FOREIGN KEY (index_id) REFERENCES indexes(id)
+		);`,
+		`CREATE TABLE relationships (
+			symbol_id INTEGER NOT NULL,
+			related_symbol_id INTEGER NOT NULL,
+			is_reference INTEGER NOT NULL,
+			is_implementation INTEGER NOT NULL,
+			is_type_definition INTEGER NOT NULL,
+			is_definition INTEGER NOT NULL,
+			PRIMARY KEY (symbol_id, related_symbol_id),
+			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id),
+			FOREIGN KEY (related_symbol_id) REFERENCES global_symbols(id)
+		);`,
+		`CREATE TABLE document_symbols (
+			document_id INTEGER NOT NULL,
+			symbol_id INTEGER NOT NULL,
+			PRIMARY KEY (document_id, symbol_id),
+			FOREIGN KEY (document_id) REFERENCES documents(id),
+			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+		);`,
+		`CREATE TABLE mentions (
+			chunk_id INTEGER NOT NULL,
+			symbol_id INTEGER NOT NULL,
+			role INTEGER NOT NULL,
+			PRIMARY KEY (chunk_id, symbol_id, role),
+			FOREIGN KEY (chunk_id) REFERENCES chunks(id),
+			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+		);`,
+		`CREATE TABLE defn_enclosing_ranges (
+			id INTEGER PRIMARY KEY,
+			document_id INTEGER NOT NULL,
+			symbol_id INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			start_char INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			end_char INTEGER NOT NULL,
+			FOREIGN KEY (document_id) REFERENCES documents(id),
+			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+		);`,
+		`INSERT INTO indexes (id, created_at) VALUES (1, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));`,
+		`INSERT INTO documents (id, index_id, language, relative_path, position_encoding, text)
+		SELECT id, 1, language, relative_path, position_encoding, text FROM v1_documents;`,
+		`INSERT INTO chunks (id, index_id, document_id, chunk_index, start_line, end_line, occurrences)
+		SELECT id, 1, document_id, chunk_index, start_line, end_line, occurrences FROM v1_chunks;`,
+		// Symbols only have SymbolInformation if any of it was stored, or if
+		// they have a definition with an enclosing range, which required it.
+		// In version 2, info_source is 2 for SymbolInformation from a
+		// document and 0 for placeholders.
+		`INSERT INTO global_symbols (id, index_id, symbol, display_name, kind, documentation, enclosing_symbol, info_source)
+		SELECT id, 1, symbol, display_name, kind, documentation, enclosing_symbol,
+			CASE WHEN coalesce(display_name, kind, documentation, enclosing_symbol) IS NOT NULL
+				OR id IN (SELECT symbol_id FROM v1_defn_enclosing_ranges)
+			THEN 2 ELSE 0 END
+		FROM v1_global_symbols;`,
+		`INSERT INTO mentions (chunk_id, symbol_id, role)
+		SELECT chunk_id, symbol_id, role FROM v1_mentions;`,
+		`INSERT INTO defn_enclosing_ranges (id, document_id, symbol_id, start_line, start_char, end_line, end_char)
+		SELECT id, document_id, symbol_id, start_line, start_char, end_line, end_char FROM v1_defn_enclosing_ranges;`,
+	)
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf(`DROP TABLE v1_%s;`, table))
+	}
+	return executeAll(conn, statements)
+}
+
+// migrateSchemaV2 upgrades a database from schema version 2 to version 3,
+// which adds full-text search. Searching the text of documents is opt-in
+// (see Converter.indexText), so documents_fts stays empty.
+func migrateSchemaV2(conn *sqlite.Conn) error {
+	err := executeAll(conn, []string{
+		`CREATE VIRTUAL TABLE symbols_fts USING fts5(display_name, descriptors, documentation);`,
+		`CREATE VIRTUAL TABLE documents_fts USING fts5(text);`,
+	})
+	if err != nil {
+		return err
+	}
+	insertStmt, err := conn.Prepare(
+		`INSERT INTO symbols_fts (rowid, display_name, descriptors, documentation) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare symbols_fts insert statement")
+	}
+	// Placeholders, which have info_source 0, aren't searchable. The
+	// descriptors column holds the names of the descriptors of the symbol,
+	// separated by spaces.
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT id, symbol, display_name, documentation FROM global_symbols WHERE info_source != 0`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				var names []string
+				if parsed, err := scip.ParseSymbol(stmt.ColumnText(1)); err == nil {
+					for _, descriptor := range parsed.Descriptors {
+						names = append(names, descriptor.Name)
+					}
+				}
+				insertStmt.BindInt64(1, stmt.ColumnInt64(0))
+				insertStmt.BindText(2, stmt.ColumnText(2))
+				insertStmt.BindText(3, strings.Join(names, " "))
+				insertStmt.BindText(4, stmt.ColumnText(3))
+				if _, err := insertStmt.Step(); err != nil {
+					return errors.Wrapf(err, "failed to index symbol %s for search", stmt.ColumnText(1))
+				}
+				return insertStmt.Reset()
+			},
+		})
+	return errors.Wrap(err, "indexing symbols for search")
+}
+
+// migrateSchemaV3 upgrades a database from schema version 3 to version 4,
+// which adds tables for diagnostics and local symbols. The diagnostics are
+// read from the chunks. Indexing local symbols is opt-in, so local_mentions
+// stays empty.
+func migrateSchemaV3(conn *sqlite.Conn) error {
+	err := executeAll(conn, []string{
+		`CREATE TABLE diagnostics (
+			id INTEGER PRIMARY KEY,
+			document_id INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			start_char INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			end_char INTEGER NOT NULL,
+			severity INTEGER,
+			code TEXT,
+			message TEXT,
+			source TEXT,
+			tags TEXT,
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		);`,
+		`CREATE TABLE local_mentions (
+			document_id INTEGER NOT NULL,
+			chunk_id INTEGER NOT NULL,
+			symbol TEXT NOT NULL,
+			role INTEGER NOT NULL,
+			PRIMARY KEY (chunk_id, symbol, role),
+			FOREIGN KEY (document_id) REFERENCES documents(id),
+			FOREIGN KEY (chunk_id) REFERENCES chunks(id)
+		);`,
+	})
+	if err != nil {
+		return err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return errors.Wrap(err, "zstd reader creation")
+	}
+	defer decoder.Close()
+	insertStmt, err := conn.Prepare(
+		`INSERT INTO diagnostics (document_id, start_line, start_char, end_line, end_char, severity, code, message, source, tags)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare diagnostics insert statement")
+	}
+	// In version 3, chunks hold a zstd-compressed scip.Document with only
+	// the occurrences of the chunk.
+	err = sqlitex.ExecuteTransient(conn, `SELECT id, document_id, occurrences FROM chunks ORDER BY id`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				if err := decoder.Reset(stmt.ColumnReader(2)); err != nil {
+					return errors.Wrap(err, "resetting zstd Decoder")
+				}
+				protoBytes, err := io.ReadAll(decoder)
+				if err != nil {
+					return errors.Wrapf(err, "chunk %d: reading compressed data", stmt.ColumnInt64(0))
+				}
+				var chunk scip.Document
+				if err := proto.Unmarshal(protoBytes, &chunk); err != nil {
+					return errors.Wrapf(err, "chunk %d: failed to unmarshal occurrences", stmt.ColumnInt64(0))
+				}
+				for _, occ := range chunk.Occurrences {
+					if err := insertDiagnosticsV4(insertStmt, stmt.ColumnInt64(1), occ); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+	return errors.Wrap(err, "reading diagnostics from chunks")
+}
+
+// insertDiagnosticsV4 inserts the diagnostics of occ into the diagnostics
+// table of schema version 4.
+func insertDiagnosticsV4(stmt *sqlite.Stmt, docID int64, occ *scip.Occurrence) error {
+	if len(occ.Diagnostics) == 0 {
+		return nil
+	}
+	occRange, err := scip.NewRange(occ.Range)
+	if err != nil {
+		return errors.Wrapf(err, "bad range %v for diagnostics of symbol %q", occ.Range, occ.Symbol)
+	}
+	for _, diagnostic := range occ.Diagnostics {
+		stmt.BindInt64(1, docID)
+		stmt.BindInt64(2, int64(occRange.Start.Line))
+		stmt.BindInt64(3, int64(occRange.Start.Character))
+		stmt.BindInt64(4, int64(occRange.End.Line))
+		stmt.BindInt64(5, int64(occRange.End.Character))
+		if diagnostic.Severity == scip.Severity_UnspecifiedSeverity {
+			stmt.BindNull(6)
+		} else {
+			stmt.BindInt64(6, int64(diagnostic.Severity))
+		}
+		bindTextOrNull(stmt, 7, diagnostic.Code)
+		bindTextOrNull(stmt, 8, diagnostic.Message)
+		bindTextOrNull(stmt, 9, diagnostic.Source)
+		if len(diagnostic.Tags) == 0 {
+			stmt.BindNull(10)
+		} else {
+			tags, err := json.Marshal(diagnostic.Tags)
+			if err != nil {
+				return errors.Wrap(err, "failed to serialize diagnostic tags")
+			}
+			stmt.BindText(10, string(tags))
+		}
+		if _, err := stmt.Step(); err != nil {
+			return errors.Wrap(err, "failed to insert diagnostic")
+		}
+		if err := stmt.Reset(); err != nil {
+			return errors.Wrap(err, "resetting insert into diagnostics statement")
+		}
+	}
+	return nil
+}
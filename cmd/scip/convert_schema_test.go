@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/testing/protocmp"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+// loadSchemaFixture creates a database from a SQL dump in testdata/convert.
+func loadSchemaFixture(t *testing.T, name string) string {
+	script, err := os.ReadFile(filepath.Join("testdata", "convert", name))
+	require.NoError(t, err)
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	conn, err := sqlite.OpenConn(dbPath, sqlite.OpenCreate|sqlite.OpenReadWrite)
+	require.NoError(t, err)
+	require.NoError(t, sqlitex.ExecuteScript(conn, string(script), nil))
+	require.NoError(t, conn.Close())
+	return dbPath
+}
+
+// readSchema returns the SQL of all tables and indexes in the database, with
+// whitespace normalized, as migrations indent their copies of the tables
+// differently.
+func readSchema(t *testing.T, dbPath string) []string {
+	conn, err := sqlite.OpenConn(dbPath, sqlite.OpenReadOnly)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+	var schema []string
+	err = sqlitex.ExecuteTransient(conn, `SELECT sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY name`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				schema = append(schema, strings.Join(strings.Fields(stmt.ColumnText(0)), " "))
+				return nil
+			},
+		})
+	require.NoError(t, err)
+	return schema
+}
+
+// migrateSchemaFixture migrates the database and checks that its schema is
+// the same as the schema of a new database.
+func migrateSchemaFixture(t *testing.T, dbPath string) {
+	require.NoError(t, migrateMain(dbPath))
+	// Migrating again is a no-op.
+	require.NoError(t, migrateMain(dbPath))
+
+	freshPath := filepath.Join(t.TempDir(), "fresh.db")
+	fresh, err := createSQLiteDatabase(freshPath)
+	require.NoError(t, err)
+	require.NoError(t, prepareIndexes(fresh))
+	require.NoError(t, fresh.Close())
+	require.Equal(t, readSchema(t, freshPath), readSchema(t, dbPath))
+}
+
+func TestConvertSchema_V1(t *testing.T) {
+	s1 := "scip-go go . . pkg1/S1#"
+	dbPath := loadSchemaFixture(t, "schema_v1.sql")
+	opts := queryOptions{dbPath: dbPath}
+
+	outdated := fmt.Sprintf("has schema version 1, but version %d is required", schemaVersion)
+	err := queryHoverMain(opts, queryTarget{Symbol: s1}, &bytes.Buffer{})
+	require.ErrorContains(t, err, outdated)
+	err = reverseConvertMain(dbPath, filepath.Join(t.TempDir(), "index.scip"), 0)
+	require.ErrorContains(t, err, outdated)
+
+	migrateSchemaFixture(t, dbPath)
+
+	run := func(fn func(out *bytes.Buffer) error) string {
+		var out bytes.Buffer
+		require.NoError(t, fn(&out))
+		return out.String()
+	}
+	autogold.Expect(`{
+  "symbol": "scip-go go . . pkg1/S1#",
+  "displayName": "S1",
+  "kind": "Struct",
+  "documentation": "S1 is a struct."
+}
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryHoverMain(opts, queryTarget{Path: "b.go", Line: 3, Character: 10}, out)
+	}))
+	autogold.Expect(`[
+  {
+    "path": "a.go",
+    "range": [
+      10,
+      5,
+      10,
+      7
+    ],
+    "symbol": "scip-go go . . pkg1/S1#",
+    "symbolRoles": 1
+  },
+  {
+    "path": "b.go",
+    "range": [
+      3,
+      9,
+      3,
+      11
+    ],
+    "symbol": "scip-go go . . pkg1/S1#"
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryOccurrencesMain(opts, queryTarget{Symbol: s1}, 0, out)
+	}))
+
+	indexPath := filepath.Join(t.TempDir(), "index.scip")
+	require.NoError(t, reverseConvertMain(dbPath, indexPath, 0))
+	got, err := readFromOption(indexPath)
+	require.NoError(t, err)
+	expected := &scip.Index{
+		Documents: []*scip.Document{
+			{
+				Language:     "go",
+				RelativePath: "a.go",
+				Occurrences: []*scip.Occurrence{
+					{Symbol: s1, Range: []int32{10, 5, 7}, EnclosingRange: []int32{10, 0, 13, 1}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: "local 0", Range: []int32{11, 1, 2}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: "local 0", Range: []int32{12, 4, 5}},
+				},
+			},
+			{
+				Language:     "go",
+				RelativePath: "b.go",
+				Occurrences: []*scip.Occurrence{
+					{Symbol: "scip-go go . . pkg1/F().", Range: []int32{3, 5, 6}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: s1, Range: []int32{3, 9, 11}},
+				},
+			},
+		},
+	}
+	if diff := gocmp.Diff(expected, got, protocmp.Transform()); diff != "" {
+		t.Fatalf("reverse conversion mismatch (-want +got):\n%s", diff)
+	}
+
+	// New indexes can be added to the migrated database.
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	converter := NewConverter(db, chunkSizeHint)
+	converter.repo = "r2"
+	require.NoError(t, converter.Convert(&scip.Index{Documents: []*scip.Document{{
+		RelativePath: "a.go",
+		Occurrences:  []*scip.Occurrence{{Symbol: s1, Range: []int32{0, 0, 2}}},
+	}}}))
+	require.NoError(t, db.Close())
+	err = queryHoverMain(opts, queryTarget{Path: "a.go", Line: 10, Character: 5}, &bytes.Buffer{})
+	require.ErrorContains(t, err, "document a.go is in 2 indexes")
+}
+
+func TestConvertSchema_V2(t *testing.T) {
+	dbPath := loadSchemaFixture(t, "schema_v2.sql")
+	opts := queryOptions{dbPath: dbPath}
+	err := querySearchMain(opts, "S1", querySearchOptions{}, &bytes.Buffer{})
+	require.ErrorContains(t, err, fmt.Sprintf("has schema version 2, but version %d is required", schemaVersion))
+
+	migrateSchemaFixture(t, dbPath)
+
+	// Symbols of existing indexes are indexed for search.
+	var out bytes.Buffer
+	require.NoError(t, querySearchMain(opts, "struct", querySearchOptions{}, &out))
+	autogold.Expect(`[
+  {
+    "repo": "example",
+    "symbol": "scip-go go . . pkg1/S1#",
+    "displayName": "S1",
+    "kind": "Struct",
+    "documentation": "S1 is a struct.",
+    "definitions": [
+      {
+        "path": "a.go",
+        "range": [
+          10,
+          0,
+          13,
+          1
+        ]
+      }
+    ]
+  }
+]
+`).Equal(t, out.String())
+}
+
+func TestConvertSchema_V3(t *testing.T) {
+	dbPath := loadSchemaFixture(t, "schema_v3.sql")
+	opts := queryOptions{dbPath: dbPath}
+	err := queryDiagnosticsMain(opts, "", &bytes.Buffer{})
+	require.ErrorContains(t, err, fmt.Sprintf("has schema version 3, but version %d is required", schemaVersion))
+
+	migrateSchemaFixture(t, dbPath)
+
+	// Diagnostics are read from the chunks of existing indexes.
+	var out bytes.Buffer
+	require.NoError(t, queryDiagnosticsMain(opts, "", &out))
+	autogold.Expect(`[
+  {
+    "repo": "example",
+    "path": "b.go",
+    "range": [
+      3,
+      9,
+      3,
+      11
+    ],
+    "severity": "Warning",
+    "code": "SA1019",
+    "message": "S1 is deprecated",
+    "source": "staticcheck",
+    "tags": [
+      "Deprecated"
+    ]
+  }
+]
+`).Equal(t, out.String())
+}
+
+func TestConvertSchema_Newer(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, executeAll(db, []string{fmt.Sprintf(`PRAGMA user_version = %d;`, schemaVersion+1)}))
+	require.NoError(t, db.Close())
+
+	_, err = openConvertedDB(dbPath)
+	require.ErrorContains(t, err, "which is newer than the supported version")
+	_, err = createSQLiteDatabase(dbPath)
+	require.ErrorContains(t, err, "which is newer than the supported version")
+}
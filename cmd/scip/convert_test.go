@@ -3,12 +3,24 @@ package main
 import (
 	"bytes"
 	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	gocmp "github.com/google/go-cmp/cmp"
 	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/slices"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"pgregory.net/rapid"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 
@@ -27,9 +39,7 @@ func TestConvert_SmokeTest(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { require.NoError(t, db.Close()) }()
 
-	writer, err := zstd.NewWriter(nil)
-	require.NoError(t, err)
-	converter := NewConverter(db, chunkSizeHint, writer)
+	converter := NewConverter(db, chunkSizeHint)
 	err = converter.Convert(index)
 	require.NoError(t, err)
 
@@ -173,3 +183,530 @@ type occurrenceData struct {
 	Role         int32
 	Range        scip.Range
 }
+
+func TestConvert_RoundTrip(t *testing.T) {
+	rapid.Check(t, func(rt *rapid.T) {
+		index := &scip.Index{
+			Metadata:        genConvertMetadata().Draw(rt, "metadata"),
+			Documents:       rapid.SliceOfN(genConvertDocument(), 0, 4).Draw(rt, "documents"),
+			ExternalSymbols: rapid.SliceOfN(genConvertExternalSymbol(), 0, 3).Draw(rt, "externalSymbols"),
+		}
+		importExternalSymbols := rapid.Bool().Draw(rt, "importExternalSymbols")
+		expected := expectedRoundTrip(index, importExternalSymbols)
+		indexBytes, err := proto.Marshal(index)
+		require.NoError(rt, err)
+
+		dir := t.TempDir()
+		sqliteDBPath := filepath.Join(dir, "index.db")
+		db, err := createSQLiteDatabase(sqliteDBPath)
+		require.NoError(rt, err)
+		converter := NewConverter(db, 3)
+		converter.jobs = rapid.IntRange(1, 4).Draw(rt, "jobs")
+		converter.chunkStrategy = rapid.SampledFrom([]string{chunkByLines, chunkByDefinitions}).Draw(rt, "chunkStrategy")
+		converter.importExternalSymbols = importExternalSymbols
+		converter.indexLocalSymbols = rapid.Bool().Draw(rt, "indexLocalSymbols")
+		if rapid.Bool().Draw(rt, "streaming") {
+			require.NoError(rt, converter.ConvertStreaming(context.Background(), bytes.NewReader(indexBytes)))
+		} else {
+			require.NoError(rt, converter.Convert(index))
+		}
+		require.NoError(rt, prepareIndexes(db))
+		require.NoError(rt, db.Close())
+
+		scipPath := filepath.Join(dir, "index.scip")
+		require.NoError(rt, reverseConvertMain(sqliteDBPath, scipPath, 0))
+		got, err := readFromOption(scipPath)
+		require.NoError(rt, err)
+
+		if diff := gocmp.Diff(expected, got, protocmp.Transform()); diff != "" {
+			rt.Fatalf("round trip mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// expectedRoundTrip returns the canonicalized index minus the information
+// that isn't stored in the database (see readIndexFromDB).
+func expectedRoundTrip(index *scip.Index, importExternalSymbols bool) *scip.Index {
+	expected := &scip.Index{}
+	if index.Metadata != nil {
+		expected.Metadata = proto.Clone(index.Metadata).(*scip.Metadata)
+	}
+	stored := func(info *scip.SymbolInformation) *scip.SymbolInformation {
+		stored := proto.Clone(info).(*scip.SymbolInformation)
+		stored.Documentation = nil
+		if documentation := strings.Join(info.Documentation, "\n"); documentation != "" {
+			stored.Documentation = []string{documentation}
+		}
+		stored.Relationships = nil
+		for _, rel := range info.Relationships {
+			if !scip.IsLocalSymbol(rel.Symbol) {
+				stored.Relationships = append(stored.Relationships, rel)
+			}
+		}
+		return stored
+	}
+
+	seenPaths := map[string]bool{}
+	firstInfo := map[string]*scip.SymbolInformation{}
+	for _, doc := range index.Documents {
+		if seenPaths[doc.RelativePath] {
+			continue
+		}
+		seenPaths[doc.RelativePath] = true
+		doc = scip.CanonicalizeDocument(proto.Clone(doc).(*scip.Document))
+
+		var symbols []*scip.SymbolInformation
+		for _, info := range doc.Symbols {
+			if scip.IsLocalSymbol(info.Symbol) {
+				continue
+			}
+			if _, ok := firstInfo[info.Symbol]; !ok {
+				firstInfo[info.Symbol] = stored(info)
+			}
+			symbols = append(symbols, firstInfo[info.Symbol])
+		}
+		doc.Symbols = symbols
+		expected.Documents = append(expected.Documents, doc)
+	}
+
+	if !importExternalSymbols {
+		return expected
+	}
+	// SymbolInformation from documents takes precedence over external
+	// symbols, and the first of several external symbols wins.
+	for _, info := range index.ExternalSymbols {
+		if _, ok := firstInfo[info.Symbol]; ok || scip.IsLocalSymbol(info.Symbol) {
+			continue
+		}
+		firstInfo[info.Symbol] = stored(scip.CanonicalizeSymbol(proto.Clone(info).(*scip.SymbolInformation)))
+		expected.ExternalSymbols = append(expected.ExternalSymbols, firstInfo[info.Symbol])
+	}
+	slices.SortFunc(expected.ExternalSymbols, func(a, b *scip.SymbolInformation) int {
+		return cmp.Compare(a.Symbol, b.Symbol)
+	})
+	return expected
+}
+
+var convertTestSymbols = []string{
+	"scip-go go . . pkg/A#",
+	"scip-go go . . pkg/A#m().",
+	"scip-go go . . pkg/B#",
+	"local 0",
+	"local 1",
+}
+
+func genConvertRange() *rapid.Generator[[]int32] {
+	return rapid.Custom(func(t *rapid.T) []int32 {
+		startLine := rapid.Int32Range(0, 20).Draw(t, "startLine")
+		startChar := rapid.Int32Range(0, 20).Draw(t, "startChar")
+		if rapid.Bool().Draw(t, "multiline") {
+			endLine := startLine + rapid.Int32Range(1, 3).Draw(t, "lineCount")
+			return []int32{startLine, startChar, endLine, rapid.Int32Range(0, 20).Draw(t, "endChar")}
+		}
+		return []int32{startLine, startChar, startChar + rapid.Int32Range(0, 10).Draw(t, "length")}
+	})
+}
+
+func genConvertOccurrence() *rapid.Generator[*scip.Occurrence] {
+	return rapid.Custom(func(t *rapid.T) *scip.Occurrence {
+		occ := &scip.Occurrence{
+			Range:  genConvertRange().Draw(t, "range"),
+			Symbol: rapid.SampledFrom(convertTestSymbols).Draw(t, "symbol"),
+			SymbolRoles: rapid.SampledFrom([]int32{
+				0, int32(scip.SymbolRole_Definition), int32(scip.SymbolRole_ReadAccess),
+			}).Draw(t, "symbolRoles"),
+		}
+		if rapid.Bool().Draw(t, "hasEnclosingRange") {
+			occ.EnclosingRange = genConvertRange().Draw(t, "enclosingRange")
+		}
+		if rapid.Bool().Draw(t, "hasDiagnostic") {
+			occ.Diagnostics = []*scip.Diagnostic{{
+				Severity: scip.Severity_Warning,
+				Message:  rapid.SampledFrom([]string{"unused", "deprecated"}).Draw(t, "message"),
+			}}
+		}
+		return occ
+	})
+}
+
+func genConvertSymbolInfo(symbol string) *rapid.Generator[*scip.SymbolInformation] {
+	return rapid.Custom(func(t *rapid.T) *scip.SymbolInformation {
+		info := &scip.SymbolInformation{
+			Symbol:          symbol,
+			DisplayName:     rapid.SampledFrom([]string{"", "A", "m"}).Draw(t, "displayName"),
+			Kind:            rapid.SampledFrom([]scip.SymbolInformation_Kind{0, scip.SymbolInformation_Class, scip.SymbolInformation_Method}).Draw(t, "kind"),
+			Documentation:   rapid.SliceOfN(rapid.SampledFrom([]string{"", "docs", "more docs"}), 0, 2).Draw(t, "documentation"),
+			EnclosingSymbol: rapid.SampledFrom([]string{"", convertTestSymbols[0]}).Draw(t, "enclosingSymbol"),
+		}
+		if rapid.Bool().Draw(t, "hasSignature") {
+			info.SignatureDocumentation = &scip.Document{Language: "go", Text: "func m()"}
+		}
+		info.Relationships = rapid.SliceOfN(genConvertRelationship(), 0, 2).Draw(t, "relationships")
+		return info
+	})
+}
+
+func genConvertRelationship() *rapid.Generator[*scip.Relationship] {
+	return rapid.Custom(func(t *rapid.T) *scip.Relationship {
+		return &scip.Relationship{
+			Symbol:           rapid.SampledFrom(convertTestSymbols).Draw(t, "symbol"),
+			IsReference:      rapid.Bool().Draw(t, "isReference"),
+			IsImplementation: rapid.Bool().Draw(t, "isImplementation"),
+			IsTypeDefinition: rapid.Bool().Draw(t, "isTypeDefinition"),
+			IsDefinition:     rapid.Bool().Draw(t, "isDefinition"),
+		}
+	})
+}
+
+func genConvertMetadata() *rapid.Generator[*scip.Metadata] {
+	return rapid.Custom(func(t *rapid.T) *scip.Metadata {
+		if rapid.Bool().Draw(t, "noMetadata") {
+			return nil
+		}
+		metadata := &scip.Metadata{
+			ProjectRoot: rapid.SampledFrom([]string{"", "file:///repo"}).Draw(t, "projectRoot"),
+			TextDocumentEncoding: rapid.SampledFrom([]scip.TextEncoding{
+				scip.TextEncoding_UnspecifiedTextEncoding,
+				scip.TextEncoding_UTF8,
+				scip.TextEncoding_UTF16,
+			}).Draw(t, "textDocumentEncoding"),
+		}
+		if rapid.Bool().Draw(t, "toolInfo") {
+			metadata.ToolInfo = &scip.ToolInfo{
+				Name:      rapid.SampledFrom([]string{"", "scip-go"}).Draw(t, "toolName"),
+				Version:   rapid.SampledFrom([]string{"", "v0.1.0"}).Draw(t, "toolVersion"),
+				Arguments: rapid.SliceOfN(rapid.SampledFrom([]string{"--quiet", "./..."}), 0, 2).Draw(t, "toolArguments"),
+			}
+		}
+		return metadata
+	})
+}
+
+func genConvertExternalSymbol() *rapid.Generator[*scip.SymbolInformation] {
+	return rapid.Custom(func(t *rapid.T) *scip.SymbolInformation {
+		symbol := rapid.SampledFrom(append([]string{"scip-go go dep v1 dep/E#"}, convertTestSymbols...)).Draw(t, "symbol")
+		return genConvertSymbolInfo(symbol).Draw(t, "info")
+	})
+}
+
+func genConvertDocument() *rapid.Generator[*scip.Document] {
+	return rapid.Custom(func(t *rapid.T) *scip.Document {
+		doc := &scip.Document{
+			RelativePath: rapid.SampledFrom([]string{"a.go", "b.go", "c/d.go"}).Draw(t, "relativePath"),
+			Language:     rapid.SampledFrom([]string{"", "go"}).Draw(t, "language"),
+			PositionEncoding: rapid.SampledFrom([]scip.PositionEncoding{
+				scip.PositionEncoding_UnspecifiedPositionEncoding,
+				scip.PositionEncoding_UTF8CodeUnitOffsetFromLineStart,
+				scip.PositionEncoding_UTF16CodeUnitOffsetFromLineStart,
+				scip.PositionEncoding_UTF32CodeUnitOffsetFromLineStart,
+			}).Draw(t, "positionEncoding"),
+			Text:        rapid.SampledFrom([]string{"", "package a"}).Draw(t, "text"),
+			Occurrences: rapid.SliceOfN(genConvertOccurrence(), 0, 10).Draw(t, "occurrences"),
+		}
+		symbols := rapid.SliceOfN(rapid.SampledFrom(convertTestSymbols), 0, 4).Draw(t, "symbols")
+		// Definitions with an enclosing range must have SymbolInformation.
+		for _, occ := range doc.Occurrences {
+			if scip.SymbolRole_Definition.Matches(occ) && len(occ.EnclosingRange) > 0 {
+				symbols = append(symbols, occ.Symbol)
+			}
+		}
+		for _, symbol := range symbols {
+			doc.Symbols = append(doc.Symbols, genConvertSymbolInfo(symbol).Draw(t, "symbol"))
+		}
+		return doc
+	})
+}
+
+// TestConvert_RoundTripText checks that the text of documents is kept even
+// if they have no occurrences, and so no chunks, which rapid once found.
+func TestConvert_RoundTripText(t *testing.T) {
+	index := &scip.Index{Documents: []*scip.Document{
+		{RelativePath: "a.go", Text: "x"},
+		{RelativePath: "b.go"},
+	}}
+	dir := t.TempDir()
+	sqliteDBPath := filepath.Join(dir, "index.db")
+	db, err := createSQLiteDatabase(sqliteDBPath)
+	require.NoError(t, err)
+	require.NoError(t, NewConverter(db, chunkSizeHint).Convert(index))
+	require.NoError(t, prepareIndexes(db))
+	require.NoError(t, db.Close())
+
+	scipPath := filepath.Join(dir, "index.scip")
+	require.NoError(t, reverseConvertMain(sqliteDBPath, scipPath, 0))
+	got, err := readFromOption(scipPath)
+	require.NoError(t, err)
+	if diff := gocmp.Diff(expectedRoundTrip(index, false), got, protocmp.Transform()); diff != "" {
+		t.Fatalf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestConvert_MissingDefinitionInfo(t *testing.T) {
+	sym := "scip-go go . . pkg1/S1#"
+	definition := &scip.Document{
+		RelativePath: "a.go",
+		Occurrences: []*scip.Occurrence{{
+			Symbol: sym, Range: []int32{1, 5, 7}, EnclosingRange: []int32{1, 0, 3, 1},
+			SymbolRoles: int32(scip.SymbolRole_Definition),
+		}},
+	}
+	convert := func(docs ...*scip.Document) error {
+		db, err := createSQLiteDatabase(filepath.Join(t.TempDir(), "index.db"))
+		require.NoError(t, err)
+		defer func() { require.NoError(t, db.Close()) }()
+		return NewConverter(db, chunkSizeHint).Convert(&scip.Index{Documents: docs})
+	}
+
+	require.ErrorContains(t, convert(proto.Clone(definition).(*scip.Document)),
+		`symbol "scip-go go . . pkg1/S1#" has definition occurrence, but no SymbolInformation`)
+	// The SymbolInformation may come from a later document.
+	require.NoError(t, convert(proto.Clone(definition).(*scip.Document), &scip.Document{
+		RelativePath: "b.go",
+		Symbols:      []*scip.SymbolInformation{{Symbol: sym}},
+	}))
+}
+
+func TestConvert_ChunkByDefinitions(t *testing.T) {
+	definition := func(symbol string, line int32, enclosingRange []int32) *scip.Occurrence {
+		return &scip.Occurrence{
+			Symbol: symbol, Range: []int32{line, 5, 7}, EnclosingRange: enclosingRange,
+			SymbolRoles: int32(scip.SymbolRole_Definition),
+		}
+	}
+	reference := func(symbol string, line int32) *scip.Occurrence {
+		return &scip.Occurrence{Symbol: symbol, Range: []int32{line, 1, 2}}
+	}
+	occurrences := []*scip.Occurrence{
+		reference("scip-go go . . pkg1/", 0),
+		definition("scip-go go . . pkg1/F().", 2, []int32{1, 0, 5, 1}),
+		reference("scip-go go . . pkg1/G().", 3),
+		reference("local 0", 4),
+		// Single-line definitions don't start a chunk.
+		definition("scip-go go . . pkg1/C.", 6, []int32{6, 0, 12}),
+		definition("scip-go go . . pkg1/S#", 7, []int32{7, 0, 13, 1}),
+		definition("local 1", 8, []int32{8, 0, 10, 1}),
+		reference("scip-go go . . pkg1/G().", 9),
+		reference("scip-go go . . pkg1/G().", 9),
+		reference("scip-go go . . pkg1/G().", 11),
+		reference("scip-go go . . pkg1/G().", 12),
+		reference("scip-go go . . pkg1/G().", 20),
+	}
+	lines := func(chunks []Chunk) [][2]int32 {
+		var lines [][2]int32
+		for _, chunk := range chunks {
+			lines = append(lines, [2]int32{chunk.StartLine, chunk.EndLine})
+		}
+		return lines
+	}
+	require.Equal(t, [][2]int32{{0, 0}, {2, 4}, {6, 6}, {7, 12}, {20, 20}},
+		lines(chunkOccurrencesByDefinitions(occurrences, chunkSizeHint)))
+	// Large definitions are split further.
+	require.Equal(t, [][2]int32{{0, 0}, {2, 3}, {4, 4}, {6, 6}, {7, 8}, {9, 9}, {11, 12}, {20, 20}},
+		lines(chunkOccurrencesByDefinitions(occurrences, 2)))
+}
+
+func TestConvert_PipelineError(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	index := &scip.Index{}
+	for i := range 50 {
+		doc := &scip.Document{
+			RelativePath: fmt.Sprintf("file%d.go", i),
+			Occurrences:  []*scip.Occurrence{{Symbol: "local 0", Range: []int32{0, 0, 1}}},
+		}
+		if i == 20 {
+			doc.RelativePath = ""
+		}
+		index.Documents = append(index.Documents, doc)
+	}
+	indexBytes, err := proto.Marshal(index)
+	require.NoError(t, err)
+
+	converter := NewConverter(db, chunkSizeHint)
+	converter.jobs = 4
+	err = converter.ConvertStreaming(context.Background(), bytes.NewReader(indexBytes))
+	require.ErrorContains(t, err, "document at index 20: relative path must not be empty")
+	// Documents written before the error are rolled back.
+	var count int64
+	require.NoError(t, sqlitex.ExecuteTransient(db, `SELECT count(*) FROM documents`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			count = stmt.ColumnInt64(0)
+			return nil
+		},
+	}))
+	require.Zero(t, count)
+}
+
+func TestPrepareIndexes_Error(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+	// The index on local_mentions is created last.
+	require.NoError(t, executeAll(db, []string{`DROP TABLE local_mentions;`}))
+
+	require.ErrorContains(t, prepareIndexes(db), "no such table: main.local_mentions")
+	// The indexes created before the error are rolled back.
+	var count int64
+	require.NoError(t, sqlitex.ExecuteTransient(db, `SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name LIKE 'idx_%'`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				count = stmt.ColumnInt64(0)
+				return nil
+			},
+		}))
+	require.Zero(t, count)
+}
+
+var convertMemtestDocs = flag.Int("convert-memtest-docs", 0,
+	"number of ~2MB documents in the index converted by TestConvert_BoundedMemory")
+
+// TestConvert_BoundedMemory checks that the peak heap size while converting
+// an index doesn't depend on the size of the index. It only runs with
+// -convert-memtest-docs, for example =100 (about 200 MB), or =1500 (about
+// 3 GB) for a multi-GB index.
+func TestConvert_BoundedMemory(t *testing.T) {
+	if *convertMemtestDocs <= 0 {
+		t.Skip("skipping conversion of a large index without -convert-memtest-docs")
+	}
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "large.scip")
+
+	// Concatenated Index messages parse as a single Index, so the index can
+	// be written one document at a time.
+	const symbolsPerDoc = 500
+	indexFile, err := os.Create(indexPath)
+	require.NoError(t, err)
+	text := strings.Repeat("x", 2*1024*1024)
+	for i := 0; i < *convertMemtestDocs; i++ {
+		doc := &scip.Document{RelativePath: fmt.Sprintf("src/file%d.go", i), Text: text}
+		for j := int32(0); j < symbolsPerDoc; j++ {
+			sym := fmt.Sprintf("scip-go gomod example v1 pkg%d/Func%d().", i, j)
+			doc.Occurrences = append(doc.Occurrences, &scip.Occurrence{
+				Symbol: sym, Range: []int32{j, 5, 10}, EnclosingRange: []int32{j, 0, j, 20},
+				SymbolRoles: int32(scip.SymbolRole_Definition),
+			})
+			doc.Symbols = append(doc.Symbols, &scip.SymbolInformation{Symbol: sym, DisplayName: fmt.Sprintf("Func%d", j)})
+		}
+		data, err := proto.Marshal(&scip.Index{Documents: []*scip.Document{doc}})
+		require.NoError(t, err)
+		_, err = indexFile.Write(data)
+		require.NoError(t, err)
+	}
+	info, err := indexFile.Stat()
+	require.NoError(t, err)
+	require.NoError(t, indexFile.Close())
+
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			runtime.GC()
+			var peak uint64
+			done := make(chan struct{})
+			sampled := make(chan struct{})
+			go func() {
+				defer close(sampled)
+				var stats runtime.MemStats
+				for {
+					runtime.ReadMemStats(&stats)
+					peak = max(peak, stats.HeapInuse)
+					select {
+					case <-done:
+						return
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+			}()
+			flags := convertFlags{output: filepath.Join(t.TempDir(), "large.db"), chunkSize: chunkSizeHint, jobs: jobs}
+			err := convertMain(indexPath, flags, io.Discard)
+			close(done)
+			<-sampled
+			require.NoError(t, err)
+
+			// Each additional job keeps a few more documents in memory, which
+			// is about 8 MB each for this index.
+			maxPeak := uint64(64+16*(jobs-1)) * 1024 * 1024
+			t.Logf("index size: %d MB, peak heap in use: %d MB", info.Size()>>20, peak>>20)
+			require.Less(t, peak, maxPeak, "peak heap in use should not depend on the index size")
+		})
+	}
+}
+
+// BenchmarkConvert_ChunkStrategy compares the chunking strategies on the
+// SCIP indexes in dev/sample_indexes (see Development.md). It reports the
+// size of the database, and measures finding the symbol at a position and
+// all its occurrences, which decompresses the chunks containing the
+// position and mentioning the symbol.
+//
+//	go test ./cmd/scip -run '^$' -bench ChunkStrategy
+func BenchmarkConvert_ChunkStrategy(b *testing.B) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "dev", "sample_indexes", "*.scip"))
+	require.NoError(b, err)
+	if len(paths) == 0 {
+		b.Skip("no SCIP indexes in dev/sample_indexes")
+	}
+	for _, indexPath := range paths {
+		index, err := readFromOption(indexPath)
+		require.NoError(b, err)
+		targets := sampleQueryTargets(index, 1000)
+		require.NotEmpty(b, targets, "index %s has no occurrences of global symbols", indexPath)
+
+		for _, strategy := range []string{chunkByLines, chunkByDefinitions} {
+			dbPath := filepath.Join(b.TempDir(), "index.db")
+			flags := convertFlags{output: dbPath, chunkSize: chunkSizeHint, chunkStrategy: strategy}
+			require.NoError(b, convertMain(indexPath, flags, io.Discard))
+			info, err := os.Stat(dbPath)
+			require.NoError(b, err)
+
+			b.Run(filepath.Base(indexPath)+"/"+strategy, func(b *testing.B) {
+				err := withQueryDB(queryOptions{dbPath: dbPath}, func(q *queryDB) error {
+					b.ResetTimer()
+					for i := range b.N {
+						target := targets[i%len(targets)]
+						symbol, err := q.resolve(target)
+						if err != nil {
+							return err
+						}
+						if _, err = q.occurrences(symbol, target.Path, 0); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				require.NoError(b, err)
+				b.ReportMetric(float64(info.Size())/(1<<20), "db-MB")
+			})
+		}
+	}
+}
+
+// sampleQueryTargets returns the positions of up to n occurrences of global
+// symbols, spread evenly over the index.
+func sampleQueryTargets(index *scip.Index, n int) []queryTarget {
+	var targets []queryTarget
+	seenPaths := map[string]bool{}
+	for _, doc := range index.Documents {
+		// Duplicate documents are not converted.
+		if seenPaths[doc.RelativePath] {
+			continue
+		}
+		seenPaths[doc.RelativePath] = true
+		for _, occ := range doc.Occurrences {
+			if occ.Symbol == "" || scip.IsLocalSymbol(occ.Symbol) {
+				continue
+			}
+			r := scip.NewRangeUnchecked(occ.Range)
+			targets = append(targets, queryTarget{Path: doc.RelativePath, Line: r.Start.Line, Character: r.Start.Character})
+		}
+	}
+	if len(targets) <= n {
+		return targets
+	}
+	sampled := make([]queryTarget, 0, n)
+	for i := range n {
+		sampled = append(sampled, targets[i*len(targets)/n])
+	}
+	return sampled
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"cmp"
 	stderrors "errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 
@@ -11,30 +13,137 @@ import (
 	"github.com/sourcegraph/scip/bindings/go/scip"
 )
 
+// lintOptions are the command-line options of 'scip lint'.
+type lintOptions struct {
+	format     string
+	configPath string
+	// enable and disable replace the corresponding lists of the config if
+	// they're set.
+	enable, disable []string
+	// baselinePath overrides the baseline of the config.
+	baselinePath  string
+	writeBaseline bool
+}
+
 func lintCommand() cli.Command {
+	var opts lintOptions
+	var enable, disable cli.StringSlice
 	snapshot := cli.Command{
 		Name:  "lint",
 		Usage: "Flag potential issues with a SCIP index",
 		Description: "Example usage:\n\n  scip lint /path/to/index.scip\n\n" +
-			"You may want to filter the output using `grep -v <pattern>`\n" +
-			"to narrow down on certain classes of errors.",
+			"Rules can be turned off with --disable, or selected with --enable.\n" +
+			"They can also be configured in .scip-lint.yaml in the current\n" +
+			"directory, where the command-line flags take precedence:\n\n" +
+			"  disable: [duplicate-occurrence]\n" +
+			"  suppress:\n" +
+			"    # Documents matching the glob, where ** matches any number of\n" +
+			"    # directories. Without rules, all rules are suppressed.\n" +
+			"    - path: \"gen/**\"\n" +
+			"      rules: [multiple-relationships]\n" +
+			"  baseline: scip-lint-baseline.json\n\n" +
+			"Problems in the baseline, which is written with --write-baseline,\n" +
+			"aren't reported, so that only new problems are. Problems are\n" +
+			"matched by rule, path and message, except for problems with\n" +
+			"occurrences, which are matched by rule, path and symbol so that\n" +
+			"they're still matched when the occurrences move. Each problem in\n" +
+			"the baseline matches a single problem.\n\n" +
+			"With --format json or --format sarif, the problems are written to\n" +
+			"stdout with the ID of the rule which found them, and the path and\n" +
+			"range of the document they were found in. Problems which aren't in\n" +
+			"a document, such as problems with external symbols, are left out\n" +
+			"of the SARIF output, as code-scanning tools require a location.\n" +
+			"The rule IDs are stable:\n\n" +
+			lintRulesHelp(),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "format",
+				Usage:       "Output format: " + lintFormatText + ", " + lintFormatJSON + " or " + lintFormatSARIF,
+				Destination: &opts.format,
+				Value:       lintFormatText,
+			},
+			&cli.StringSliceFlag{
+				Name:        "enable",
+				Usage:       "Only report problems found by these rules. Can be specified multiple times.",
+				Destination: &enable,
+			},
+			&cli.StringSliceFlag{
+				Name:        "disable",
+				Usage:       "Don't report problems found by these rules. Can be specified multiple times.",
+				Destination: &disable,
+			},
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "Path to the lint config file (default: " + defaultLintConfigPath + " if it exists)",
+				Destination: &opts.configPath,
+			},
+			&cli.StringFlag{
+				Name:        "baseline",
+				Usage:       "Path to a baseline file of known problems, overriding the one in the config",
+				Destination: &opts.baselinePath,
+			},
+			&cli.BoolFlag{
+				Name:        "write-baseline",
+				Usage:       "Write the problems found to the baseline file instead of reporting them",
+				Destination: &opts.writeBaseline,
+			},
+		},
 		Action: func(c *cli.Context) error {
 			indexPath := c.Args().Get(0)
 			if indexPath == "" {
 				return stderrors.New("missing argument for path to SCIP index")
 			}
-			return lintMain(indexPath)
+			opts.enable = enable.Value()
+			opts.disable = disable.Value()
+			return lintMain(indexPath, opts, c.App.Writer)
 		},
 	}
 	return snapshot
 }
 
-func lintMain(indexPath string) error {
+func lintMain(indexPath string, opts lintOptions, out io.Writer) error {
+	switch opts.format {
+	case lintFormatText, lintFormatJSON, lintFormatSARIF:
+	default:
+		return fmt.Errorf("unknown format %q, expected %q, %q or %q", opts.format, lintFormatText, lintFormatJSON, lintFormatSARIF)
+	}
+	config, err := loadLintConfig(cmp.Or(opts.configPath, defaultLintConfigPath), opts.configPath != "")
+	if err != nil {
+		return err
+	}
+	filter, err := newLintFilter(config, opts.enable, opts.disable)
+	if err != nil {
+		return err
+	}
+	baselinePath := cmp.Or(opts.baselinePath, config.Baseline)
+	if opts.writeBaseline && baselinePath == "" {
+		return stderrors.New("--write-baseline requires --baseline or a baseline in the lint config")
+	}
+	if baselinePath != "" && !opts.writeBaseline {
+		if err := filter.loadBaseline(baselinePath); err != nil {
+			return err
+		}
+	}
 	scipIndex, err := readFromOption(indexPath)
 	if err != nil {
 		return err
 	}
-	return stderrors.Join(lintMainPure(scipIndex).data...)
+	allErrs := lintMainPure(scipIndex)
+	errs := allErrs.filter(filter)
+	if opts.writeBaseline {
+		return writeLintBaseline(baselinePath, errs.problems(), out)
+	}
+	if opts.format == lintFormatText {
+		return stderrors.Join(errs.data...)
+	}
+	problems := errs.problems()
+	if err := writeLintReport(out, opts.format, problems); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	return nil
 }
 
 func lintMainPure(scipIndex *scip.Index) errorSet {
@@ -60,7 +169,7 @@ func lintMainPure(scipIndex *scip.Index) errorSet {
 			continue
 		}
 		if _, ok := docMap[doc.RelativePath]; ok {
-			errs.Add(duplicateDocumentWarning{path: doc.RelativePath})
+			errs.AddAt(duplicateDocumentWarning{path: doc.RelativePath}, doc.RelativePath, nil)
 			errs.Add(note{"out of documents with identical paths, all but one will be skipped for diagnostics"})
 		} else {
 			docMap[doc.RelativePath] = doc
@@ -70,14 +179,14 @@ func lintMainPure(scipIndex *scip.Index) errorSet {
 	for path, doc := range docMap {
 		for _, sym := range doc.Symbols {
 			if err := symTable.addFileForSymbol(sym.Symbol, path); err != nil {
-				errs.Add(err)
+				errs.AddAt(err, path, nil)
 			}
 		}
 		for _, sym := range doc.Symbols {
 			for _, rel := range sym.Relationships {
 				// This has to run in a second pass so that all symbols are first populated.
 				if err := symTable.addRelationship(sym.Symbol, path, rel); err != nil {
-					errs.Add(err)
+					errs.AddAt(err, path, nil)
 				}
 			}
 		}
@@ -94,7 +203,7 @@ func lintMainPure(scipIndex *scip.Index) errorSet {
 	for path, doc := range docMap {
 		for _, occ := range doc.Occurrences {
 			if err := symTable.addOccurrence(path, occ); err != nil {
-				errs.Add(err)
+				errs.AddAtOccurrence(err, path, occ)
 			}
 		}
 	}
@@ -249,7 +358,7 @@ func lintSymbolString(symbol string, context string) error {
 		if SkipLintSymbolParseTest {
 			return nil
 		}
-		return err
+		return invalidSymbolError{err}
 	}
 	formatted := scip.VerboseSymbolFormatter.FormatSymbol(sym)
 	if symbol != formatted {
@@ -264,6 +373,91 @@ func scipRangeToString(r scip.Range) string {
 	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
 }
 
+// --- Lint rules ---
+
+type lintSeverity string
+
+const (
+	lintSeverityError   lintSeverity = "error"
+	lintSeverityWarning lintSeverity = "warning"
+)
+
+// lintRule is a class of problems found by lint. Rule IDs must not change,
+// as they're used for filtering problems, e.g. in code-scanning tools.
+type lintRule struct {
+	id          string
+	severity    lintSeverity
+	description string
+}
+
+const (
+	lintRuleEmptyString             = "empty-string"
+	lintRuleInvalidSymbol           = "invalid-symbol"
+	lintRuleNonCanonicalSymbol      = "non-canonical-symbol"
+	lintRuleDuplicateDocument       = "duplicate-document"
+	lintRuleDuplicateSymbolInfo     = "duplicate-symbol-info"
+	lintRuleLocalAndExternalSymbol  = "local-and-external-symbol"
+	lintRuleMissingRelationshipFlag = "missing-relationship-flag"
+	lintRuleMissingRelatedSymbol    = "missing-related-symbol"
+	lintRuleMultipleRelationships   = "multiple-relationships"
+	lintRuleMissingSymbolInfo       = "missing-symbol-info"
+	lintRuleForwardDefIsDefinition  = "forward-definition-is-definition"
+	lintRuleDuplicateOccurrence     = "duplicate-occurrence"
+)
+
+var lintRules = []lintRule{
+	{lintRuleEmptyString, lintSeverityError, "A symbol or document path is empty"},
+	{lintRuleInvalidSymbol, lintSeverityError, "A symbol can't be parsed"},
+	{lintRuleNonCanonicalSymbol, lintSeverityError, "A symbol isn't formatted canonically"},
+	{lintRuleDuplicateDocument, lintSeverityWarning, "Several documents have the same path"},
+	{lintRuleDuplicateSymbolInfo, lintSeverityWarning, "A document or the external symbols have several SymbolInformation for a symbol"},
+	{lintRuleLocalAndExternalSymbol, lintSeverityError, "A symbol has SymbolInformation in both a document and the external symbols"},
+	{lintRuleMissingRelationshipFlag, lintSeverityError, "A relationship has none of is_definition, is_reference, is_type_definition and is_implementation set"},
+	{lintRuleMissingRelatedSymbol, lintSeverityError, "A relationship is to a symbol without SymbolInformation"},
+	{lintRuleMultipleRelationships, lintSeverityWarning, "A symbol has several relationships to the same symbol"},
+	{lintRuleMissingSymbolInfo, lintSeverityError, "An occurrence is for a symbol without SymbolInformation"},
+	{lintRuleForwardDefIsDefinition, lintSeverityError, "A forward definition is also marked as a definition"},
+	{lintRuleDuplicateOccurrence, lintSeverityWarning, "A document has several occurrences with the same symbol, range and roles"},
+}
+
+func findLintRule(id string) (lintRule, bool) {
+	for _, rule := range lintRules {
+		if rule.id == id {
+			return rule, true
+		}
+	}
+	return lintRule{}, false
+}
+
+func lintRulesHelp() string {
+	var out strings.Builder
+	for _, rule := range lintRules {
+		fmt.Fprintf(&out, "  %s (%s)\n    %s\n", rule.id, rule.severity, rule.description)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// lintError is implemented by all errors and warnings found by lint, but not
+// by notes.
+type lintError interface {
+	error
+	ruleID() string
+}
+
+// locatedError is a problem found in the document at path, and at range_
+// if it's not nil.
+type locatedError struct {
+	error
+	path   string
+	range_ *scip.Range
+	// symbol is the symbol of the occurrence at range_.
+	symbol string
+}
+
+func (e locatedError) Unwrap() error {
+	return e.error
+}
+
 // --- All possible errors ---
 
 type duplicateSymbolInfoWarning struct {
@@ -274,9 +468,13 @@ type duplicateSymbolInfoWarning struct {
 
 func (e duplicateSymbolInfoWarning) Error() string {
 	if e.path == "" {
-		return fmt.Sprintf("warning: found repeated SymbolInformation for '%s' in '%s'", e.symbol, e.path)
+		return fmt.Sprintf("warning: found repeated SymbolInformation for external symbol '%s'", e.symbol)
 	}
-	return fmt.Sprintf("warning: found repeated SymbolInformation for external symbol '%s'", e.symbol)
+	return fmt.Sprintf("warning: found repeated SymbolInformation for '%s' in '%s'", e.symbol, e.path)
+}
+
+func (e duplicateSymbolInfoWarning) ruleID() string {
+	return lintRuleDuplicateSymbolInfo
 }
 
 type emptyStringError struct {
@@ -288,6 +486,10 @@ func (e emptyStringError) Error() string {
 	return fmt.Sprintf("error: found empty %s in %s", e.what, e.context)
 }
 
+func (e emptyStringError) ruleID() string {
+	return lintRuleEmptyString
+}
+
 type nonCanonicalSymbolError struct {
 	original  string
 	canonical string
@@ -298,6 +500,10 @@ func (e nonCanonicalSymbolError) Error() string {
 	return fmt.Sprintf("error: found non-canonical symbol '%s' should be formatted as '%s'", e.original, e.canonical)
 }
 
+func (e nonCanonicalSymbolError) ruleID() string {
+	return lintRuleNonCanonicalSymbol
+}
+
 type duplicateDocumentWarning struct {
 	path string
 }
@@ -306,6 +512,10 @@ func (e duplicateDocumentWarning) Error() string {
 	return fmt.Sprintf("warning: found multiple documents with path '%s' in index", e.path)
 }
 
+func (e duplicateDocumentWarning) ruleID() string {
+	return lintRuleDuplicateDocument
+}
+
 type bothLocalAndExternalSymbolError struct {
 	symbol string
 	path   string
@@ -316,6 +526,10 @@ func (e bothLocalAndExternalSymbolError) Error() string {
 		" is present in both external symbols and document '%s'", e.symbol, e.path)
 }
 
+func (e bothLocalAndExternalSymbolError) ruleID() string {
+	return lintRuleLocalAndExternalSymbol
+}
+
 type missingRelationshipFlagError struct {
 	symbol  string
 	context string
@@ -327,6 +541,10 @@ func (e missingRelationshipFlagError) Error() string {
 		" be set for symbol '%s' in %s", e.symbol, e.context)
 }
 
+func (e missingRelationshipFlagError) ruleID() string {
+	return lintRuleMissingRelationshipFlag
+}
+
 type missingSymbolInRelationshipError struct {
 	symbol                       string
 	symbolContext                string
@@ -340,6 +558,10 @@ func (e missingSymbolInRelationshipError) Error() string {
 		e.symbol, e.symbolContext, e.relatedSymbol, e.expectedRelatedSymbolContext)
 }
 
+func (e missingSymbolInRelationshipError) ruleID() string {
+	return lintRuleMissingRelatedSymbol
+}
+
 type multipleRelationshipWarning struct {
 	symbol        string
 	relatedSymbol string
@@ -350,6 +572,10 @@ func (e multipleRelationshipWarning) Error() string {
 		" '%s' to '%s', which could optimized into a single relationship", e.symbol, e.relatedSymbol)
 }
 
+func (e multipleRelationshipWarning) ruleID() string {
+	return lintRuleMultipleRelationships
+}
+
 type missingSymbolForOccurrenceError struct {
 	symbol string
 	path   string
@@ -362,6 +588,10 @@ func (e missingSymbolForOccurrenceError) Error() string {
 		" in external symbols or any document", e.path, scipRangeToString(e.occ), e.symbol)
 }
 
+func (e missingSymbolForOccurrenceError) ruleID() string {
+	return lintRuleMissingSymbolInfo
+}
+
 type forwardDefIsDefinitionError struct {
 	symbol string
 	path   string
@@ -373,6 +603,10 @@ func (e forwardDefIsDefinitionError) Error() string {
 		e.symbol, e.path, scipRangeToString(e.range_))
 }
 
+func (e forwardDefIsDefinitionError) ruleID() string {
+	return lintRuleForwardDefIsDefinition
+}
+
 type duplicateOccurrenceWarning struct {
 	symbol      string
 	path        string
@@ -385,6 +619,22 @@ func (e duplicateOccurrenceWarning) Error() string {
 		e.symbol, e.path, scipRangeToString(e.range_), e.symbolRoles)
 }
 
+func (e duplicateOccurrenceWarning) ruleID() string {
+	return lintRuleDuplicateOccurrence
+}
+
+type invalidSymbolError struct {
+	err error
+}
+
+func (e invalidSymbolError) Error() string {
+	return e.err.Error()
+}
+
+func (e invalidSymbolError) ruleID() string {
+	return lintRuleInvalidSymbol
+}
+
 type note struct {
 	message string
 }
@@ -403,6 +653,21 @@ func (e *errorSet) Add(err error) {
 	e.data = append(e.data, err)
 }
 
+// AddAt adds an error found in the document at path, and at r if it's not
+// nil.
+func (e *errorSet) AddAt(err error, path string, r *scip.Range) {
+	e.Add(locatedError{error: err, path: path, range_: r})
+}
+
+// AddAtOccurrence adds an error found at occ in the document at path.
+func (e *errorSet) AddAtOccurrence(err error, path string, occ *scip.Occurrence) {
+	located := locatedError{error: err, path: path, symbol: occ.Symbol}
+	if r, err := scip.NewRange(occ.Range); err == nil {
+		located.range_ = &r
+	}
+	e.Add(located)
+}
+
 func (e *errorSet) Unique() []error {
 	m := map[string]error{}
 	for _, e := range e.data {
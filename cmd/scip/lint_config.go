@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultLintConfigPath is read by lint if it exists and --config isn't set.
+const defaultLintConfigPath = ".scip-lint.yaml"
+
+// lintConfig is read from .scip-lint.yaml in the current directory, or from
+// the file given with --config. Every field is optional.
+//
+//	disable: [duplicate-occurrence]
+//	suppress:
+//	  - path: "gen/**"
+//	    rules: [multiple-relationships]
+//	baseline: scip-lint-baseline.json
+type lintConfig struct {
+	// Enable lists the rules to report. If it's empty, all rules are
+	// reported.
+	Enable []string `yaml:"enable"`
+	// Disable lists rules which aren't reported.
+	Disable []string `yaml:"disable"`
+	// Suppress lists rules which aren't reported in some documents.
+	Suppress []lintSuppression `yaml:"suppress"`
+	// Baseline is the path of a file with known problems, which aren't
+	// reported. Relative paths are relative to the config file.
+	Baseline string `yaml:"baseline"`
+}
+
+type lintSuppression struct {
+	// Path is a glob matching the paths of documents, in which ** matches
+	// any number of directories.
+	Path string `yaml:"path"`
+	// Rules are the suppressed rules. If it's empty, all rules are
+	// suppressed.
+	Rules []string `yaml:"rules"`
+}
+
+func loadLintConfig(configPath string, required bool) (lintConfig, error) {
+	var config lintConfig
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return config, nil
+		}
+		return config, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse lint config %s: %w", configPath, err)
+	}
+	if config.Baseline != "" && !filepath.IsAbs(config.Baseline) {
+		config.Baseline = filepath.Join(filepath.Dir(configPath), config.Baseline)
+	}
+	return config, nil
+}
+
+// lintFilter decides which problems lint reports.
+type lintFilter struct {
+	// enabled holds the IDs of the reported rules.
+	enabled  map[string]bool
+	suppress []lintSuppression
+	// baseline counts the known problems, which aren't reported.
+	baseline map[lintBaselineKey]int
+}
+
+// lintBaselineKey identifies a problem across runs of lint. Problems with
+// occurrences are identified by their symbol instead of their message, which
+// contains the range of the occurrence, so that they're still identified when
+// the occurrence moves. Several problems may have the same key, so the
+// baseline counts them.
+type lintBaselineKey struct {
+	ruleID, path, symbol, message string
+}
+
+func newLintBaselineKey(problem lintProblem) lintBaselineKey {
+	if problem.Range != nil {
+		return lintBaselineKey{ruleID: problem.RuleID, path: problem.Path, symbol: problem.Symbol}
+	}
+	return lintBaselineKey{ruleID: problem.RuleID, path: problem.Path, message: problem.Message}
+}
+
+// newLintFilter creates a filter from the rules in config. enable and
+// disable come from the command line, and replace the corresponding lists
+// of config if they're set.
+func newLintFilter(config lintConfig, enable, disable []string) (*lintFilter, error) {
+	if len(enable) == 0 {
+		enable = config.Enable
+	}
+	if len(disable) == 0 {
+		disable = config.Disable
+	}
+	f := &lintFilter{enabled: map[string]bool{}, suppress: config.Suppress}
+	if len(enable) == 0 {
+		for _, rule := range lintRules {
+			f.enabled[rule.id] = true
+		}
+	}
+	for _, id := range enable {
+		if err := checkLintRule(id); err != nil {
+			return nil, err
+		}
+		f.enabled[id] = true
+	}
+	for _, id := range disable {
+		if err := checkLintRule(id); err != nil {
+			return nil, err
+		}
+		delete(f.enabled, id)
+	}
+	for _, s := range config.Suppress {
+		if s.Path == "" {
+			return nil, stderrors.New("missing path in lint suppression")
+		}
+		if _, err := path.Match(s.Path, ""); err != nil {
+			return nil, fmt.Errorf("invalid path %q in lint suppression: %w", s.Path, err)
+		}
+		for _, id := range s.Rules {
+			if err := checkLintRule(id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+func checkLintRule(id string) error {
+	if _, ok := findLintRule(id); !ok {
+		return fmt.Errorf("unknown lint rule %q, see 'scip lint --help' for the list of rules", id)
+	}
+	return nil
+}
+
+// reports returns true if problem should be reported. Each problem in the
+// baseline hides one problem with the same key, so that problems beyond the
+// ones in the baseline are reported.
+func (f *lintFilter) reports(problem lintProblem) bool {
+	if !f.enabled[problem.RuleID] || f.suppresses(problem) {
+		return false
+	}
+	key := newLintBaselineKey(problem)
+	if f.baseline[key] > 0 {
+		f.baseline[key]--
+		return false
+	}
+	return true
+}
+
+// suppresses returns true if a suppression in the config matches problem.
+func (f *lintFilter) suppresses(problem lintProblem) bool {
+	if problem.Path == "" {
+		return false
+	}
+	for _, s := range f.suppress {
+		if !matchPathGlob(s.Path, problem.Path) {
+			continue
+		}
+		if len(s.Rules) == 0 {
+			return true
+		}
+		for _, id := range s.Rules {
+			if id == problem.RuleID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadBaseline reads a baseline written with --write-baseline, which has
+// the same format as the JSON output of lint. A missing baseline is empty,
+// so that the config can name it before it's written.
+func (f *lintFilter) loadBaseline(baselinePath string) error {
+	data, err := os.ReadFile(baselinePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read lint baseline: %w", err)
+	}
+	var problems []lintProblem
+	if err := json.Unmarshal(data, &problems); err != nil {
+		return fmt.Errorf("failed to parse lint baseline %s: %w", baselinePath, err)
+	}
+	f.baseline = map[lintBaselineKey]int{}
+	for _, problem := range problems {
+		f.baseline[newLintBaselineKey(problem)]++
+	}
+	return nil
+}
+
+// writeLintBaseline writes problems to the baseline file at baselinePath.
+func writeLintBaseline(baselinePath string, problems []lintProblem, out io.Writer) error {
+	var buf bytes.Buffer
+	if err := writeLintReport(&buf, lintFormatJSON, problems); err != nil {
+		return err
+	}
+	if err := os.WriteFile(baselinePath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write lint baseline: %w", err)
+	}
+	_, err := fmt.Fprintf(out, "Wrote %d problems to %s\n", len(problems), baselinePath)
+	return err
+}
+
+// filter returns the errors of the set which f reports. Notes are kept if
+// the problem before them, which they explain, is kept. Repeated errors are
+// only checked once, as the baseline only has unique problems.
+func (e *errorSet) filter(f *lintFilter) errorSet {
+	var out errorSet
+	reported := false
+	decided := map[string]bool{}
+	for _, err := range e.data {
+		problem, ok := newLintProblem(err)
+		if !ok {
+			if reported {
+				out.Add(err)
+			}
+			continue
+		}
+		var seen bool
+		if reported, seen = decided[err.Error()]; !seen {
+			reported = f.reports(problem)
+			decided[err.Error()] = reported
+		}
+		if reported {
+			out.Add(err)
+		}
+	}
+	return out
+}
+
+// matchPathGlob is like path.Match, except that a ** segment in pattern
+// matches any number of segments of name.
+func matchPathGlob(pattern, name string) bool {
+	return matchPathSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchPathSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchPathSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Output formats of 'scip lint'.
+const (
+	lintFormatText  = "text"
+	lintFormatJSON  = "json"
+	lintFormatSARIF = "sarif"
+)
+
+// lintProblem is an error or warning in the JSON output of lint.
+type lintProblem struct {
+	RuleID   string       `json:"ruleId"`
+	Severity lintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+	// Path is empty for problems which aren't in a document, such as
+	// problems with external symbols.
+	Path string `json:"path,omitempty"`
+	// Range is [startLine, startCharacter, endLine, endCharacter], with
+	// 0-based lines and characters like in SCIP. It's only set for problems
+	// with occurrences.
+	Range []int32 `json:"range,omitempty"`
+	// Symbol is the symbol of the occurrence of problems with occurrences.
+	Symbol string `json:"symbol,omitempty"`
+}
+
+// problems returns the unique errors and warnings in the set, without
+// notes, which only explain the text output.
+func (e *errorSet) problems() []lintProblem {
+	problems := []lintProblem{}
+	for _, err := range e.Unique() {
+		if problem, ok := newLintProblem(err); ok {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// newLintProblem returns the problem for err, or false if err is a note.
+func newLintProblem(err error) (lintProblem, bool) {
+	var lintErr lintError
+	if !stderrors.As(err, &lintErr) {
+		return lintProblem{}, false
+	}
+	rule, ok := findLintRule(lintErr.ruleID())
+	if !ok {
+		panic(fmt.Sprintf("missing lint rule %q", lintErr.ruleID()))
+	}
+	problem := lintProblem{
+		RuleID:   rule.id,
+		Severity: rule.severity,
+		Message:  strings.TrimPrefix(lintErr.Error(), string(rule.severity)+": "),
+	}
+	var located locatedError
+	if stderrors.As(err, &located) {
+		problem.Path = located.path
+		if r := located.range_; r != nil {
+			problem.Range = []int32{r.Start.Line, r.Start.Character, r.End.Line, r.End.Character}
+		}
+		problem.Symbol = located.symbol
+	}
+	return problem, true
+}
+
+func writeLintReport(out io.Writer, format string, problems []lintProblem) error {
+	var report any = problems
+	if format == lintFormatSARIF {
+		report = newSARIFLog(problems)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// The types below are the subset of SARIF 2.1.0 used by lint, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	DefaultConfiguration sarifRuleConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifRuleConfiguration struct {
+	Level lintSeverity `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     lintSeverity    `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+// sarifRegion has 1-based lines and columns, unlike SCIP.
+type sarifRegion struct {
+	StartLine   int32 `json:"startLine"`
+	StartColumn int32 `json:"startColumn"`
+	EndLine     int32 `json:"endLine"`
+	EndColumn   int32 `json:"endColumn"`
+}
+
+// newSARIFLog returns the SARIF log of problems. Problems which aren't in a
+// document are left out, as code-scanning tools such as GitHub's reject
+// results without a location.
+func newSARIFLog(problems []lintProblem) sarifLog {
+	driver := sarifDriver{
+		Name:           "scip lint",
+		InformationURI: "https://github.com/sourcegraph/scip",
+		Version:        strings.TrimSpace(version),
+	}
+	ruleIndex := map[string]int{}
+	for i, rule := range lintRules {
+		ruleIndex[rule.id] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.id,
+			ShortDescription:     sarifMessage{rule.description},
+			DefaultConfiguration: sarifRuleConfiguration{rule.severity},
+		})
+	}
+	results := []sarifResult{}
+	for _, problem := range problems {
+		if problem.Path == "" {
+			continue
+		}
+		// Paths are relative to the project root, which is the checkout for
+		// code-scanning tools.
+		location := sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: problem.Path, URIBaseID: "%SRCROOT%"},
+		}
+		if r := problem.Range; r != nil {
+			location.Region = &sarifRegion{
+				StartLine: r[0] + 1, StartColumn: r[1] + 1,
+				EndLine: r[2] + 1, EndColumn: r[3] + 1,
+			}
+		}
+		results = append(results, sarifResult{
+			RuleID:    problem.RuleID,
+			RuleIndex: ruleIndex[problem.RuleID],
+			Level:     problem.Severity,
+			Message:   sarifMessage{problem.Message},
+			Locations: []sarifLocation{{location}},
+		})
+	}
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{driver}, Results: results}},
+	}
+}
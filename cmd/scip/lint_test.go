@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
 	"github.com/sourcegraph/scip/bindings/go/scip"
 )
 
@@ -199,6 +207,15 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+// TestErrors compares messages with the Error methods, so this checks that
+// the symbol and the path are in the right place.
+func TestDuplicateSymbolInfoWarningMessage(t *testing.T) {
+	require.Equal(t, "warning: found repeated SymbolInformation for 'dupSym' in 'myfile'",
+		duplicateSymbolInfoWarning{symbol: "dupSym", path: "myfile"}.Error())
+	require.Equal(t, "warning: found repeated SymbolInformation for external symbol 'dupSym'",
+		duplicateSymbolInfoWarning{symbol: "dupSym"}.Error())
+}
+
 func errorMessages(e errorSet) set[string] {
 	out := newSet[string]()
 	for _, e := range e.data {
@@ -206,3 +223,219 @@ func errorMessages(e errorSet) set[string] {
 	}
 	return out
 }
+
+func TestLintRules(t *testing.T) {
+	ids := newSet[string]()
+	for _, rule := range lintRules {
+		if !ids.Add(rule.id) {
+			t.Errorf("duplicate lint rule ID %s", rule.id)
+		}
+	}
+	errs := []lintError{
+		duplicateSymbolInfoWarning{}, emptyStringError{}, nonCanonicalSymbolError{}, duplicateDocumentWarning{},
+		bothLocalAndExternalSymbolError{}, missingRelationshipFlagError{}, missingSymbolInRelationshipError{},
+		multipleRelationshipWarning{}, missingSymbolForOccurrenceError{}, forwardDefIsDefinitionError{},
+		duplicateOccurrenceWarning{}, invalidSymbolError{fmt.Errorf("failed to parse")},
+	}
+	for _, err := range errs {
+		rule, ok := findLintRule(err.ruleID())
+		if !ok {
+			t.Errorf("%T has unknown rule ID %s", err, err.ruleID())
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), string(rule.severity)+": ") && rule.id != lintRuleInvalidSymbol {
+			t.Errorf("%T doesn't have the severity %s of rule %s", err, rule.severity, rule.id)
+		}
+	}
+}
+
+func TestLintReport(t *testing.T) {
+	SkipLintSymbolParseTest = true
+	index := makeIndex([]string{"b~c#r", "b~c#d"}, stringMap{"f": {"d"}}, stringMap{"f": {"a", "d", "d"}})
+	index.Documents = append(index.Documents, &scip.Document{RelativePath: "f"})
+	errs := lintMainPure(index)
+	problems := errs.problems()
+
+	var out bytes.Buffer
+	require.NoError(t, writeLintReport(&out, lintFormatJSON, problems))
+	autogold.Expect(`[
+  {
+    "ruleId": "missing-symbol-info",
+    "severity": "error",
+    "message": "found occurrence at f @ 0:0-0:0 for symbol a, but there is no matching SymbolInformation in external symbols or any document",
+    "path": "f",
+    "range": [
+      0,
+      0,
+      0,
+      0
+    ],
+    "symbol": "a"
+  },
+  {
+    "ruleId": "missing-related-symbol",
+    "severity": "error",
+    "message": "symbol 'b' (#1) (in external symbols) has a relationship to 'c' (#2), but couldn't find #2 in external symbols"
+  },
+  {
+    "ruleId": "duplicate-occurrence",
+    "severity": "warning",
+    "message": "found duplicate occurrence for d at f @ 0:0-0:0 with role 0",
+    "path": "f",
+    "range": [
+      0,
+      0,
+      0,
+      0
+    ],
+    "symbol": "d"
+  },
+  {
+    "ruleId": "duplicate-document",
+    "severity": "warning",
+    "message": "found multiple documents with path 'f' in index",
+    "path": "f"
+  },
+  {
+    "ruleId": "duplicate-symbol-info",
+    "severity": "warning",
+    "message": "found repeated SymbolInformation for external symbol 'b'"
+  }
+]
+`).Equal(t, out.String())
+
+	out.Reset()
+	require.NoError(t, writeLintReport(&out, lintFormatSARIF, problems))
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(out.Bytes(), &log))
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	require.Len(t, run.Tool.Driver.Rules, len(lintRules))
+	// Problems with external symbols have no location, so they're left out.
+	var ruleIDs []string
+	for _, result := range run.Results {
+		require.Equal(t, result.RuleID, run.Tool.Driver.Rules[result.RuleIndex].ID)
+		require.Len(t, result.Locations, 1)
+		ruleIDs = append(ruleIDs, result.RuleID)
+	}
+	require.Equal(t, []string{lintRuleMissingSymbolInfo, lintRuleDuplicateOccurrence, lintRuleDuplicateDocument}, ruleIDs)
+	require.Equal(t, []sarifLocation{{sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: "f", URIBaseID: "%SRCROOT%"},
+		Region:           &sarifRegion{StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 1},
+	}}}, run.Results[0].Locations)
+	require.Equal(t, []sarifLocation{{sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: "f", URIBaseID: "%SRCROOT%"},
+	}}}, run.Results[2].Locations)
+}
+
+func TestLintFilter(t *testing.T) {
+	SkipLintSymbolParseTest = true
+	index := makeIndex([]string{"b~c#r", "b~c#d"}, stringMap{"gen/x/f": {"d"}}, stringMap{"gen/x/f": {"a", "d", "d"}})
+	index.Documents = append(index.Documents, &scip.Document{RelativePath: "gen/x/f"})
+	errs := lintMainPure(index)
+
+	ruleIDs := func(config lintConfig, enable, disable []string) []string {
+		filter, err := newLintFilter(config, enable, disable)
+		require.NoError(t, err)
+		filtered := errs.filter(filter)
+		var ids []string
+		for _, problem := range filtered.problems() {
+			ids = append(ids, problem.RuleID)
+		}
+		return ids
+	}
+	require.Equal(t, []string{lintRuleMissingSymbolInfo, lintRuleMissingRelatedSymbol, lintRuleDuplicateSymbolInfo},
+		ruleIDs(lintConfig{Disable: []string{lintRuleDuplicateOccurrence, lintRuleDuplicateDocument}}, nil, nil))
+	require.Equal(t, []string{lintRuleDuplicateDocument},
+		ruleIDs(lintConfig{Disable: []string{lintRuleDuplicateDocument}}, []string{lintRuleDuplicateDocument}, []string{lintRuleInvalidSymbol}))
+	// Suppressions only apply to problems in documents.
+	require.Equal(t, []string{lintRuleMissingRelatedSymbol, lintRuleDuplicateDocument, lintRuleDuplicateSymbolInfo},
+		ruleIDs(lintConfig{Suppress: []lintSuppression{
+			{Path: "gen/**/f", Rules: []string{lintRuleMissingSymbolInfo, lintRuleDuplicateOccurrence}},
+			{Path: "other/**"},
+		}}, nil, nil))
+	require.Equal(t, []string{lintRuleMissingRelatedSymbol, lintRuleDuplicateSymbolInfo},
+		ruleIDs(lintConfig{Suppress: []lintSuppression{{Path: "gen/*/*"}}}, nil, nil))
+
+	// Notes are kept with the problem they explain.
+	filter, err := newLintFilter(lintConfig{}, []string{lintRuleDuplicateDocument}, nil)
+	require.NoError(t, err)
+	filtered := errs.filter(filter)
+	require.Len(t, filtered.data, 2)
+	require.IsType(t, note{}, filtered.data[1])
+
+	_, err = newLintFilter(lintConfig{}, nil, []string{"multipleRelationshipWarning"})
+	require.ErrorContains(t, err, `unknown lint rule "multipleRelationshipWarning"`)
+	_, err = newLintFilter(lintConfig{Suppress: []lintSuppression{{Path: "gen/[", Rules: nil}}}, nil, nil)
+	require.ErrorContains(t, err, "invalid path")
+}
+
+func TestMatchPathGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"gen/*.go", "gen/a.go", true},
+		{"gen/*.go", "gen/x/a.go", false},
+		{"gen/**", "gen/x/a.go", true},
+		{"gen/**", "gen", true},
+		{"**/*_gen.go", "a_gen.go", true},
+		{"**/*_gen.go", "x/y/a_gen.go", true},
+		{"**/*_gen.go", "x/y/a.go", false},
+		{"a/**/b/*.go", "a/x/y/b/c.go", true},
+		{"a/**/b/*.go", "a/b/c.go", true},
+		{"a/**/b/*.go", "a/c.go", false},
+	} {
+		require.Equal(t, tc.match, matchPathGlob(tc.pattern, tc.name), "%s %s", tc.pattern, tc.name)
+	}
+}
+
+func TestLintBaseline(t *testing.T) {
+	SkipLintSymbolParseTest = true
+	dir := t.TempDir()
+	writeIndex := func(index *scip.Index) string {
+		indexPath := filepath.Join(dir, "index.scip")
+		data, err := proto.Marshal(index)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(indexPath, data, 0o644))
+		return indexPath
+	}
+	configPath := filepath.Join(dir, "lint.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("disable: [duplicate-occurrence]\nbaseline: baseline.json\n"), 0o644))
+	opts := lintOptions{format: lintFormatJSON, configPath: configPath}
+
+	indexPath := writeIndex(makeIndex(nil, stringMap{"f": {"d"}}, stringMap{"f": {"a", "d", "d"}}))
+	var out bytes.Buffer
+	require.ErrorContains(t, lintMain(indexPath, opts, &out), "found 1 problems")
+
+	writeOpts := opts
+	writeOpts.writeBaseline = true
+	out.Reset()
+	require.NoError(t, lintMain(indexPath, writeOpts, &out))
+	require.Equal(t, fmt.Sprintf("Wrote 1 problems to %s\n", filepath.Join(dir, "baseline.json")), out.String())
+	out.Reset()
+	require.NoError(t, lintMain(indexPath, opts, &out))
+	require.Equal(t, "[]\n", out.String())
+
+	// Problems with occurrences are still known when the occurrences move.
+	index := makeIndex(nil, stringMap{"f": {"d"}}, stringMap{"f": {"a", "d", "d"}})
+	index.Documents[0].Occurrences[0].Range = []int32{5, 2, 3}
+	indexPath = writeIndex(index)
+	out.Reset()
+	require.NoError(t, lintMain(indexPath, opts, &out))
+	require.Equal(t, "[]\n", out.String())
+
+	// A second occurrence of a known problem's symbol is a new problem.
+	index = makeIndex(nil, stringMap{"f": {"d"}}, stringMap{"f": {"a", "a", "d", "d"}})
+	index.Documents[0].Occurrences[1].Range = []int32{7, 0, 1}
+	indexPath = writeIndex(index)
+	out.Reset()
+	require.ErrorContains(t, lintMain(indexPath, opts, &out), "found 1 problems")
+	require.Contains(t, out.String(), "for symbol a,")
+
+	// Only the new problem is reported.
+	indexPath = writeIndex(makeIndex(nil, stringMap{"f": {"d"}}, stringMap{"f": {"a", "b", "d", "d"}}))
+	out.Reset()
+	require.ErrorContains(t, lintMain(indexPath, opts, &out), "found 1 problems")
+	require.Contains(t, out.String(), "for symbol b,")
+}
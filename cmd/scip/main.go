@@ -25,10 +25,11 @@ func commands() []*cli.Command {
 	stats := statsCommand()
 	test := testCommand()
 	convert := convertCommand()
+	query := queryCommand()
 	parse := parseCommand()
 	rstCLI := *rstCLICommands()
 	tui := tuiCommand()
-	return []*cli.Command{&lint, &print, &snapshot, &stats, &test, &convert, &parse, &rstCLI, &tui}
+	return []*cli.Command{&lint, &print, &snapshot, &stats, &test, &convert, &query, &parse, &rstCLI, &tui}
 }
 
 //go:embed version.txt
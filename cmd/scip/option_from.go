@@ -14,19 +14,11 @@ import (
 // If fromPath has the value "-" then the SCIP Index is read from os.Stdin.
 // Otherwise, fromPath is interpreted as a file path and the bytes are read from disk.
 func readFromOption(fromPath string) (*scip.Index, error) {
-	var scipReader io.Reader
-	if fromPath == "-" {
-		scipReader = os.Stdin
-	} else if !strings.HasSuffix(fromPath, ".scip") && !strings.HasSuffix(fromPath, ".lsif-typed") {
-		return nil, errors.Newf("expected file with .scip extension but found %s", fromPath)
-	} else {
-		scipFile, err := os.Open(fromPath)
-		defer scipFile.Close()
-		if err != nil {
-			return nil, err
-		}
-		scipReader = scipFile
+	scipReader, err := openFromOption(fromPath)
+	if err != nil {
+		return nil, err
 	}
+	defer scipReader.Close()
 
 	scipBytes, err := io.ReadAll(scipReader)
 	if err != nil {
@@ -40,3 +32,15 @@ func readFromOption(fromPath string) (*scip.Index, error) {
 	}
 	return &scipIndex, nil
 }
+
+// openFromOption opens the fromPath parameter like readFromOption, for
+// callers which parse the SCIP index incrementally.
+func openFromOption(fromPath string) (io.ReadCloser, error) {
+	if fromPath == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if !strings.HasSuffix(fromPath, ".scip") && !strings.HasSuffix(fromPath, ".lsif-typed") {
+		return nil, errors.Newf("expected file with .scip extension but found %s", fromPath)
+	}
+	return os.Open(fromPath)
+}
@@ -73,7 +73,7 @@ func detectRepoID(index *scip.Index) string {
 }
 
 func parseCommand() cli.Command {
-	var outputDir, repoID string
+	var outputDir, repoID, format string
 	var verbose bool
 	command := cli.Command{
 		Name:  "parse",
@@ -85,7 +85,18 @@ Example:
 Output files are stored as protobuf binary format:
   {Sanitized_Repo_ID}.{Language_Code}.rst
 
-Use 'scip print' to output RST as JSON for debugging.`,
+Use 'scip print' to output RST as JSON for debugging.
+
+With --format sqlite, the RSTs are stored in {output}/` + rstDBFile + ` instead, with
+tables for documents, symbols (including their code), edges and
+diagnostics. Parsing another repo adds it to the same database; parsing
+a repo again replaces it. For example, the symbols with the most
+references:
+  sqlite3 ~/.rsts/` + rstDBFile + ` \
+    'SELECT target, count(*) AS fan_in FROM edges
+     GROUP BY target ORDER BY fan_in DESC LIMIT 20'
+
+'scip cli --format sqlite' queries the database.`,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "output",
@@ -103,19 +114,23 @@ Use 'scip print' to output RST as JSON for debugging.`,
 				Usage:       "Enable verbose debug output",
 				Destination: &verbose,
 			},
+			rstFormatFlag(&format),
 		},
 		Action: func(c *cli.Context) error {
 			indexPath := c.Args().Get(0)
 			if indexPath == "" {
 				return errors.New("missing argument for path to SCIP index")
 			}
-			return parseMain(indexPath, outputDir, repoID, verbose)
+			if err := checkRSTFormat(format); err != nil {
+				return err
+			}
+			return parseMain(indexPath, outputDir, repoID, format, verbose)
 		},
 	}
 	return command
 }
 
-func parseMain(indexPath, outputDir, repoID string, verbose bool) error {
+func parseMain(indexPath, outputDir, repoID, format string, verbose bool) error {
 	index, err := readFromOption(indexPath)
 	if err != nil {
 		return err
@@ -125,11 +140,53 @@ func parseMain(indexPath, outputDir, repoID string, verbose bool) error {
 		println("DEBUG: parseMain called")
 	}
 
+	rsts, err := buildRSTs(index, repoID, verbose)
+	if err != nil {
+		return err
+	}
+
+	// Expand ~ to home directory
+	outputDir = expandHome(outputDir)
+
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create output directory %s", outputDir)
+	}
+
+	if format == rstFormatSQLite {
+		dbPath := filepath.Join(outputDir, rstDBFile)
+		if err := writeRSTDatabase(dbPath, rsts); err != nil {
+			return err
+		}
+		fmt.Printf("Generated RST database: %s\n", dbPath)
+		return nil
+	}
+
+	for filename, rstTable := range rsts {
+		outputPath := filepath.Join(outputDir, filename)
+
+		// Write with atomic rename (tmp -> rst)
+		tmpPath := outputPath + ".tmp"
+		if err := writeRST(tmpPath, rstTable); err != nil {
+			return errors.Wrapf(err, "failed to write RST to %s", tmpPath)
+		}
+		if err := os.Rename(tmpPath, outputPath); err != nil {
+			return errors.Wrapf(err, "failed to rename %s to %s", tmpPath, outputPath)
+		}
+		fmt.Printf("Generated RST: %s\n", outputPath)
+	}
+
+	return nil
+}
+
+// buildRSTs builds one RST per language of index, keyed by the file name
+// 'scip parse' writes it to.
+func buildRSTs(index *scip.Index, repoID string, verbose bool) (map[string]*rst.RST, error) {
 	// Auto-detect repoID from SCIP index if not provided
 	if repoID == "" {
 		repoID = detectRepoID(index)
 		if repoID == "" {
-			return errors.New("could not auto-detect repo ID; please specify --repo")
+			return nil, errors.New("could not auto-detect repo ID; please specify --repo")
 		}
 	}
 
@@ -147,14 +204,6 @@ func parseMain(indexPath, outputDir, repoID string, verbose bool) error {
 		}
 	}
 
-	// Expand ~ to home directory
-	outputDir = expandHome(outputDir)
-
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return errors.Wrapf(err, "failed to create output directory %s", outputDir)
-	}
-
 	// Group documents by language
 	langDocs := make(map[string][]*scip.Document)
 	for _, doc := range index.Documents {
@@ -166,33 +215,21 @@ func parseMain(indexPath, outputDir, repoID string, verbose bool) error {
 	}
 
 	// Process each language
+	rsts := make(map[string]*rst.RST, len(langDocs))
 	for lang, docs := range langDocs {
-		rstTable := buildRST(docs, repoID, projectRoot, verbose)
-
 		// Sanitize repo ID for filename
-		sanitizedRepoID := sanitizeRepoID(repoID)
-		filename := fmt.Sprintf("%s.%s.rst", sanitizedRepoID, lang)
-		outputPath := filepath.Join(outputDir, filename)
-
-		// Write with atomic rename (tmp -> rst)
-		tmpPath := outputPath + ".tmp"
-		if err := writeRST(tmpPath, rstTable); err != nil {
-			return errors.Wrapf(err, "failed to write RST to %s", tmpPath)
-		}
-		if err := os.Rename(tmpPath, outputPath); err != nil {
-			return errors.Wrapf(err, "failed to rename %s to %s", tmpPath, outputPath)
-		}
-		fmt.Printf("Generated RST: %s\n", outputPath)
+		filename := fmt.Sprintf("%s.%s.rst", sanitizeRepoID(repoID), lang)
+		rsts[filename] = buildRST(docs, repoID, projectRoot, verbose)
 	}
-
-	return nil
+	return rsts, nil
 }
 
 func buildRST(docs []*scip.Document, repoID, projectRoot string, verbose bool) *rst.RST {
 	rstTable := &rst.RST{
 		Metadata: &rst.Metadata{
-			Repo:     repoID,
-			Language: docs[0].Language,
+			Repo:        repoID,
+			Language:    docs[0].Language,
+			ProjectRoot: projectRoot,
 		},
 		Documents: make(map[string]*rst.Document),
 	}
@@ -203,6 +240,7 @@ func buildRST(docs []*scip.Document, repoID, projectRoot string, verbose bool) *
 		rstDoc := &rst.Document{
 			RelativePath: doc.RelativePath,
 			Symbols:      make(map[string]*rst.Symbol),
+			Diagnostics:  buildDiagnostics(doc),
 		}
 
 		// Build occurrence index for line number and kind lookup
@@ -393,6 +431,32 @@ func buildSignature(sym *scip.SymbolInformation) string {
 	return prefix + name
 }
 
+// buildDiagnostics collects the diagnostics attached to the occurrences of doc.
+func buildDiagnostics(doc *scip.Document) []*rst.Diagnostic {
+	var diagnostics []*rst.Diagnostic
+	for _, occ := range doc.Occurrences {
+		if len(occ.Range) < 2 {
+			continue
+		}
+		for _, diag := range occ.Diagnostics {
+			var tags []string
+			for _, tag := range diag.Tags {
+				tags = append(tags, tag.String())
+			}
+			diagnostics = append(diagnostics, &rst.Diagnostic{
+				Severity: diag.Severity.String(),
+				Code:     diag.Code,
+				Message:  diag.Message,
+				Source:   diag.Source,
+				Line:     occ.Range[0] + 1, // 1-indexed line
+				Column:   occ.Range[1] + 1, // 1-indexed column
+				Tags:     tags,
+			})
+		}
+	}
+	return diagnostics
+}
+
 func inferKindFromRoles(roles int32) string {
 	// Check for definition role
 	isDefinition := (roles & int32(scip.SymbolRole_Definition)) > 0
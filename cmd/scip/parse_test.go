@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+func TestBuildDiagnostics(t *testing.T) {
+	doc := &scip.Document{
+		RelativePath: "a.go",
+		Occurrences: []*scip.Occurrence{
+			{
+				Range:  []int32{4, 8, 14},
+				Symbol: "local 0",
+				Diagnostics: []*scip.Diagnostic{
+					{
+						Severity: scip.Severity_Error,
+						Code:     "UnusedVar",
+						Message:  "declared and not used: x",
+						Source:   "compiler",
+						Tags:     []scip.DiagnosticTag{scip.DiagnosticTag_Unnecessary, scip.DiagnosticTag_Deprecated},
+					},
+					{Severity: scip.Severity_Hint, Message: "rename x"},
+				},
+			},
+			// Occurrences without diagnostics or without a range are skipped.
+			{Range: []int32{1, 0, 3}, Symbol: "local 1"},
+			{Symbol: "local 2", Diagnostics: []*scip.Diagnostic{{Message: "no range"}}},
+			{
+				Range:       []int32{0, 0, 2, 1},
+				Diagnostics: []*scip.Diagnostic{{Message: "no severity"}},
+			},
+		},
+	}
+	expected := []*rst.Diagnostic{
+		{
+			Severity: "Error",
+			Code:     "UnusedVar",
+			Message:  "declared and not used: x",
+			Source:   "compiler",
+			Line:     5,
+			Column:   9,
+			Tags:     []string{"Unnecessary", "Deprecated"},
+		},
+		{Severity: "Hint", Message: "rename x", Line: 5, Column: 9},
+		{Severity: "UnspecifiedSeverity", Message: "no severity", Line: 1, Column: 1},
+	}
+	if diff := gocmp.Diff(expected, buildDiagnostics(doc), protocmp.Transform()); diff != "" {
+		t.Errorf("diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildRSTsProjectRoot(t *testing.T) {
+	index := &scip.Index{
+		Metadata:  &scip.Metadata{ProjectRoot: "file:///home/user/demo"},
+		Documents: []*scip.Document{{RelativePath: "a.go", Language: "go"}},
+	}
+	rsts, err := buildRSTs(index, "demo", false)
+	require.NoError(t, err)
+	require.Equal(t, "/home/user/demo", rsts["demo.go.rst"].GetMetadata().GetProjectRoot())
+
+	path := filepath.Join(t.TempDir(), "demo.go.rst")
+	require.NoError(t, writeRST(path, rsts["demo.go.rst"]))
+	got, err := readRSTFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "/home/user/demo", got.GetMetadata().GetProjectRoot())
+}
@@ -0,0 +1,928 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/proto"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+func queryCommand() cli.Command {
+	definition := queryOccurrencesCommand("definition", "Find the definitions of a symbol", scip.SymbolRole_Definition)
+	references := queryOccurrencesCommand("references", "Find the references to a symbol", 0)
+	implementations := queryRelatedCommand("implementations", "Find the symbols implementing a symbol", queryImplementations)
+	typeDefinition := queryRelatedCommand("type-definition", "Find the type definitions of a symbol", queryTypeDefinitions)
+	hover := queryHoverCommand()
+	symbolsInFile := querySymbolsInFileCommand()
+	search := querySearchCommand()
+	diagnostics := queryDiagnosticsCommand()
+	command := cli.Command{
+		Name:  "query",
+		Usage: "[EXPERIMENTAL] Query a SQLite database created by expt-convert",
+		Description: `Answers code navigation queries using a SQLite database created by
+'scip expt-convert', and prints the results as JSON.
+
+Symbols are given either with --symbol or as a position in a document:
+
+  scip query definition --db index.db src/main.go 10 4
+  scip query references --db index.db --symbol 'scip-go gomod example v1 main/run().'
+
+Lines and characters are 0-based, like in SCIP. Local symbols are
+only looked up in the document containing the position.
+
+By default, the latest index for each repo in the database is queried.
+Use --repo or --index to query a specific one.
+
+implementations and type-definition use the relationships of symbols.
+To include external symbols, create the database with
+'scip expt-convert --external-symbols'.
+
+search finds the symbols whose display name, descriptor names or
+documentation contain the words of the text as word prefixes, ranked by
+relevance, with matches in display names ranked first:
+
+  scip query search --db index.db http handler`,
+		Subcommands: []*cli.Command{&definition, &references, &implementations, &typeDefinition, &hover, &symbolsInFile, &search, &diagnostics},
+	}
+	return command
+}
+
+// queryOptions selects the database and the indexes in it to query.
+type queryOptions struct {
+	dbPath string
+	// indexID selects a single index. Otherwise, repo selects the latest
+	// index for the repo, and if both are empty, the latest index for
+	// each repo is queried.
+	indexID int64
+	repo    string
+}
+
+func queryDBFlags(opts *queryOptions) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "db",
+			Usage:       "Path to SQLite database created by expt-convert",
+			Destination: &opts.dbPath,
+			Value:       "index.db",
+		},
+		&cli.Int64Flag{
+			Name:        "index",
+			Usage:       "ID of the index to query",
+			Destination: &opts.indexID,
+		},
+		&cli.StringFlag{
+			Name:        "repo",
+			Usage:       "Query the latest index for the repo",
+			Destination: &opts.repo,
+		},
+	}
+}
+
+func querySymbolFlag(symbol *string) *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "symbol",
+		Usage:       "Symbol to look up, instead of a position",
+		Destination: symbol,
+	}
+}
+
+// queryTarget is the symbol a query is about, or the position of an
+// occurrence of that symbol.
+type queryTarget struct {
+	Symbol    string
+	Path      string
+	Line      int32
+	Character int32
+}
+
+func parseQueryTarget(c *cli.Context, symbol string) (queryTarget, error) {
+	if symbol != "" {
+		if c.Args().Present() {
+			return queryTarget{}, errors.New("expected either --symbol or a position, but got both")
+		}
+		return queryTarget{Symbol: symbol}, nil
+	}
+	if c.NArg() != 3 {
+		return queryTarget{}, errors.New("expected arguments <path> <line> <character> or --symbol")
+	}
+	target := queryTarget{Path: c.Args().Get(0)}
+	for i, dest := range []*int32{&target.Line, &target.Character} {
+		n, err := strconv.ParseInt(c.Args().Get(i+1), 10, 32)
+		if err != nil || n < 0 {
+			return queryTarget{}, errors.Newf("expected a non-negative integer but got %q", c.Args().Get(i+1))
+		}
+		*dest = int32(n)
+	}
+	return target, nil
+}
+
+func queryOccurrencesCommand(name, usage string, role scip.SymbolRole) cli.Command {
+	var opts queryOptions
+	var symbol string
+	return cli.Command{
+		Name:      name,
+		Usage:     usage,
+		ArgsUsage: "[<path> <line> <character>]",
+		Flags:     append(queryDBFlags(&opts), querySymbolFlag(&symbol)),
+		Action: func(c *cli.Context) error {
+			target, err := parseQueryTarget(c, symbol)
+			if err != nil {
+				return err
+			}
+			return queryOccurrencesMain(opts, target, role, c.App.Writer)
+		},
+	}
+}
+
+func queryRelatedCommand(name, usage string, relation queryRelation) cli.Command {
+	var opts queryOptions
+	var symbol string
+	return cli.Command{
+		Name:      name,
+		Usage:     usage,
+		ArgsUsage: "[<path> <line> <character>]",
+		Flags:     append(queryDBFlags(&opts), querySymbolFlag(&symbol)),
+		Action: func(c *cli.Context) error {
+			target, err := parseQueryTarget(c, symbol)
+			if err != nil {
+				return err
+			}
+			return queryRelatedMain(opts, target, relation, c.App.Writer)
+		},
+	}
+}
+
+func queryHoverCommand() cli.Command {
+	var opts queryOptions
+	var symbol string
+	return cli.Command{
+		Name:      "hover",
+		Usage:     "Show the information about a symbol",
+		ArgsUsage: "[<path> <line> <character>]",
+		Flags:     append(queryDBFlags(&opts), querySymbolFlag(&symbol)),
+		Action: func(c *cli.Context) error {
+			target, err := parseQueryTarget(c, symbol)
+			if err != nil {
+				return err
+			}
+			return queryHoverMain(opts, target, c.App.Writer)
+		},
+	}
+}
+
+func querySymbolsInFileCommand() cli.Command {
+	var opts queryOptions
+	return cli.Command{
+		Name:      "symbols-in-file",
+		Usage:     "List the symbols defined in a document",
+		ArgsUsage: "<path>",
+		Flags:     queryDBFlags(&opts),
+		Action: func(c *cli.Context) error {
+			path := c.Args().Get(0)
+			if path == "" {
+				return errors.New("missing argument for document path")
+			}
+			return querySymbolsInFileMain(opts, path, c.App.Writer)
+		},
+	}
+}
+
+func querySearchCommand() cli.Command {
+	var opts queryOptions
+	searchOpts := querySearchOptions{limit: 20}
+	return cli.Command{
+		Name:      "search",
+		Usage:     "Search for symbols by name and documentation",
+		ArgsUsage: "<text>",
+		Flags: append(queryDBFlags(&opts),
+			&cli.IntFlag{
+				Name:        "limit",
+				Usage:       "Maximum number of results, or 0 for no limit",
+				Destination: &searchOpts.limit,
+				Value:       searchOpts.limit,
+			},
+			&cli.BoolFlag{
+				Name:        "documents",
+				Usage:       "Search the text of documents indexed with 'scip expt-convert --index-text' instead",
+				Destination: &searchOpts.documents,
+			},
+		),
+		Action: func(c *cli.Context) error {
+			return querySearchMain(opts, strings.Join(c.Args().Slice(), " "), searchOpts, c.App.Writer)
+		},
+	}
+}
+
+func queryDiagnosticsCommand() cli.Command {
+	var opts queryOptions
+	return cli.Command{
+		Name:      "diagnostics",
+		Usage:     "List the diagnostics in all documents, or in the given document",
+		ArgsUsage: "[<path>]",
+		Flags:     queryDBFlags(&opts),
+		Action: func(c *cli.Context) error {
+			return queryDiagnosticsMain(opts, c.Args().Get(0), c.App.Writer)
+		},
+	}
+}
+
+// queryOccurrence is an occurrence in the JSON output. The range always has
+// four elements: start line, start character, end line and end character.
+type queryOccurrence struct {
+	Repo        string   `json:"repo,omitempty"`
+	Path        string   `json:"path"`
+	Range       [4]int32 `json:"range"`
+	Symbol      string   `json:"symbol"`
+	SymbolRoles int32    `json:"symbolRoles,omitempty"`
+}
+
+type queryHoverResult struct {
+	Symbol          string `json:"symbol"`
+	DisplayName     string `json:"displayName,omitempty"`
+	Kind            string `json:"kind,omitempty"`
+	Signature       string `json:"signature,omitempty"`
+	Documentation   string `json:"documentation,omitempty"`
+	EnclosingSymbol string `json:"enclosingSymbol,omitempty"`
+}
+
+type querySymbol struct {
+	queryHoverResult
+	Range [4]int32 `json:"range"`
+}
+
+// queryRelatedSymbol is a symbol found through relationships. External
+// symbols have no definitions in the database.
+type queryRelatedSymbol struct {
+	queryHoverResult
+	Definitions []queryOccurrence `json:"definitions"`
+}
+
+// querySearchResult is a symbol found by search. Only definitions with an
+// enclosing range are recorded in defn_enclosing_ranges, so the definitions
+// are the enclosing ranges of those.
+type querySearchResult struct {
+	Repo string `json:"repo,omitempty"`
+	queryHoverResult
+	Definitions []queryLocation `json:"definitions"`
+}
+
+type queryLocation struct {
+	Path  string   `json:"path"`
+	Range [4]int32 `json:"range"`
+}
+
+// queryTextResult is a document whose text matches a search. Matches are
+// marked with « and » in the snippet.
+type queryTextResult struct {
+	Repo    string `json:"repo,omitempty"`
+	Path    string `json:"path"`
+	Snippet string `json:"snippet"`
+}
+
+// queryDiagnostic is a diagnostic in the JSON output, with the range of the
+// occurrence it's attached to.
+type queryDiagnostic struct {
+	Repo     string   `json:"repo,omitempty"`
+	Path     string   `json:"path"`
+	Range    [4]int32 `json:"range"`
+	Severity string   `json:"severity,omitempty"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type querySearchOptions struct {
+	// limit is the maximum number of results, or 0 for no limit.
+	limit int
+	// documents searches documents_fts instead of symbols_fts.
+	documents bool
+}
+
+// queryRelation is a kind of relationship between symbols, see
+// scip.Relationship.
+type queryRelation int
+
+const (
+	// queryImplementations finds the symbols with an is_implementation
+	// relationship to the target.
+	queryImplementations queryRelation = iota
+	// queryTypeDefinitions finds the symbols to which the target has an
+	// is_type_definition relationship.
+	queryTypeDefinitions
+)
+
+func queryOccurrencesMain(opts queryOptions, target queryTarget, role scip.SymbolRole, out io.Writer) error {
+	return withQueryDB(opts, func(q *queryDB) error {
+		symbol, err := q.resolve(target)
+		if err != nil {
+			return err
+		}
+		occs, err := q.occurrences(symbol, target.Path, role)
+		if err != nil {
+			return err
+		}
+		return writeQueryJSON(out, occs)
+	})
+}
+
+func queryRelatedMain(opts queryOptions, target queryTarget, relation queryRelation, out io.Writer) error {
+	return withQueryDB(opts, func(q *queryDB) error {
+		symbol, err := q.resolve(target)
+		if err != nil {
+			return err
+		}
+		related, err := q.related(symbol, relation)
+		if err != nil {
+			return err
+		}
+		return writeQueryJSON(out, related)
+	})
+}
+
+func queryHoverMain(opts queryOptions, target queryTarget, out io.Writer) error {
+	return withQueryDB(opts, func(q *queryDB) error {
+		symbol, err := q.resolve(target)
+		if err != nil {
+			return err
+		}
+		hover, err := q.hover(symbol)
+		if err != nil {
+			return err
+		}
+		return writeQueryJSON(out, hover)
+	})
+}
+
+func querySymbolsInFileMain(opts queryOptions, path string, out io.Writer) error {
+	return withQueryDB(opts, func(q *queryDB) error {
+		symbols, err := q.symbolsInFile(path)
+		if err != nil {
+			return err
+		}
+		return writeQueryJSON(out, symbols)
+	})
+}
+
+func queryDiagnosticsMain(opts queryOptions, path string, out io.Writer) error {
+	return withQueryDB(opts, func(q *queryDB) error {
+		diagnostics, err := q.diagnostics(path)
+		if err != nil {
+			return err
+		}
+		return writeQueryJSON(out, diagnostics)
+	})
+}
+
+func querySearchMain(opts queryOptions, text string, searchOpts querySearchOptions, out io.Writer) error {
+	match, err := searchMatchQuery(text)
+	if err != nil {
+		return err
+	}
+	limit := int64(searchOpts.limit)
+	if limit <= 0 {
+		limit = -1 // no limit in SQLite
+	}
+	return withQueryDB(opts, func(q *queryDB) error {
+		var results any
+		var err error
+		if searchOpts.documents {
+			results, err = q.searchDocuments(match, limit)
+		} else {
+			results, err = q.searchSymbols(match, limit)
+		}
+		if err != nil {
+			return err
+		}
+		return writeQueryJSON(out, results)
+	})
+}
+
+// searchMatchQuery turns the search text into an FTS5 query matching the
+// rows which contain each word of the text as a prefix of a token. Words
+// containing punctuation, like "http.Handler", match consecutive tokens.
+func searchMatchQuery(text string) (string, error) {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	if len(terms) == 0 {
+		return "", errors.New("missing search text")
+	}
+	return strings.Join(terms, " "), nil
+}
+
+func writeQueryJSON(out io.Writer, value any) error {
+	jsonBytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal into JSON")
+	}
+	_, err = fmt.Fprintln(out, string(jsonBytes))
+	return err
+}
+
+// queryDB answers queries using the chunks and mentions tables written by
+// Converter.Convert.
+type queryDB struct {
+	conn    *sqlite.Conn
+	decoder *zstd.Decoder
+	// indexes is a JSON array with the IDs of the queried indexes, for
+	// use with json_each.
+	indexes string
+}
+
+func withQueryDB(opts queryOptions, fn func(q *queryDB) error) (err error) {
+	conn, err := openConvertedDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.CombineErrors(err, conn.Close())
+	}()
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return errors.Wrap(err, "zstd reader creation")
+	}
+	defer decoder.Close()
+	indexes, err := queryIndexes(conn, opts)
+	if err != nil {
+		return err
+	}
+	return fn(&queryDB{conn, decoder, indexes})
+}
+
+// queryIndexes returns the IDs of the indexes selected by opts as a JSON
+// array.
+func queryIndexes(conn *sqlite.Conn, opts queryOptions) (string, error) {
+	var ids []int64
+	err := sqlitex.Execute(conn,
+		`SELECT max(id) FROM indexes
+		WHERE ($id = 0 OR id = $id) AND ($repo = '' OR repo = $repo)
+		GROUP BY CASE WHEN $id = 0 THEN repo ELSE id END`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$id": opts.indexID, "$repo": opts.repo},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				ids = append(ids, stmt.ColumnInt64(0))
+				return nil
+			},
+		})
+	if err != nil {
+		return "", errors.Wrap(err, "reading indexes")
+	}
+	if len(ids) == 0 {
+		switch {
+		case opts.indexID != 0:
+			return "", errors.Newf("index not found: %d", opts.indexID)
+		case opts.repo != "":
+			return "", errors.Newf("no index found for repo: %s", opts.repo)
+		default:
+			return "", errors.New("database contains no indexes")
+		}
+	}
+	data, err := json.Marshal(ids)
+	return string(data), err
+}
+
+// resolve returns the symbol of the target. For a position, this is the
+// symbol of the innermost occurrence containing the position.
+func (q *queryDB) resolve(target queryTarget) (string, error) {
+	if target.Symbol != "" {
+		return target.Symbol, nil
+	}
+	docID, err := q.documentID(target.Path)
+	if err != nil {
+		return "", err
+	}
+	// Occurrences are chunked by their start line, so this misses
+	// multi-line occurrences starting before the line, which is fine for
+	// the identifiers queries are about.
+	position := scip.Position{Line: target.Line, Character: target.Character}
+	var best *scip.Occurrence
+	err = q.forEachChunk(
+		`SELECT occurrences FROM chunks
+		WHERE document_id = $document_id AND start_line <= $line AND end_line >= $line`,
+		map[string]any{"$document_id": docID, "$line": target.Line},
+		func(_, _ string, occ *scip.Occurrence) {
+			r := scip.NewRangeUnchecked(occ.Range)
+			if !r.Contains(position) {
+				return
+			}
+			// Prefer the innermost occurrence, i.e. the one starting last.
+			if best == nil || scip.NewRangeUnchecked(best.Range).Start.Less(r.Start) {
+				best = occ
+			}
+		})
+	if err != nil {
+		return "", err
+	}
+	if best == nil {
+		return "", errors.Newf("no occurrence at %s:%d:%d", target.Path, target.Line, target.Character)
+	}
+	return best.Symbol, nil
+}
+
+func (q *queryDB) documentID(path string) (int64, error) {
+	var docIDs []int64
+	err := sqlitex.Execute(q.conn,
+		`SELECT id FROM documents
+		WHERE relative_path = $path AND index_id IN (SELECT value FROM json_each($indexes))`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$path": path, "$indexes": q.indexes},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				docIDs = append(docIDs, stmt.ColumnInt64(0))
+				return nil
+			},
+		})
+	if err != nil {
+		return 0, errors.Wrapf(err, "looking up document %q", path)
+	}
+	switch len(docIDs) {
+	case 0:
+		return 0, errors.Newf("document not found: %s", path)
+	case 1:
+		return docIDs[0], nil
+	default:
+		return 0, errors.Newf("document %s is in %d indexes; select one with --repo or --index", path, len(docIDs))
+	}
+}
+
+// forEachChunk runs the query, which must select the occurrences column of
+// chunks (optionally followed by the relative path of the document and the
+// repo of the index), and calls fn for each occurrence in the chunks.
+func (q *queryDB) forEachChunk(query string, args map[string]any, fn func(repo, path string, occ *scip.Occurrence)) error {
+	return sqlitex.Execute(q.conn, query, &sqlitex.ExecOptions{
+		Named: args,
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			var chunk Chunk
+			if err := chunk.fromDBFormat(stmt.ColumnReader(0), q.decoder); err != nil {
+				return err
+			}
+			var repo, path string
+			if stmt.ColumnCount() > 2 {
+				path, repo = stmt.ColumnText(1), stmt.ColumnText(2)
+			}
+			for _, occ := range chunk.Occurrences {
+				fn(repo, path, occ)
+			}
+			return nil
+		},
+	})
+}
+
+// occurrences returns the occurrences of the symbol which have all of the
+// given roles. Local symbols are only looked up in the document at path.
+func (q *queryDB) occurrences(symbol, path string, role scip.SymbolRole) ([]queryOccurrence, error) {
+	occs := []queryOccurrence{}
+	collect := func(repo, path string, occ *scip.Occurrence) {
+		if occ.Symbol == symbol && occ.SymbolRoles&int32(role) == int32(role) {
+			occs = append(occs, newQueryOccurrence(repo, path, occ))
+		}
+	}
+	if scip.IsLocalSymbol(symbol) {
+		if path == "" {
+			return nil, errors.Newf("local symbol %q must be given as a position", symbol)
+		}
+		docID, err := q.documentID(path)
+		if err != nil {
+			return nil, err
+		}
+		// If local symbols were indexed (see --local-symbols), only the
+		// chunks mentioning the symbol are read. Otherwise, all chunks of
+		// the document are.
+		err = q.forEachChunk(
+			`SELECT c.occurrences, d.relative_path, i.repo FROM chunks c
+			JOIN documents d ON d.id = c.document_id
+			JOIN indexes i ON i.id = d.index_id
+			WHERE c.document_id = $document_id AND (
+				NOT EXISTS (SELECT 1 FROM local_mentions WHERE document_id = $document_id)
+				OR c.id IN (
+					SELECT chunk_id FROM local_mentions
+					WHERE document_id = $document_id AND symbol = $symbol AND role & $role = $role
+				)
+			)
+			ORDER BY c.chunk_index`,
+			map[string]any{"$document_id": docID, "$symbol": symbol, "$role": int64(role)}, collect)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading occurrences of %q", symbol)
+		}
+		return occs, nil
+	}
+	// Mentions record the roles of each symbol per chunk, which lets us
+	// skip decoding chunks which can't contain matching occurrences.
+	err := q.forEachChunk(
+		`SELECT c.occurrences, d.relative_path, i.repo FROM chunks c
+		JOIN documents d ON d.id = c.document_id
+		JOIN indexes i ON i.id = d.index_id
+		WHERE c.id IN (
+			SELECT m.chunk_id FROM mentions m
+			JOIN global_symbols g ON g.id = m.symbol_id
+			WHERE g.symbol = $symbol AND m.role & $role = $role
+				AND g.index_id IN (SELECT value FROM json_each($indexes))
+		)
+		ORDER BY i.repo, d.relative_path, c.chunk_index`,
+		map[string]any{"$symbol": symbol, "$role": int64(role), "$indexes": q.indexes}, collect)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading occurrences of %q", symbol)
+	}
+	return occs, nil
+}
+
+func newQueryOccurrence(repo, path string, occ *scip.Occurrence) queryOccurrence {
+	r := scip.NewRangeUnchecked(occ.Range)
+	return queryOccurrence{
+		Repo:        repo,
+		Path:        path,
+		Range:       [4]int32{r.Start.Line, r.Start.Character, r.End.Line, r.End.Character},
+		Symbol:      occ.Symbol,
+		SymbolRoles: occ.SymbolRoles,
+	}
+}
+
+// hover returns the information stored for the symbol. The database has no
+// information about local symbols, so only the symbol is returned for them.
+func (q *queryDB) hover(symbol string) (queryHoverResult, error) {
+	if scip.IsLocalSymbol(symbol) {
+		return queryHoverResult{Symbol: symbol}, nil
+	}
+	infos, err := q.symbolInfos(`WHERE symbol = $symbol`, map[string]any{"$symbol": symbol})
+	if err != nil {
+		return queryHoverResult{}, err
+	}
+	info, ok := infos[symbol]
+	if !ok {
+		return queryHoverResult{}, errors.Newf("symbol not found: %s", symbol)
+	}
+	return info, nil
+}
+
+// symbolInfos returns the information for the global symbols matching the
+// where clause in the queried indexes. If a symbol is in several indexes,
+// the information from the latest one is returned.
+func (q *queryDB) symbolInfos(where string, args map[string]any) (map[string]queryHoverResult, error) {
+	infos := map[string]queryHoverResult{}
+	args["$indexes"] = q.indexes
+	err := sqlitex.Execute(q.conn,
+		`SELECT symbol, display_name, kind, documentation, enclosing_symbol, signature FROM global_symbols `+
+			where+` AND index_id IN (SELECT value FROM json_each($indexes)) ORDER BY index_id`,
+		&sqlitex.ExecOptions{
+			Named: args,
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				info, err := readQueryHoverResult(stmt, 0)
+				if err != nil {
+					return err
+				}
+				infos[info.Symbol] = info
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading symbol information")
+	}
+	return infos, nil
+}
+
+// readQueryHoverResult reads the symbol, display_name, kind,
+// documentation, enclosing_symbol and signature columns of global_symbols,
+// starting at column col.
+func readQueryHoverResult(stmt *sqlite.Stmt, col int) (queryHoverResult, error) {
+	info := queryHoverResult{
+		Symbol:          stmt.ColumnText(col),
+		DisplayName:     stmt.ColumnText(col + 1),
+		Documentation:   stmt.ColumnText(col + 3),
+		EnclosingSymbol: stmt.ColumnText(col + 4),
+	}
+	if kind := scip.SymbolInformation_Kind(stmt.ColumnInt64(col + 2)); kind != scip.SymbolInformation_UnspecifiedKind {
+		info.Kind = kind.String()
+	}
+	if stmt.ColumnType(col+5) != sqlite.TypeNull {
+		var signature scip.Document
+		data := make([]byte, stmt.ColumnLen(col+5))
+		stmt.ColumnBytes(col+5, data)
+		if err := proto.Unmarshal(data, &signature); err != nil {
+			return queryHoverResult{}, errors.Wrapf(err, "failed to unmarshal signature of symbol %q", info.Symbol)
+		}
+		info.Signature = signature.Text
+	}
+	return info, nil
+}
+
+// diagnostics returns the diagnostics in the document at path, or in all
+// documents if path is empty, sorted by document and range.
+func (q *queryDB) diagnostics(path string) ([]queryDiagnostic, error) {
+	if path != "" {
+		// Check that the document exists, as it's otherwise
+		// indistinguishable from a document without diagnostics.
+		if _, err := q.documentID(path); err != nil {
+			return nil, err
+		}
+	}
+	diagnostics := []queryDiagnostic{}
+	err := sqlitex.Execute(q.conn,
+		`SELECT i.repo, d.relative_path, x.start_line, x.start_char, x.end_line, x.end_char,
+			x.severity, x.code, x.message, x.source, x.tags
+		FROM diagnostics x
+		JOIN documents d ON d.id = x.document_id
+		JOIN indexes i ON i.id = d.index_id
+		WHERE d.index_id IN (SELECT value FROM json_each($indexes)) AND ($path = '' OR d.relative_path = $path)
+		ORDER BY i.repo, d.relative_path, x.start_line, x.start_char, x.id`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$indexes": q.indexes, "$path": path},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				diagnostic := queryDiagnostic{
+					Repo: stmt.ColumnText(0),
+					Path: stmt.ColumnText(1),
+					Range: [4]int32{
+						stmt.ColumnInt32(2), stmt.ColumnInt32(3), stmt.ColumnInt32(4), stmt.ColumnInt32(5),
+					},
+					Code:    stmt.ColumnText(7),
+					Message: stmt.ColumnText(8),
+					Source:  stmt.ColumnText(9),
+				}
+				if stmt.ColumnType(6) != sqlite.TypeNull {
+					diagnostic.Severity = scip.Severity(stmt.ColumnInt32(6)).String()
+				}
+				if stmt.ColumnType(10) != sqlite.TypeNull {
+					var tags []scip.DiagnosticTag
+					if err := json.Unmarshal([]byte(stmt.ColumnText(10)), &tags); err != nil {
+						return errors.Wrap(err, "failed to parse diagnostic tags")
+					}
+					for _, tag := range tags {
+						diagnostic.Tags = append(diagnostic.Tags, tag.String())
+					}
+				}
+				diagnostics = append(diagnostics, diagnostic)
+				return nil
+			},
+		})
+	return diagnostics, errors.Wrap(err, "reading diagnostics")
+}
+
+// searchSymbols returns the symbols matching the FTS5 query, ranked by
+// relevance, with their definitions.
+func (q *queryDB) searchSymbols(match string, limit int64) ([]querySearchResult, error) {
+	results := []querySearchResult{}
+	var symbolIDs []int64
+	err := sqlitex.Execute(q.conn,
+		`SELECT g.id, i.repo, g.symbol, g.display_name, g.kind, g.documentation, g.enclosing_symbol, g.signature
+		FROM symbols_fts f
+		JOIN global_symbols g ON g.id = f.rowid
+		JOIN indexes i ON i.id = g.index_id
+		WHERE symbols_fts MATCH $match AND g.index_id IN (SELECT value FROM json_each($indexes))
+		ORDER BY bm25(symbols_fts, 10.0, 5.0, 1.0), g.id
+		LIMIT $limit`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$match": match, "$indexes": q.indexes, "$limit": limit},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				info, err := readQueryHoverResult(stmt, 2)
+				if err != nil {
+					return err
+				}
+				symbolIDs = append(symbolIDs, stmt.ColumnInt64(0))
+				results = append(results, querySearchResult{Repo: stmt.ColumnText(1), queryHoverResult: info})
+				return nil
+			},
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "searching symbols")
+	}
+	for i, symbolID := range symbolIDs {
+		results[i].Definitions = []queryLocation{}
+		err := sqlitex.Execute(q.conn,
+			`SELECT d.relative_path, r.start_line, r.start_char, r.end_line, r.end_char
+			FROM defn_enclosing_ranges r
+			JOIN documents d ON d.id = r.document_id
+			WHERE r.symbol_id = ?
+			ORDER BY d.relative_path, r.start_line, r.start_char`,
+			&sqlitex.ExecOptions{
+				Args: []any{symbolID},
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					results[i].Definitions = append(results[i].Definitions, queryLocation{
+						Path: stmt.ColumnText(0),
+						Range: [4]int32{
+							stmt.ColumnInt32(1), stmt.ColumnInt32(2), stmt.ColumnInt32(3), stmt.ColumnInt32(4),
+						},
+					})
+					return nil
+				},
+			})
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading definitions of %q", results[i].Symbol)
+		}
+	}
+	return results, nil
+}
+
+// searchDocuments returns the documents whose text matches the FTS5 query,
+// ranked by relevance.
+func (q *queryDB) searchDocuments(match string, limit int64) ([]queryTextResult, error) {
+	results := []queryTextResult{}
+	err := sqlitex.Execute(q.conn,
+		`SELECT i.repo, d.relative_path, snippet(documents_fts, 0, '«', '»', '…', 16)
+		FROM documents_fts f
+		JOIN documents d ON d.id = f.rowid
+		JOIN indexes i ON i.id = d.index_id
+		WHERE documents_fts MATCH $match AND d.index_id IN (SELECT value FROM json_each($indexes))
+		ORDER BY bm25(documents_fts), d.id
+		LIMIT $limit`,
+		&sqlitex.ExecOptions{
+			Named: map[string]any{"$match": match, "$indexes": q.indexes, "$limit": limit},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				results = append(results, queryTextResult{
+					Repo:    stmt.ColumnText(0),
+					Path:    stmt.ColumnText(1),
+					Snippet: stmt.ColumnText(2),
+				})
+				return nil
+			},
+		})
+	return results, errors.Wrap(err, "searching documents")
+}
+
+// related returns the symbols related to the symbol, sorted by symbol,
+// together with their definitions.
+func (q *queryDB) related(symbol string, relation queryRelation) ([]queryRelatedSymbol, error) {
+	var where string
+	switch relation {
+	case queryImplementations:
+		where = `WHERE id IN (
+			SELECT r.symbol_id FROM relationships r
+			JOIN global_symbols target ON target.id = r.related_symbol_id
+			WHERE target.symbol = $symbol AND r.is_implementation
+		)`
+	case queryTypeDefinitions:
+		where = `WHERE id IN (
+			SELECT r.related_symbol_id FROM relationships r
+			JOIN global_symbols source ON source.id = r.symbol_id
+			WHERE source.symbol = $symbol AND r.is_type_definition
+		)`
+	default:
+		panic(fmt.Sprintf("unexpected relation %d", relation))
+	}
+	infos, err := q.symbolInfos(where, map[string]any{"$symbol": symbol})
+	if err != nil {
+		return nil, err
+	}
+	related := []queryRelatedSymbol{}
+	for _, info := range infos {
+		definitions, err := q.occurrences(info.Symbol, "", scip.SymbolRole_Definition)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, queryRelatedSymbol{info, definitions})
+	}
+	sort.Slice(related, func(i, j int) bool {
+		return related[i].Symbol < related[j].Symbol
+	})
+	return related, nil
+}
+
+// symbolsInFile returns the global symbols defined in the document, in the
+// order of their definitions.
+func (q *queryDB) symbolsInFile(path string) ([]querySymbol, error) {
+	docID, err := q.documentID(path)
+	if err != nil {
+		return nil, err
+	}
+	var definitions []*scip.Occurrence
+	err = q.forEachChunk(
+		`SELECT occurrences FROM chunks WHERE document_id = $document_id ORDER BY chunk_index`,
+		map[string]any{"$document_id": docID},
+		func(_, _ string, occ *scip.Occurrence) {
+			if scip.SymbolRole_Definition.Matches(occ) && !scip.IsLocalSymbol(occ.Symbol) {
+				definitions = append(definitions, occ)
+			}
+		})
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading occurrences in %q", path)
+	}
+	infos, err := q.symbolInfos(
+		`WHERE id IN (
+			SELECT m.symbol_id FROM mentions m
+			JOIN chunks c ON c.id = m.chunk_id
+			WHERE c.document_id = $document_id AND m.role & $role != 0
+		)`,
+		map[string]any{"$document_id": docID, "$role": int64(scip.SymbolRole_Definition)})
+	if err != nil {
+		return nil, err
+	}
+	symbols := []querySymbol{}
+	for _, occ := range definitions {
+		info, ok := infos[occ.Symbol]
+		if !ok {
+			info = queryHoverResult{Symbol: occ.Symbol}
+		}
+		symbols = append(symbols, querySymbol{info, newQueryOccurrence("", path, occ).Range})
+	}
+	return symbols, nil
+}
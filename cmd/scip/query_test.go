@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+func TestQuery(t *testing.T) {
+	s1 := "scip-go go . . pkg1/S1#"
+	f := "scip-go go . . pkg1/F()."
+	index := &scip.Index{
+		Documents: []*scip.Document{
+			{
+				RelativePath: "a.go",
+				Occurrences: []*scip.Occurrence{
+					{Symbol: s1, Range: []int32{10, 5, 7}, EnclosingRange: []int32{10, 0, 13, 1}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: "local 0", Range: []int32{11, 1, 2}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: "local 0", Range: []int32{12, 4, 5}},
+				},
+				Symbols: []*scip.SymbolInformation{
+					{Symbol: s1, DisplayName: "S1", Kind: scip.SymbolInformation_Struct, Documentation: []string{"S1 is a struct."}},
+				},
+			},
+			{
+				RelativePath: "b.go",
+				Occurrences: []*scip.Occurrence{
+					{Symbol: f, Range: []int32{3, 5, 6}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: s1, Range: []int32{3, 9, 11}},
+					{Symbol: s1, Range: []int32{15, 9, 11}},
+				},
+			},
+		},
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	// Use small chunks so that queries need to pick the right ones.
+	require.NoError(t, NewConverter(db, 1).Convert(index))
+	require.NoError(t, prepareIndexes(db))
+	require.NoError(t, db.Close())
+	opts := queryOptions{dbPath: dbPath}
+
+	run := func(fn func(out *bytes.Buffer) error) string {
+		var out bytes.Buffer
+		require.NoError(t, fn(&out))
+		return out.String()
+	}
+	at := func(path string, line, character int32) queryTarget {
+		return queryTarget{Path: path, Line: line, Character: character}
+	}
+
+	autogold.Expect(`[
+  {
+    "path": "a.go",
+    "range": [
+      10,
+      5,
+      10,
+      7
+    ],
+    "symbol": "scip-go go . . pkg1/S1#",
+    "symbolRoles": 1
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryOccurrencesMain(opts, at("b.go", 15, 10), scip.SymbolRole_Definition, out)
+	}))
+	autogold.Expect(`[
+  {
+    "path": "a.go",
+    "range": [
+      10,
+      5,
+      10,
+      7
+    ],
+    "symbol": "scip-go go . . pkg1/S1#",
+    "symbolRoles": 1
+  },
+  {
+    "path": "b.go",
+    "range": [
+      3,
+      9,
+      3,
+      11
+    ],
+    "symbol": "scip-go go . . pkg1/S1#"
+  },
+  {
+    "path": "b.go",
+    "range": [
+      15,
+      9,
+      15,
+      11
+    ],
+    "symbol": "scip-go go . . pkg1/S1#"
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryOccurrencesMain(opts, queryTarget{Symbol: s1}, 0, out)
+	}))
+	autogold.Expect(`[
+  {
+    "path": "a.go",
+    "range": [
+      11,
+      1,
+      11,
+      2
+    ],
+    "symbol": "local 0",
+    "symbolRoles": 1
+  },
+  {
+    "path": "a.go",
+    "range": [
+      12,
+      4,
+      12,
+      5
+    ],
+    "symbol": "local 0"
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryOccurrencesMain(opts, at("a.go", 12, 4), 0, out)
+	}))
+	autogold.Expect(`{
+  "symbol": "scip-go go . . pkg1/S1#",
+  "displayName": "S1",
+  "kind": "Struct",
+  "documentation": "S1 is a struct."
+}
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryHoverMain(opts, at("a.go", 10, 6), out)
+	}))
+	autogold.Expect(`[
+  {
+    "symbol": "scip-go go . . pkg1/F().",
+    "range": [
+      3,
+      5,
+      3,
+      6
+    ]
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return querySymbolsInFileMain(opts, "b.go", out)
+	}))
+
+	err = queryHoverMain(opts, at("a.go", 10, 4), &bytes.Buffer{})
+	require.ErrorContains(t, err, "no occurrence at a.go:10:4")
+	err = queryHoverMain(opts, at("c.go", 0, 0), &bytes.Buffer{})
+	require.ErrorContains(t, err, "document not found: c.go")
+	err = queryHoverMain(opts, queryTarget{Symbol: "scip-go go . . pkg1/Missing#"}, &bytes.Buffer{})
+	require.ErrorContains(t, err, "symbol not found")
+	err = queryOccurrencesMain(opts, queryTarget{Symbol: "local 0"}, 0, &bytes.Buffer{})
+	require.ErrorContains(t, err, "must be given as a position")
+}
+
+func TestQuery_Relationships(t *testing.T) {
+	iface := "scip-go go . . pkg1/I#"
+	impl := "scip-go go . . pkg1/S#"
+	value := "scip-go go . . pkg1/V."
+	external := "scip-go go dep v1 dep/E#"
+	index := &scip.Index{
+		Documents: []*scip.Document{{
+			RelativePath: "a.go",
+			Occurrences: []*scip.Occurrence{
+				{Symbol: iface, Range: []int32{0, 5, 6}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+				{Symbol: impl, Range: []int32{1, 5, 6}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+				{Symbol: value, Range: []int32{2, 4, 5}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+			},
+			Symbols: []*scip.SymbolInformation{
+				{Symbol: iface},
+				{Symbol: impl, Relationships: []*scip.Relationship{{Symbol: iface, IsImplementation: true}}},
+				{Symbol: value, Relationships: []*scip.Relationship{{Symbol: impl, IsTypeDefinition: true}}},
+			},
+		}},
+		ExternalSymbols: []*scip.SymbolInformation{{
+			Symbol:                 external,
+			SignatureDocumentation: &scip.Document{Language: "go", Text: "type E struct{}"},
+			Relationships:          []*scip.Relationship{{Symbol: iface, IsImplementation: true}},
+		}},
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	converter := NewConverter(db, chunkSizeHint)
+	converter.importExternalSymbols = true
+	require.NoError(t, converter.Convert(index))
+	require.NoError(t, db.Close())
+	opts := queryOptions{dbPath: dbPath}
+
+	run := func(fn func(out *bytes.Buffer) error) string {
+		var out bytes.Buffer
+		require.NoError(t, fn(&out))
+		return out.String()
+	}
+
+	autogold.Expect(`[
+  {
+    "symbol": "scip-go go . . pkg1/S#",
+    "definitions": [
+      {
+        "path": "a.go",
+        "range": [
+          1,
+          5,
+          1,
+          6
+        ],
+        "symbol": "scip-go go . . pkg1/S#",
+        "symbolRoles": 1
+      }
+    ]
+  },
+  {
+    "symbol": "scip-go go dep v1 dep/E#",
+    "signature": "type E struct{}",
+    "definitions": []
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryRelatedMain(opts, queryTarget{Path: "a.go", Line: 0, Character: 5}, queryImplementations, out)
+	}))
+	autogold.Expect(`[
+  {
+    "symbol": "scip-go go . . pkg1/S#",
+    "definitions": [
+      {
+        "path": "a.go",
+        "range": [
+          1,
+          5,
+          1,
+          6
+        ],
+        "symbol": "scip-go go . . pkg1/S#",
+        "symbolRoles": 1
+      }
+    ]
+  }
+]
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryRelatedMain(opts, queryTarget{Symbol: value}, queryTypeDefinitions, out)
+	}))
+	autogold.Expect(`{
+  "symbol": "scip-go go dep v1 dep/E#",
+  "signature": "type E struct{}"
+}
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return queryHoverMain(opts, queryTarget{Symbol: external}, out)
+	}))
+}
+
+func TestQuery_MultipleIndexes(t *testing.T) {
+	s := "scip-go go . . pkg1/S#"
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "index.db")
+	convert := func(repo, commit string, definitionLine int32) {
+		index := &scip.Index{Documents: []*scip.Document{{
+			RelativePath: "a.go",
+			Occurrences: []*scip.Occurrence{
+				{Symbol: s, Range: []int32{definitionLine, 5, 6}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+				{Symbol: s, Range: []int32{definitionLine + 1, 5, 6}},
+			},
+			Symbols: []*scip.SymbolInformation{{Symbol: s, DisplayName: repo + "@" + commit}},
+		}}}
+		data, err := proto.Marshal(index)
+		require.NoError(t, err)
+		indexPath := filepath.Join(dir, "index.scip")
+		require.NoError(t, os.WriteFile(indexPath, data, 0644))
+		flags := convertFlags{output: dbPath, chunkSize: chunkSizeHint, appendIndex: true, repo: repo, commit: commit}
+		require.NoError(t, convertMain(indexPath, flags, io.Discard))
+	}
+	convert("r1", "c1", 0)
+	convert("r2", "c1", 10)
+	convert("r1", "c2", 20)
+	// Converting the same repo and commit again replaces the index, so
+	// index 3 is deleted.
+	convert("r1", "c2", 30)
+
+	run := func(opts queryOptions, fn func(opts queryOptions, out *bytes.Buffer) error) string {
+		opts.dbPath = dbPath
+		var out bytes.Buffer
+		require.NoError(t, fn(opts, &out))
+		return out.String()
+	}
+	definitions := func(opts queryOptions, out *bytes.Buffer) error {
+		return queryOccurrencesMain(opts, queryTarget{Symbol: s}, scip.SymbolRole_Definition, out)
+	}
+	hover := func(opts queryOptions, out *bytes.Buffer) error {
+		return queryHoverMain(opts, queryTarget{Symbol: s}, out)
+	}
+
+	// By default, the latest index of each repo is queried.
+	autogold.Expect(`[
+  {
+    "repo": "r1",
+    "path": "a.go",
+    "range": [
+      30,
+      5,
+      30,
+      6
+    ],
+    "symbol": "scip-go go . . pkg1/S#",
+    "symbolRoles": 1
+  },
+  {
+    "repo": "r2",
+    "path": "a.go",
+    "range": [
+      10,
+      5,
+      10,
+      6
+    ],
+    "symbol": "scip-go go . . pkg1/S#",
+    "symbolRoles": 1
+  }
+]
+`).Equal(t, run(queryOptions{}, definitions))
+	autogold.Expect(`{
+  "symbol": "scip-go go . . pkg1/S#",
+  "displayName": "r1@c2"
+}
+`).Equal(t, run(queryOptions{}, hover))
+	autogold.Expect(`{
+  "symbol": "scip-go go . . pkg1/S#",
+  "displayName": "r2@c1"
+}
+`).Equal(t, run(queryOptions{repo: "r2"}, hover))
+	autogold.Expect(`[
+  {
+    "repo": "r1",
+    "path": "a.go",
+    "range": [
+      0,
+      5,
+      0,
+      6
+    ],
+    "symbol": "scip-go go . . pkg1/S#",
+    "symbolRoles": 1
+  }
+]
+`).Equal(t, run(queryOptions{indexID: 1}, definitions))
+
+	// The replaced index isn't searchable anymore.
+	var results []querySearchResult
+	search := func(opts queryOptions, out *bytes.Buffer) error {
+		return querySearchMain(opts, "S", querySearchOptions{}, out)
+	}
+	require.NoError(t, json.Unmarshal([]byte(run(queryOptions{}, search)), &results))
+	require.Len(t, results, 2)
+	require.ElementsMatch(t, []string{"r1@c2", "r2@c1"}, []string{results[0].DisplayName, results[1].DisplayName})
+
+	err := queryHoverMain(queryOptions{dbPath: dbPath}, queryTarget{Path: "a.go", Line: 10, Character: 5}, &bytes.Buffer{})
+	require.ErrorContains(t, err, "document a.go is in 2 indexes")
+	err = queryHoverMain(queryOptions{dbPath: dbPath, indexID: 3}, queryTarget{Symbol: s}, &bytes.Buffer{})
+	require.ErrorContains(t, err, "index not found: 3")
+	err = queryHoverMain(queryOptions{dbPath: dbPath, repo: "r3"}, queryTarget{Symbol: s}, &bytes.Buffer{})
+	require.ErrorContains(t, err, "no index found for repo: r3")
+	err = reverseConvertMain(dbPath, filepath.Join(dir, "out.scip"), 0)
+	require.ErrorContains(t, err, "database contains 3 indexes")
+}
+
+func TestQuery_Search(t *testing.T) {
+	server := "scip-go go . . http/Server#"
+	serve := "scip-go go . . http/Server#Serve()."
+	handler := "scip-go go . . http/Handler#"
+	index := &scip.Index{
+		Documents: []*scip.Document{
+			{
+				RelativePath: "server.go",
+				Text:         "package http\n\n// Server serves HTTP requests.\ntype Server struct{}\n",
+				Occurrences: []*scip.Occurrence{
+					{Symbol: server, Range: []int32{3, 5, 11}, EnclosingRange: []int32{2, 0, 3, 21}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: serve, Range: []int32{5, 18, 23}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+					{Symbol: handler, Range: []int32{5, 24, 31}},
+				},
+				Symbols: []*scip.SymbolInformation{
+					{Symbol: server, DisplayName: "Server", Kind: scip.SymbolInformation_Struct, Documentation: []string{"A Server handles HTTP requests."}},
+					{Symbol: serve, Documentation: []string{"Serve accepts connections."}},
+				},
+			},
+			{
+				RelativePath: "handler.go",
+				Text:         "package http\n\n// A Handler responds to a request.\ntype Handler interface{}\n",
+			},
+		},
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	converter := NewConverter(db, chunkSizeHint)
+	converter.indexText = true
+	require.NoError(t, converter.Convert(index))
+	require.NoError(t, db.Close())
+	opts := queryOptions{dbPath: dbPath}
+
+	search := func(text string, searchOpts querySearchOptions) string {
+		var out bytes.Buffer
+		require.NoError(t, querySearchMain(opts, text, searchOpts, &out))
+		return out.String()
+	}
+	symbols := func(text string) []string {
+		var results []querySearchResult
+		require.NoError(t, json.Unmarshal([]byte(search(text, querySearchOptions{})), &results))
+		var symbols []string
+		for _, result := range results {
+			symbols = append(symbols, result.Symbol)
+		}
+		return symbols
+	}
+
+	autogold.Expect(`[
+  {
+    "symbol": "scip-go go . . http/Server#",
+    "displayName": "Server",
+    "kind": "Struct",
+    "documentation": "A Server handles HTTP requests.",
+    "definitions": [
+      {
+        "path": "server.go",
+        "range": [
+          2,
+          0,
+          3,
+          21
+        ]
+      }
+    ]
+  }
+]
+`).Equal(t, search("server", querySearchOptions{limit: 1}))
+	// Matches in display names rank above matches in descriptors.
+	require.Equal(t, []string{server, serve}, symbols("server"))
+	// Words are matched as prefixes, in any column.
+	require.Equal(t, []string{server, serve}, symbols("serv"))
+	require.Equal(t, []string{serve}, symbols("serve connections"))
+	require.Equal(t, []string{serve}, symbols("Server.Serve"))
+	// Placeholders for symbols without SymbolInformation aren't indexed.
+	require.Empty(t, symbols("handler"))
+
+	autogold.Expect(`[
+  {
+    "path": "handler.go",
+    "snippet": "package http\n\n// A «Handler» responds to a request.\ntype «Handler» interface{}\n"
+  }
+]
+`).Equal(t, search("handler", querySearchOptions{documents: true}))
+
+	err = querySearchMain(opts, " ", querySearchOptions{}, &bytes.Buffer{})
+	require.ErrorContains(t, err, "missing search text")
+}
+
+func TestQuery_Diagnostics(t *testing.T) {
+	s := "scip-go go . . pkg1/S#"
+	index := &scip.Index{
+		Documents: []*scip.Document{
+			{
+				RelativePath: "b.go",
+				Occurrences: []*scip.Occurrence{{
+					Symbol: s, Range: []int32{4, 2, 3},
+					Diagnostics: []*scip.Diagnostic{{Severity: scip.Severity_Error, Message: "undefined: S"}},
+				}},
+			},
+			{
+				RelativePath: "a.go",
+				Occurrences: []*scip.Occurrence{
+					{Symbol: s, Range: []int32{2, 1, 3, 0}, Diagnostics: []*scip.Diagnostic{{
+						Severity: scip.Severity_Warning,
+						Code:     "SA1019",
+						Message:  "S is deprecated",
+						Source:   "staticcheck",
+						Tags:     []scip.DiagnosticTag{scip.DiagnosticTag_Deprecated},
+					}}},
+					{Symbol: s, Range: []int32{0, 5, 6}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+				},
+			},
+			{RelativePath: "c.go"},
+		},
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	db, err := createSQLiteDatabase(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, NewConverter(db, chunkSizeHint).Convert(index))
+	require.NoError(t, db.Close())
+	opts := queryOptions{dbPath: dbPath}
+
+	run := func(path string) string {
+		var out bytes.Buffer
+		require.NoError(t, queryDiagnosticsMain(opts, path, &out))
+		return out.String()
+	}
+	autogold.Expect(`[
+  {
+    "path": "a.go",
+    "range": [
+      2,
+      1,
+      3,
+      0
+    ],
+    "severity": "Warning",
+    "code": "SA1019",
+    "message": "S is deprecated",
+    "source": "staticcheck",
+    "tags": [
+      "Deprecated"
+    ]
+  },
+  {
+    "path": "b.go",
+    "range": [
+      4,
+      2,
+      4,
+      3
+    ],
+    "severity": "Error",
+    "message": "undefined: S"
+  }
+]
+`).Equal(t, run(""))
+	autogold.Expect(`[
+  {
+    "path": "b.go",
+    "range": [
+      4,
+      2,
+      4,
+      3
+    ],
+    "severity": "Error",
+    "message": "undefined: S"
+  }
+]
+`).Equal(t, run("b.go"))
+	require.Equal(t, "[]\n", run("c.go"))
+	err = queryDiagnosticsMain(opts, "d.go", &bytes.Buffer{})
+	require.ErrorContains(t, err, "document not found: d.go")
+}
+
+func TestQuery_LocalSymbols(t *testing.T) {
+	doc := &scip.Document{
+		RelativePath: "a.go",
+		Occurrences: []*scip.Occurrence{
+			{Symbol: "local 0", Range: []int32{0, 1, 2}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+			{Symbol: "local 1", Range: []int32{1, 1, 2}, SymbolRoles: int32(scip.SymbolRole_Definition)},
+			{Symbol: "local 0", Range: []int32{2, 1, 2}},
+			{Symbol: "local 1", Range: []int32{3, 1, 2}},
+			{Symbol: "local 0", Range: []int32{4, 1, 2}, SymbolRoles: int32(scip.SymbolRole_WriteAccess)},
+		},
+	}
+
+	for _, indexLocalSymbols := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indexLocalSymbols=%v", indexLocalSymbols), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "index.db")
+			db, err := createSQLiteDatabase(dbPath)
+			require.NoError(t, err)
+			// Use small chunks so that local mentions select a subset.
+			converter := NewConverter(db, 1)
+			converter.indexLocalSymbols = indexLocalSymbols
+			require.NoError(t, converter.Convert(&scip.Index{Documents: []*scip.Document{doc}}))
+
+			var localMentions []string
+			err = sqlitex.Execute(db,
+				`SELECT c.chunk_index, m.symbol, m.role FROM local_mentions m
+				JOIN chunks c ON c.id = m.chunk_id ORDER BY c.chunk_index`,
+				&sqlitex.ExecOptions{
+					ResultFunc: func(stmt *sqlite.Stmt) error {
+						localMentions = append(localMentions,
+							fmt.Sprintf("%d %s %d", stmt.ColumnInt(0), stmt.ColumnText(1), stmt.ColumnInt(2)))
+						return nil
+					},
+				})
+			require.NoError(t, err)
+			require.NoError(t, db.Close())
+			if indexLocalSymbols {
+				require.Equal(t, []string{"0 local 0 1", "1 local 1 1", "2 local 0 0", "3 local 1 0", "4 local 0 4"}, localMentions)
+			} else {
+				require.Empty(t, localMentions)
+			}
+
+			var out bytes.Buffer
+			opts := queryOptions{dbPath: dbPath}
+			require.NoError(t, queryOccurrencesMain(opts, queryTarget{Path: "a.go", Line: 2, Character: 1}, 0, &out))
+			var references []queryOccurrence
+			require.NoError(t, json.Unmarshal(out.Bytes(), &references))
+			var lines []int32
+			for _, reference := range references {
+				lines = append(lines, reference.Range[0])
+			}
+			require.Equal(t, []int32{0, 2, 4}, lines)
+
+			out.Reset()
+			require.NoError(t, queryOccurrencesMain(opts, queryTarget{Path: "a.go", Line: 3, Character: 1}, scip.SymbolRole_Definition, &out))
+			require.NoError(t, json.Unmarshal(out.Bytes(), &references))
+			require.Len(t, references, 1)
+			require.Equal(t, int32(1), references[0].Range[0])
+		})
+	}
+}
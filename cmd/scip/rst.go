@@ -22,14 +22,17 @@ func rstCLICommands() *cli.Command {
 		Name:  "cli",
 		Usage: "CLI commands for RST-based code navigation",
 		Description: `Provides CLI tools for navigating code using RST (Relation Symbol Table).
-These commands are compatible with reni CLI interface.`,
+These commands are compatible with reni CLI interface.
+
+They read the RST files in --output, or with --format sqlite the database
+written by 'scip parse --format sqlite'.`,
 		Subcommands: []*cli.Command{&tree, &structCmd, &symCmd},
 	}
 	return &cmd
 }
 
 func treeRepoCommand() cli.Command {
-	var outputDir string
+	var outputDir, format string
 	command := cli.Command{
 		Name:  "tree_repo",
 		Usage: "List all files in the repository",
@@ -43,22 +46,44 @@ Example:
 				Destination: &outputDir,
 				Value:       "~/.rsts",
 			},
+			rstFormatFlag(&format),
 		},
 		Action: func(c *cli.Context) error {
 			repo := c.Args().Get(0)
 			if repo == "" {
 				return errors.New("missing argument for repository name")
 			}
-			return treeRepoMain(outputDir, repo, c.App.Writer)
+			if err := checkRSTFormat(format); err != nil {
+				return err
+			}
+			return treeRepoMain(outputDir, repo, format, c.App.Writer)
 		},
 	}
 	return command
 }
 
-func treeRepoMain(outputDir, repo string, out io.Writer) error {
+func treeRepoMain(outputDir, repo, format string, out io.Writer) error {
 	// Expand ~ to home directory
 	outputDir = expandHome(outputDir)
 
+	if format == rstFormatSQLite {
+		conn, err := openRSTDatabase(outputDir)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		paths, err := queryDBFiles(conn, repo)
+		if err != nil {
+			return err
+		}
+		fileMap := make(map[string][]string)
+		for _, path := range paths {
+			addFileToTree(path, fileMap)
+		}
+		writeFileTree(fileMap, out)
+		return nil
+	}
+
 	// Convert repo name to RST file path
 	rstFileName := strings.ReplaceAll(repo, ".", "_")
 	rstFileName = strings.ReplaceAll(rstFileName, "/", "_")
@@ -80,7 +105,13 @@ func treeRepoMain(outputDir, repo string, out io.Writer) error {
 		return errors.Wrapf(err, "failed to read %s", rstPath)
 	}
 
-	// Output in reni-compatible format
+	writeFileTree(fileMap, out)
+	return nil
+}
+
+// writeFileTree outputs the files grouped by directory in reni-compatible
+// format.
+func writeFileTree(fileMap map[string][]string, out io.Writer) {
 	fmt.Fprintf(out, `{"files":{`)
 	first := true
 	var dirs []string
@@ -105,7 +136,6 @@ func treeRepoMain(outputDir, repo string, out io.Writer) error {
 		first = false
 	}
 	fmt.Fprintln(out, "}}")
-	return nil
 }
 
 func addFilesToTree(rstPath string, fileMap map[string][]string, dirSet map[string]bool) error {
@@ -120,18 +150,24 @@ func addFilesToTree(rstPath string, fileMap map[string][]string, dirSet map[stri
 	}
 
 	for path := range r.Documents {
-		dir := filepath.Dir(path)
-		if dir == "." {
-			dir = ""
-		}
-		fileMap[dir] = append(fileMap[dir], path)
-		dirSet[dir] = true
+		dirSet[addFileToTree(path, fileMap)] = true
 	}
 	return nil
 }
 
+// addFileToTree adds path to the files of its directory and returns the
+// directory.
+func addFileToTree(path string, fileMap map[string][]string) string {
+	dir := filepath.Dir(path)
+	if dir == "." {
+		dir = ""
+	}
+	fileMap[dir] = append(fileMap[dir], path)
+	return dir
+}
+
 func getFileStructureCommand() cli.Command {
-	var outputDir string
+	var outputDir, format string
 	command := cli.Command{
 		Name:  "get_file_structure",
 		Usage: "List all symbols in a file",
@@ -145,6 +181,7 @@ Example:
 				Destination: &outputDir,
 				Value:       "~/.rsts",
 			},
+			rstFormatFlag(&format),
 		},
 		Action: func(c *cli.Context) error {
 			repo := c.Args().Get(0)
@@ -155,25 +192,40 @@ Example:
 			if filePath == "" {
 				return errors.New("missing argument for file path")
 			}
-			return getFileStructureMain(outputDir, repo, filePath, c.App.Writer)
+			if err := checkRSTFormat(format); err != nil {
+				return err
+			}
+			return getFileStructureMain(outputDir, repo, filePath, format, c.App.Writer)
 		},
 	}
 	return command
 }
 
-func getFileStructureMain(outputDir, repo, filePath string, out io.Writer) error {
+func getFileStructureMain(outputDir, repo, filePath, format string, out io.Writer) error {
 	outputDir = expandHome(outputDir)
 
-	// Convert repo name to RST file path
-	rstFile := findRSTFileByRepo(outputDir, repo)
-	if rstFile == "" {
-		return errors.Errorf("file not found in any RST: %s", filePath)
-	}
+	var symbols []SymbolInfo
+	if format == rstFormatSQLite {
+		conn, err := openRSTDatabase(outputDir)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if symbols, err = queryDBFileSymbols(conn, repo, filePath); err != nil {
+			return err
+		}
+	} else {
+		// Convert repo name to RST file path
+		rstFile := findRSTFileByRepo(outputDir, repo)
+		if rstFile == "" {
+			return errors.Errorf("file not found in any RST: %s", filePath)
+		}
 
-	// Read symbols from RST
-	symbols, err := getSymbolsFromRST(rstFile, filePath)
-	if err != nil {
-		return err
+		// Read symbols from RST
+		var err error
+		if symbols, err = getSymbolsFromRST(rstFile, filePath); err != nil {
+			return err
+		}
 	}
 
 	// Output format
@@ -284,7 +336,7 @@ func extractPkgPath(repo string) string {
 }
 
 func getFileSymbolCommand() cli.Command {
-	var outputDir string
+	var outputDir, format string
 	command := cli.Command{
 		Name:  "get_file_symbol",
 		Usage: "Get symbol details including dependencies and references",
@@ -300,6 +352,7 @@ Example:
 				Destination: &outputDir,
 				Value:       "~/.rsts",
 			},
+			rstFormatFlag(&format),
 		},
 		Action: func(c *cli.Context) error {
 			repo := c.Args().Get(0)
@@ -315,31 +368,46 @@ Example:
 			if symbolName == "" {
 				return errors.New("missing argument for symbol name")
 			}
-			return getFileSymbolMain(outputDir, repo, filePath, symbolName, line, c.App.Writer)
+			if err := checkRSTFormat(format); err != nil {
+				return err
+			}
+			return getFileSymbolMain(outputDir, repo, filePath, symbolName, line, format, c.App.Writer)
 		},
 	}
 	return command
 }
 
-func getFileSymbolMain(outputDir, repo, filePath, symbolName, lineArg string, out io.Writer) error {
+func getFileSymbolMain(outputDir, repo, filePath, symbolName, lineArg, format string, out io.Writer) error {
 	outputDir = expandHome(outputDir)
 
-	// Convert repo name to RST file path
-	rstFile := findRSTFileByRepo(outputDir, repo)
-	if rstFile == "" {
-		return errors.Errorf("file not found in any RST: %s", filePath)
-	}
-
 	// Parse optional line number
 	var line int32
 	if lineArg != "" {
 		fmt.Sscanf(lineArg, "%d", &line)
 	}
 
-	// Get symbol details
-	details, err := getSymbolDetails(rstFile, filePath, symbolName, line)
-	if err != nil {
-		return err
+	var details *SymbolDetails
+	if format == rstFormatSQLite {
+		conn, err := openRSTDatabase(outputDir)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if details, err = queryDBSymbolDetails(conn, repo, filePath, symbolName, line); err != nil {
+			return err
+		}
+	} else {
+		// Convert repo name to RST file path
+		rstFile := findRSTFileByRepo(outputDir, repo)
+		if rstFile == "" {
+			return errors.Errorf("file not found in any RST: %s", filePath)
+		}
+
+		// Get symbol details
+		var err error
+		if details, err = getSymbolDetails(rstFile, filePath, symbolName, line); err != nil {
+			return err
+		}
 	}
 
 	// Output in reni-compatible format
@@ -82,8 +82,9 @@ func (x *RST) GetDocuments() map[string]*Document {
 
 type Metadata struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Repo          string                 `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`         // Repository identifier (e.g., github.com/sourcegraph/scip)
-	Language      string                 `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"` // Primary language of this RST file
+	Repo          string                 `protobuf:"bytes,1,opt,name=repo,proto3" json:"repo,omitempty"`                                  // Repository identifier (e.g., github.com/sourcegraph/scip)
+	Language      string                 `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"`                          // Primary language of this RST file
+	ProjectRoot   string                 `protobuf:"bytes,3,opt,name=project_root,json=projectRoot,proto3" json:"project_root,omitempty"` // Absolute path of the project root the SCIP index was created in
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -132,10 +133,18 @@ func (x *Metadata) GetLanguage() string {
 	return ""
 }
 
+func (x *Metadata) GetProjectRoot() string {
+	if x != nil {
+		return x.ProjectRoot
+	}
+	return ""
+}
+
 type Document struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RelativePath  string                 `protobuf:"bytes,1,opt,name=relative_path,json=relativePath,proto3" json:"relative_path,omitempty"`
 	Symbols       map[string]*Symbol     `protobuf:"bytes,2,rep,name=symbols,proto3" json:"symbols,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Diagnostics   []*Diagnostic          `protobuf:"bytes,3,rep,name=diagnostics,proto3" json:"diagnostics,omitempty"` // Diagnostics attached to occurrences in this document
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -184,6 +193,13 @@ func (x *Document) GetSymbols() map[string]*Symbol {
 	return nil
 }
 
+func (x *Document) GetDiagnostics() []*Diagnostic {
+	if x != nil {
+		return x.Diagnostics
+	}
+	return nil
+}
+
 type Symbol struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`                                 // Full SCIP symbol
@@ -276,6 +292,98 @@ func (x *Symbol) GetCode() string {
 	return ""
 }
 
+type Diagnostic struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Severity      string                 `protobuf:"bytes,1,opt,name=severity,proto3" json:"severity,omitempty"` // Severity (Error, Warning, Information, Hint)
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`         // Diagnostic code, if any
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Source        string                 `protobuf:"bytes,4,opt,name=source,proto3" json:"source,omitempty"`  // Tool that reported the diagnostic (e.g., "typescript")
+	Line          int32                  `protobuf:"varint,5,opt,name=line,proto3" json:"line,omitempty"`     // Line number of the occurrence the diagnostic is attached to
+	Column        int32                  `protobuf:"varint,6,opt,name=column,proto3" json:"column,omitempty"` // Column number of the occurrence (1-indexed)
+	Tags          []string               `protobuf:"bytes,7,rep,name=tags,proto3" json:"tags,omitempty"`      // Diagnostic tags (Unnecessary, Deprecated)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Diagnostic) Reset() {
+	*x = Diagnostic{}
+	mi := &file_rst_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Diagnostic) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Diagnostic) ProtoMessage() {}
+
+func (x *Diagnostic) ProtoReflect() protoreflect.Message {
+	mi := &file_rst_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Diagnostic.ProtoReflect.Descriptor instead.
+func (*Diagnostic) Descriptor() ([]byte, []int) {
+	return file_rst_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Diagnostic) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *Diagnostic) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Diagnostic) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Diagnostic) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Diagnostic) GetLine() int32 {
+	if x != nil {
+		return x.Line
+	}
+	return 0
+}
+
+func (x *Diagnostic) GetColumn() int32 {
+	if x != nil {
+		return x.Column
+	}
+	return 0
+}
+
+func (x *Diagnostic) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
 var File_rst_proto protoreflect.FileDescriptor
 
 const file_rst_proto_rawDesc = "" +
@@ -286,13 +394,15 @@ const file_rst_proto_rawDesc = "" +
 	"\tdocuments\x18\x02 \x03(\v2\x17.rst.RST.DocumentsEntryR\tdocuments\x1aK\n" +
 	"\x0eDocumentsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12#\n" +
-	"\x05value\x18\x02 \x01(\v2\r.rst.DocumentR\x05value:\x028\x01\":\n" +
+	"\x05value\x18\x02 \x01(\v2\r.rst.DocumentR\x05value:\x028\x01\"]\n" +
 	"\bMetadata\x12\x12\n" +
 	"\x04repo\x18\x01 \x01(\tR\x04repo\x12\x1a\n" +
-	"\blanguage\x18\x02 \x01(\tR\blanguage\"\xae\x01\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\x12!\n" +
+	"\fproject_root\x18\x03 \x01(\tR\vprojectRoot\"\xe1\x01\n" +
 	"\bDocument\x12#\n" +
 	"\rrelative_path\x18\x01 \x01(\tR\frelativePath\x124\n" +
-	"\asymbols\x18\x02 \x03(\v2\x1a.rst.Document.SymbolsEntryR\asymbols\x1aG\n" +
+	"\asymbols\x18\x02 \x03(\v2\x1a.rst.Document.SymbolsEntryR\asymbols\x121\n" +
+	"\vdiagnostics\x18\x03 \x03(\v2\x0f.rst.DiagnosticR\vdiagnostics\x1aG\n" +
 	"\fSymbolsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12!\n" +
 	"\x05value\x18\x02 \x01(\v2\v.rst.SymbolR\x05value:\x028\x01\"\xc2\x01\n" +
@@ -303,7 +413,16 @@ const file_rst_proto_rawDesc = "" +
 	"\rdependence_on\x18\x04 \x03(\tR\fdependenceOn\x12\x1c\n" +
 	"\tsignature\x18\x05 \x01(\tR\tsignature\x12\x12\n" +
 	"\x04line\x18\x06 \x01(\x05R\x04line\x12\x12\n" +
-	"\x04code\x18\a \x01(\tR\x04codeB*Z(github.com/sourcegraph/scip/cmd/scip/rstb\x06proto3"
+	"\x04code\x18\a \x01(\tR\x04code\"\xae\x01\n" +
+	"\n" +
+	"Diagnostic\x12\x1a\n" +
+	"\bseverity\x18\x01 \x01(\tR\bseverity\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x16\n" +
+	"\x06source\x18\x04 \x01(\tR\x06source\x12\x12\n" +
+	"\x04line\x18\x05 \x01(\x05R\x04line\x12\x16\n" +
+	"\x06column\x18\x06 \x01(\x05R\x06column\x12\x12\n" +
+	"\x04tags\x18\a \x03(\tR\x04tagsB*Z(github.com/sourcegraph/scip/cmd/scip/rstb\x06proto3"
 
 var (
 	file_rst_proto_rawDescOnce sync.Once
@@ -317,26 +436,28 @@ func file_rst_proto_rawDescGZIP() []byte {
 	return file_rst_proto_rawDescData
 }
 
-var file_rst_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_rst_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_rst_proto_goTypes = []any{
-	(*RST)(nil),      // 0: rst.RST
-	(*Metadata)(nil), // 1: rst.Metadata
-	(*Document)(nil), // 2: rst.Document
-	(*Symbol)(nil),   // 3: rst.Symbol
-	nil,              // 4: rst.RST.DocumentsEntry
-	nil,              // 5: rst.Document.SymbolsEntry
+	(*RST)(nil),        // 0: rst.RST
+	(*Metadata)(nil),   // 1: rst.Metadata
+	(*Document)(nil),   // 2: rst.Document
+	(*Symbol)(nil),     // 3: rst.Symbol
+	(*Diagnostic)(nil), // 4: rst.Diagnostic
+	nil,                // 5: rst.RST.DocumentsEntry
+	nil,                // 6: rst.Document.SymbolsEntry
 }
 var file_rst_proto_depIdxs = []int32{
 	1, // 0: rst.RST.metadata:type_name -> rst.Metadata
-	4, // 1: rst.RST.documents:type_name -> rst.RST.DocumentsEntry
-	5, // 2: rst.Document.symbols:type_name -> rst.Document.SymbolsEntry
-	2, // 3: rst.RST.DocumentsEntry.value:type_name -> rst.Document
-	3, // 4: rst.Document.SymbolsEntry.value:type_name -> rst.Symbol
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	5, // 1: rst.RST.documents:type_name -> rst.RST.DocumentsEntry
+	6, // 2: rst.Document.symbols:type_name -> rst.Document.SymbolsEntry
+	4, // 3: rst.Document.diagnostics:type_name -> rst.Diagnostic
+	2, // 4: rst.RST.DocumentsEntry.value:type_name -> rst.Document
+	3, // 5: rst.Document.SymbolsEntry.value:type_name -> rst.Symbol
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_rst_proto_init() }
@@ -350,7 +471,7 @@ func file_rst_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_rst_proto_rawDesc), len(file_rst_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+// Formats of the RSTs written by 'scip parse' and read by 'scip cli'.
+const (
+	rstFormatProto  = "rst"
+	rstFormatSQLite = "sqlite"
+)
+
+// rstDBFile is the name of the SQLite database in the output directory. It
+// holds the RSTs of every repo and language parsed into that directory.
+const rstDBFile = "rst.db"
+
+func rstFormatFlag(storage *string) *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:        "format",
+		Usage:       "Format of the RSTs: rst (one protobuf file per repo and language) or sqlite (" + rstDBFile + ")",
+		Destination: storage,
+		Value:       rstFormatProto,
+	}
+}
+
+func checkRSTFormat(format string) error {
+	switch format {
+	case rstFormatProto, rstFormatSQLite:
+		return nil
+	}
+	return errors.Newf("unknown format %q, expected %q or %q", format, rstFormatProto, rstFormatSQLite)
+}
+
+// rstSchema stores the RST model relationally. Symbols reference each other
+// by their full SCIP symbol, like in RST files, so edges may point at
+// symbols defined in other repos.
+var rstSchema = []string{
+	`CREATE TABLE IF NOT EXISTS rsts (
+		id INTEGER PRIMARY KEY,
+		repo TEXT NOT NULL,
+		language TEXT NOT NULL,
+		project_root TEXT,
+		UNIQUE (repo, language)
+	);`,
+	`CREATE TABLE IF NOT EXISTS documents (
+		id INTEGER PRIMARY KEY,
+		rst_id INTEGER NOT NULL,
+		relative_path TEXT NOT NULL,
+		UNIQUE (rst_id, relative_path),
+		FOREIGN KEY (rst_id) REFERENCES rsts(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS symbols (
+		id INTEGER PRIMARY KEY,
+		document_id INTEGER NOT NULL,
+		symbol TEXT NOT NULL,
+		name TEXT NOT NULL,
+		kind TEXT,
+		signature TEXT,
+		line INTEGER NOT NULL,
+		code TEXT,
+		FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+	);`,
+	// An edge means that source depends on target, i.e. target is
+	// referenced within the definition of source.
+	`CREATE TABLE IF NOT EXISTS edges (
+		id INTEGER PRIMARY KEY,
+		rst_id INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		UNIQUE (rst_id, source, target),
+		FOREIGN KEY (rst_id) REFERENCES rsts(id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS diagnostics (
+		id INTEGER PRIMARY KEY,
+		document_id INTEGER NOT NULL,
+		severity TEXT,
+		code TEXT,
+		message TEXT NOT NULL,
+		source TEXT,
+		line INTEGER NOT NULL,
+		column INTEGER NOT NULL,
+		tags TEXT,
+		FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_symbols_document ON symbols(document_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_symbols_symbol ON symbols(symbol);`,
+	`CREATE INDEX IF NOT EXISTS idx_symbols_name ON symbols(name);`,
+	`CREATE INDEX IF NOT EXISTS idx_edges_source ON edges(source);`,
+	`CREATE INDEX IF NOT EXISTS idx_edges_target ON edges(target);`,
+	`CREATE INDEX IF NOT EXISTS idx_diagnostics_document ON diagnostics(document_id);`,
+}
+
+// writeRSTDatabase stores rsts in the SQLite database at path, replacing
+// earlier RSTs of the same repo and language.
+func writeRSTDatabase(path string, rsts map[string]*rst.RST) (err error) {
+	conn, err := sqlite.OpenConn(path, sqlite.OpenCreate|sqlite.OpenReadWrite|sqlite.OpenWAL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open SQLite database at %s", path)
+	}
+	defer func() {
+		err = errors.CombineErrors(err, conn.Close())
+	}()
+
+	if err := executeAll(conn, []string{
+		`PRAGMA synchronous = normal;`,
+		`PRAGMA foreign_keys = ON;`,
+		`PRAGMA journal_mode = WAL;`,
+	}); err != nil {
+		return err
+	}
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer endFn(&err)
+
+	if err := executeAll(conn, rstSchema); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(rsts))
+	for name := range rsts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := rstDBWriter{conn: conn}
+	for _, name := range names {
+		if err := w.insertRST(rsts[name]); err != nil {
+			return errors.Wrapf(err, "failed to store %s", name)
+		}
+	}
+	return nil
+}
+
+type rstDBWriter struct {
+	conn *sqlite.Conn
+}
+
+func (w rstDBWriter) insertRST(r *rst.RST) error {
+	metadata := r.GetMetadata()
+	if err := sqlitex.Execute(w.conn, `DELETE FROM rsts WHERE repo = ? AND language = ?`, &sqlitex.ExecOptions{
+		Args: []any{metadata.GetRepo(), metadata.GetLanguage()},
+	}); err != nil {
+		return errors.Wrap(err, "failed to delete previous RST")
+	}
+	rstID, err := w.insertReturningID(`INSERT INTO rsts (repo, language, project_root) VALUES (?, ?, ?) RETURNING id`,
+		metadata.GetRepo(), metadata.GetLanguage(), nullIfEmpty(metadata.GetProjectRoot()))
+	if err != nil {
+		return errors.Wrap(err, "failed to insert RST")
+	}
+
+	paths := make([]string, 0, len(r.Documents))
+	for path := range r.Documents {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := w.insertDocument(rstID, path, r.Documents[path]); err != nil {
+			return errors.Wrapf(err, "in document %q", path)
+		}
+	}
+	return nil
+}
+
+func (w rstDBWriter) insertDocument(rstID int64, path string, doc *rst.Document) error {
+	docID, err := w.insertReturningID(`INSERT INTO documents (rst_id, relative_path) VALUES (?, ?) RETURNING id`,
+		rstID, path)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert document")
+	}
+
+	symbolStmt := w.conn.Prep(`INSERT INTO symbols (document_id, symbol, name, kind, signature, line, code)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	edgeStmt := w.conn.Prep(`INSERT INTO edges (rst_id, source, target) VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING`)
+	insertEdge := func(source, target string) error {
+		edgeStmt.BindInt64(1, rstID)
+		edgeStmt.BindText(2, source)
+		edgeStmt.BindText(3, target)
+		if _, err := edgeStmt.Step(); err != nil {
+			return errors.Wrapf(err, "failed to insert edge from %q to %q", source, target)
+		}
+		return edgeStmt.Reset()
+	}
+
+	symbols := make([]string, 0, len(doc.Symbols))
+	for symbol := range doc.Symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		sym := doc.Symbols[symbol]
+		symbolStmt.BindInt64(1, docID)
+		symbolStmt.BindText(2, symbol)
+		symbolStmt.BindText(3, extractSymbolName(symbol))
+		bindTextOrNull(symbolStmt, 4, sym.Kind)
+		bindTextOrNull(symbolStmt, 5, sym.Signature)
+		symbolStmt.BindInt64(6, int64(sym.Line))
+		bindTextOrNull(symbolStmt, 7, sym.Code)
+		if _, err := symbolStmt.Step(); err != nil {
+			return errors.Wrapf(err, "failed to insert symbol %q", symbol)
+		}
+		if err := symbolStmt.Reset(); err != nil {
+			return err
+		}
+		for _, dep := range sym.DependenceOn {
+			if err := insertEdge(symbol, dep); err != nil {
+				return err
+			}
+		}
+		for _, ref := range sym.ReferenceBy {
+			if err := insertEdge(ref, symbol); err != nil {
+				return err
+			}
+		}
+	}
+
+	diagStmt := w.conn.Prep(`INSERT INTO diagnostics (document_id, severity, code, message, source, line, column, tags)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	for _, diag := range doc.Diagnostics {
+		diagStmt.BindInt64(1, docID)
+		bindTextOrNull(diagStmt, 2, diag.Severity)
+		bindTextOrNull(diagStmt, 3, diag.Code)
+		diagStmt.BindText(4, diag.Message)
+		bindTextOrNull(diagStmt, 5, diag.Source)
+		diagStmt.BindInt64(6, int64(diag.Line))
+		diagStmt.BindInt64(7, int64(diag.Column))
+		bindTextOrNull(diagStmt, 8, strings.Join(diag.Tags, ","))
+		if _, err := diagStmt.Step(); err != nil {
+			return errors.Wrap(err, "failed to insert diagnostic")
+		}
+		if err := diagStmt.Reset(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w rstDBWriter) insertReturningID(query string, args ...any) (id int64, err error) {
+	err = sqlitex.Execute(w.conn, query, &sqlitex.ExecOptions{
+		Args: args,
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			id = stmt.ColumnInt64(0)
+			return nil
+		},
+	})
+	return id, err
+}
+
+func bindTextOrNull(stmt *sqlite.Stmt, param int, value string) {
+	if value == "" {
+		stmt.BindNull(param)
+	} else {
+		stmt.BindText(param, value)
+	}
+}
+
+// nullIfEmpty maps empty strings to NULL for sqlitex.ExecOptions.Args.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// openRSTDatabase opens the database written by 'scip parse --format
+// sqlite' to outputDir for reading.
+func openRSTDatabase(outputDir string) (*sqlite.Conn, error) {
+	path := filepath.Join(outputDir, rstDBFile)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("RST database not found: %s", path)
+		}
+		return nil, errors.Wrapf(err, "failed to stat %s", path)
+	}
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open SQLite database at %s", path)
+	}
+	return conn, nil
+}
+
+// queryDBFiles returns the relative paths of the files of repo, in every
+// language.
+func queryDBFiles(conn *sqlite.Conn, repo string) ([]string, error) {
+	var paths []string
+	err := sqlitex.Execute(conn, `SELECT d.relative_path FROM documents d
+		JOIN rsts r ON r.id = d.rst_id
+		WHERE r.repo = ?
+		ORDER BY d.relative_path`, &sqlitex.ExecOptions{
+		Args: []any{repo},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			paths = append(paths, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list files of %s", repo)
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("repo not found in RST database: %s", repo)
+	}
+	return paths, nil
+}
+
+// queryDBFileSymbols returns the symbols defined in filePath, ordered by
+// line, or an error if the repo has no such file, like getSymbolsFromRST.
+func queryDBFileSymbols(conn *sqlite.Conn, repo, filePath string) ([]SymbolInfo, error) {
+	found := false
+	var symbols []SymbolInfo
+	err := sqlitex.Execute(conn, `SELECT s.name, s.signature, s.line FROM documents d
+		JOIN rsts r ON r.id = d.rst_id
+		LEFT JOIN symbols s ON s.document_id = d.id
+		WHERE r.repo = ? AND d.relative_path = ?
+		ORDER BY s.line, s.symbol`, &sqlitex.ExecOptions{
+		Args: []any{repo, filePath},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			found = true
+			// Documents without symbols have a single row of NULLs.
+			if stmt.ColumnType(0) == sqlite.TypeNull {
+				return nil
+			}
+			symbols = append(symbols, SymbolInfo{
+				Name:      stmt.ColumnText(0),
+				Signature: stmt.ColumnText(1),
+				Line:      int32(stmt.ColumnInt64(2)),
+			})
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list symbols of %s", filePath)
+	}
+	if !found {
+		return nil, errors.Errorf("file not found: %s", filePath)
+	}
+	return symbols, nil
+}
+
+// queryDBSymbolDetails finds a symbol of filePath by name, and by line if
+// it is positive, like getSymbolDetails does for RST files.
+func queryDBSymbolDetails(conn *sqlite.Conn, repo, filePath, symbolName string, line int32) (*SymbolDetails, error) {
+	var details *SymbolDetails
+	var rstID int64
+	var symbol string
+	err := sqlitex.Execute(conn, `SELECT r.id, s.symbol, s.name, s.signature, s.line, s.code FROM symbols s
+		JOIN documents d ON d.id = s.document_id
+		JOIN rsts r ON r.id = d.rst_id
+		WHERE r.repo = $repo AND d.relative_path = $path
+		AND (s.name = $name OR substr(s.name, -length($name) - 1) = '.' || $name)
+		AND ($line <= 0 OR s.line = $line)
+		ORDER BY s.line
+		LIMIT 1`, &sqlitex.ExecOptions{
+		Named: map[string]any{"$repo": repo, "$path": filePath, "$name": symbolName, "$line": line},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			rstID = stmt.ColumnInt64(0)
+			symbol = stmt.ColumnText(1)
+			details = &SymbolDetails{
+				Name:      stmt.ColumnText(2),
+				Signature: stmt.ColumnText(3),
+				FilePath:  filePath,
+				Line:      int32(stmt.ColumnInt64(4)),
+				Code:      stmt.ColumnText(5),
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to look up symbol %s", symbolName)
+	}
+	if details == nil {
+		return nil, errors.Errorf("symbol not found: %s", symbolName)
+	}
+
+	collect := func(query string, into *[]string) error {
+		return sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{rstID, symbol},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				*into = append(*into, stmt.ColumnText(0))
+				return nil
+			},
+		})
+	}
+	if err := collect(`SELECT target FROM edges WHERE rst_id = ? AND source = ? ORDER BY id`, &details.Dependencies); err != nil {
+		return nil, errors.Wrapf(err, "failed to look up dependencies of %s", symbolName)
+	}
+	if err := collect(`SELECT source FROM edges WHERE rst_id = ? AND target = ? ORDER BY id`, &details.References); err != nil {
+		return nil, errors.Wrapf(err, "failed to look up references of %s", symbolName)
+	}
+	return details, nil
+}
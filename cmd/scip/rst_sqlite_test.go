@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+func TestRSTDatabase_CLI(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeRSTDatabase(filepath.Join(dir, rstDBFile), tuiFixture()))
+
+	run := func(fn func(out *bytes.Buffer) error) string {
+		var out bytes.Buffer
+		require.NoError(t, fn(&out))
+		return out.String()
+	}
+
+	autogold.Expect(`{"files":{"cmd":["main.go"],"server":["server.go"]}}
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return treeRepoMain(dir, "demo", rstFormatSQLite, out)
+	}))
+	autogold.Expect(`{"file_path":"server/server.go","mod_path":"demo","pkg_path":"demo/bindings/go/scip","nodes":[{"name":"Start","signature":"func Start()","line":3},{"name":"handle","signature":"func handle()","line":7}]}
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return getFileStructureMain(dir, "demo", "server/server.go", rstFormatSQLite, out)
+	}))
+	autogold.Expect(`{"mod_path":"demo","pkg_path":"demo/bindings/go/scip","file_path":"server/server.go","nodes":[{"name":"Start","signature":"func Start()","line":3,"dependencies":[{"file_path":"server/server.go","names":["handle"]}],"references":[{"file_path":"server/server.go","names":["main"]}],"codes":"func Start() {\n\thandle()\n}"}]}
+`).Equal(t, run(func(out *bytes.Buffer) error {
+		return getFileSymbolMain(dir, "demo", "server/server.go", "Start", "", rstFormatSQLite, out)
+	}))
+
+	// The RST files give the same answer for queries with a single result.
+	writeParsedRSTs(t, dir, tuiFixture())
+	for _, args := range [][]string{{"Start", ""}, {"main", "5"}, {"Logf", ""}} {
+		repo, file := "demo", "server/server.go"
+		switch args[0] {
+		case "main":
+			file = "cmd/main.go"
+		case "Logf":
+			repo, file = "lib", "log/log.go"
+		}
+		require.Equal(t,
+			run(func(out *bytes.Buffer) error {
+				return getFileSymbolMain(dir, repo, file, args[0], args[1], rstFormatProto, out)
+			}),
+			run(func(out *bytes.Buffer) error {
+				return getFileSymbolMain(dir, repo, file, args[0], args[1], rstFormatSQLite, out)
+			}))
+	}
+
+	err := getFileSymbolMain(dir, "demo", "server/server.go", "Start", "4", rstFormatSQLite, &bytes.Buffer{})
+	require.ErrorContains(t, err, "symbol not found: Start")
+	// Files without symbols have no nodes in both formats.
+	withEmpty := tuiFixture()
+	withEmpty[repoToRSTFile("demo")].Documents["empty.go"] = &rst.Document{RelativePath: "empty.go"}
+	emptyDir := t.TempDir()
+	require.NoError(t, writeRSTDatabase(filepath.Join(emptyDir, rstDBFile), withEmpty))
+	writeParsedRSTs(t, emptyDir, withEmpty)
+	emptyStructure := run(func(out *bytes.Buffer) error {
+		return getFileStructureMain(emptyDir, "demo", "empty.go", rstFormatSQLite, out)
+	})
+	require.Contains(t, emptyStructure, `"nodes":[]`)
+	require.Equal(t, run(func(out *bytes.Buffer) error {
+		return getFileStructureMain(emptyDir, "demo", "empty.go", rstFormatProto, out)
+	}), emptyStructure)
+
+	// Unknown files are errors in both formats.
+	for _, format := range []string{rstFormatProto, rstFormatSQLite} {
+		err = getFileStructureMain(dir, "demo", "missing.go", format, &bytes.Buffer{})
+		require.ErrorContains(t, err, "file not found: missing.go")
+	}
+	err = treeRepoMain(dir, "missing", rstFormatSQLite, &bytes.Buffer{})
+	require.ErrorContains(t, err, "repo not found in RST database: missing")
+	err = treeRepoMain(t.TempDir(), "demo", rstFormatSQLite, &bytes.Buffer{})
+	require.ErrorContains(t, err, "RST database not found")
+}
+
+// writeParsedRSTs writes rsts to dir under the file names 'scip parse' gives
+// them, which the rst commands look repos up by.
+func writeParsedRSTs(t *testing.T, dir string, rsts map[string]*rst.RST) {
+	t.Helper()
+	for _, r := range rsts {
+		name := fmt.Sprintf("%s.%s.rst", sanitizeRepoID(r.Metadata.Repo), r.Metadata.Language)
+		require.NoError(t, writeRST(filepath.Join(dir, name), r))
+	}
+}
+
+func TestRSTDatabase_Reparse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), rstDBFile)
+	fixture := tuiFixture()
+	require.NoError(t, writeRSTDatabase(path, fixture))
+
+	// Parsing a repo again replaces its rows and keeps the other repos.
+	demo := fixture[repoToRSTFile("demo")]
+	delete(demo.Documents, "cmd/main.go")
+	require.NoError(t, writeRSTDatabase(path, map[string]*rst.RST{repoToRSTFile("demo"): demo}))
+
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	count := func(query string) int64 {
+		var n int64
+		require.NoError(t, sqlitex.ExecuteTransient(conn, query, &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				n = stmt.ColumnInt64(0)
+				return nil
+			},
+		}))
+		return n
+	}
+	require.Equal(t, int64(2), count(`SELECT count(*) FROM rsts`))
+	require.Equal(t, int64(2), count(`SELECT count(*) FROM documents`))
+	require.Equal(t, int64(4), count(`SELECT count(*) FROM symbols`))
+	require.Equal(t, int64(2), count(`SELECT count(*) FROM diagnostics`))
+
+	// Fan-in counts the symbols whose definitions reference a symbol.
+	var fanIn []string
+	require.NoError(t, sqlitex.ExecuteTransient(conn, `SELECT target, count(*) AS fan_in FROM edges
+		GROUP BY target ORDER BY fan_in DESC, target LIMIT 20`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			fanIn = append(fanIn, extractSymbolName(stmt.ColumnText(0)))
+			return nil
+		},
+	}))
+	autogold.Expect([]string{"Start", "handle", "Logf"}).Equal(t, fanIn)
+}
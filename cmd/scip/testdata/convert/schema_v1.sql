@@ -0,0 +1,64 @@
+-- A database created by 'scip expt-convert' with schema version 1, before the
+-- version was recorded in PRAGMA user_version. Dumped with the sqlite3 .dump
+-- command.
+CREATE TABLE documents (
+			id INTEGER PRIMARY KEY,
+			language TEXT,
+			relative_path TEXT NOT NULL UNIQUE,
+			position_encoding TEXT,
+			text TEXT
+		);
+INSERT INTO documents VALUES(1,'go','a.go',NULL,NULL);
+INSERT INTO documents VALUES(2,'go','b.go',NULL,NULL);
+CREATE TABLE chunks (
+			id INTEGER PRIMARY KEY,
+			document_id INTEGER NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			occurrences BLOB NOT NULL,
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		);
+INSERT INTO chunks VALUES(1,1,0,10,12,X'28b52ffd040051020012260a030a05071217736369702d676f20676f202e202e20706b67312f53312318013a040a000d0112100a030b010212076c6f63616c20301801120e0a030c040512076c6f63616c2030e7f55905');
+INSERT INTO chunks VALUES(2,2,0,3,3,X'28b52ffd0400c50100f40212210a030305061218736369702d676f20676f202e202e20706b67312f4628292e1801121e0a0303090b12175331230154170511340189e40058');
+CREATE TABLE global_symbols (
+			id INTEGER PRIMARY KEY,
+			symbol TEXT NOT NULL UNIQUE,
+			display_name TEXT,
+			kind INTEGER,
+			documentation TEXT,
+			signature BLOB,
+			enclosing_symbol TEXT,
+			relationships BLOB
+		);
+INSERT INTO global_symbols VALUES(1,'scip-go go . . pkg1/S1#','S1',49,'S1 is a struct.',NULL,NULL,NULL);
+INSERT INTO global_symbols VALUES(2,'scip-go go . . pkg1/F().',NULL,NULL,NULL,NULL,NULL,NULL);
+CREATE TABLE mentions (
+			chunk_id INTEGER NOT NULL,
+			symbol_id INTEGER NOT NULL,
+			role INTEGER NOT NULL,
+			PRIMARY KEY (chunk_id, symbol_id, role),
+			FOREIGN KEY (chunk_id) REFERENCES chunks(id),
+			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+		);
+INSERT INTO mentions VALUES(1,1,1);
+INSERT INTO mentions VALUES(2,2,1);
+INSERT INTO mentions VALUES(2,1,0);
+CREATE TABLE defn_enclosing_ranges (
+			id INTEGER PRIMARY KEY,
+			document_id INTEGER NOT NULL,
+			symbol_id INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			start_char INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			end_char INTEGER NOT NULL,
+			FOREIGN KEY (document_id) REFERENCES documents(id),
+			FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+		);
+INSERT INTO defn_enclosing_ranges VALUES(1,1,1,10,0,13,1);
+CREATE INDEX idx_chunks_line_range ON chunks(document_id, start_line, end_line);
+CREATE INDEX idx_mentions_symbol_id_role ON mentions(symbol_id, role);
+CREATE INDEX idx_defn_enclosing_ranges_symbol_id ON defn_enclosing_ranges(symbol_id);
+CREATE INDEX idx_defn_enclosing_ranges_document ON defn_enclosing_ranges(document_id, start_line, end_line);
+CREATE INDEX idx_chunks_doc_id ON chunks(document_id);
+CREATE INDEX idx_global_symbols_symbol ON global_symbols(symbol);
@@ -0,0 +1,138 @@
+-- A database created by 'scip expt-convert' with schema version 3. Dumped with
+-- the sqlite3 .dump command, which omits PRAGMA user_version, so it was added
+-- by hand.
+/* WARNING: Script requires that SQLITE_DBCONFIG_DEFENSIVE be disabled */
+CREATE TABLE indexes (
+		id INTEGER PRIMARY KEY,
+		repo TEXT,
+		commit_id TEXT,
+		project_root TEXT,
+		tool_name TEXT,
+		tool_version TEXT,
+		tool_arguments TEXT,
+		text_encoding TEXT,
+		protocol_version INTEGER,
+		created_at TEXT NOT NULL
+	);
+INSERT INTO indexes VALUES(1,'example','abc123','file:///repo','scip-go',NULL,'null',NULL,0,'2026-10-18T16:27:48Z');
+CREATE TABLE documents (
+		id INTEGER PRIMARY KEY,
+		index_id INTEGER NOT NULL,
+		language TEXT,
+		relative_path TEXT NOT NULL,
+		position_encoding TEXT,
+		text TEXT,
+		UNIQUE (index_id, relative_path),
+		FOREIGN KEY (index_id) REFERENCES indexes(id)
+	);
+INSERT INTO documents VALUES(1,1,'go','a.go',NULL,NULL);
+INSERT INTO documents VALUES(2,1,'go','b.go',NULL,NULL);
+CREATE TABLE chunks (
+		id INTEGER PRIMARY KEY,
+		index_id INTEGER NOT NULL,
+		document_id INTEGER NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		start_line INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		occurrences BLOB NOT NULL,
+		FOREIGN KEY (index_id) REFERENCES indexes(id),
+		FOREIGN KEY (document_id) REFERENCES documents(id)
+	);
+INSERT INTO chunks VALUES(1,1,1,0,10,12,X'28b52ffd040051020012260a030a05071217736369702d676f20676f202e202e20706b67312f53312318013a040a000d0112100a030b010212076c6f63616c20301801120e0a030c040512076c6f63616c2030e7f55905');
+INSERT INTO chunks VALUES(2,1,2,0,3,3,X'28b52ffd0400350300d40512210a030305061218736369702d676f20676f202e202e20706b67312f4628292e1801124c0a0303090b1217533123322c080212065341313031391a1053312069732064657072656361746564220b737461746963636865636b2a010201541705113401516e3345');
+CREATE TABLE global_symbols (
+		id INTEGER PRIMARY KEY,
+		index_id INTEGER NOT NULL,
+		symbol TEXT NOT NULL,
+		display_name TEXT,
+		kind INTEGER,
+		documentation TEXT,
+		signature BLOB,
+		enclosing_symbol TEXT,
+		info_source INTEGER NOT NULL,
+		UNIQUE (index_id, symbol),
+		FOREIGN KEY (index_id) REFERENCES indexes(id)
+	);
+INSERT INTO global_symbols VALUES(1,1,'scip-go go . . pkg1/S1#','S1',49,'S1 is a struct.',NULL,NULL,2);
+INSERT INTO global_symbols VALUES(2,1,'scip-go go . . pkg1/F().',NULL,NULL,NULL,NULL,NULL,2);
+CREATE TABLE relationships (
+		symbol_id INTEGER NOT NULL,
+		related_symbol_id INTEGER NOT NULL,
+		is_reference INTEGER NOT NULL,
+		is_implementation INTEGER NOT NULL,
+		is_type_definition INTEGER NOT NULL,
+		is_definition INTEGER NOT NULL,
+		PRIMARY KEY (symbol_id, related_symbol_id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id),
+		FOREIGN KEY (related_symbol_id) REFERENCES global_symbols(id)
+	);
+CREATE TABLE document_symbols (
+		document_id INTEGER NOT NULL,
+		symbol_id INTEGER NOT NULL,
+		PRIMARY KEY (document_id, symbol_id),
+		FOREIGN KEY (document_id) REFERENCES documents(id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+	);
+INSERT INTO document_symbols VALUES(1,1);
+INSERT INTO document_symbols VALUES(2,2);
+CREATE TABLE mentions (
+		chunk_id INTEGER NOT NULL,
+		symbol_id INTEGER NOT NULL,
+		role INTEGER NOT NULL,
+		PRIMARY KEY (chunk_id, symbol_id, role),
+		FOREIGN KEY (chunk_id) REFERENCES chunks(id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+	);
+INSERT INTO mentions VALUES(1,1,1);
+INSERT INTO mentions VALUES(2,2,1);
+INSERT INTO mentions VALUES(2,1,0);
+CREATE TABLE defn_enclosing_ranges (
+		id INTEGER PRIMARY KEY,
+		document_id INTEGER NOT NULL,
+		symbol_id INTEGER NOT NULL,
+		start_line INTEGER NOT NULL,
+		start_char INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		end_char INTEGER NOT NULL,
+		FOREIGN KEY (document_id) REFERENCES documents(id),
+		FOREIGN KEY (symbol_id) REFERENCES global_symbols(id)
+	);
+INSERT INTO defn_enclosing_ranges VALUES(1,1,1,10,0,13,1);
+PRAGMA writable_schema=ON;
+INSERT INTO sqlite_schema(type,name,tbl_name,rootpage,sql)VALUES('table','symbols_fts','symbols_fts',0,'CREATE VIRTUAL TABLE symbols_fts USING fts5(display_name, descriptors, documentation)');
+CREATE TABLE IF NOT EXISTS 'symbols_fts_data'(id INTEGER PRIMARY KEY, block BLOB);
+INSERT INTO symbols_fts_data VALUES(1,X'02010404');
+INSERT INTO symbols_fts_data VALUES(10,X'000000000102020002010101020101');
+INSERT INTO symbols_fts_data VALUES(137438953473,X'0000001702306602060101030104706b673102060101020408');
+INSERT INTO symbols_fts_data VALUES(274877906945,X'0000003902306101060102040102697301060102030104706b6731010601010201027331010e020101030102020205747275637401060102050408090b0d');
+CREATE TABLE IF NOT EXISTS 'symbols_fts_idx'(segid, term, pgno, PRIMARY KEY(segid, term)) WITHOUT ROWID;
+INSERT INTO symbols_fts_idx VALUES(1,X'',2);
+INSERT INTO symbols_fts_idx VALUES(2,X'',2);
+CREATE TABLE IF NOT EXISTS 'symbols_fts_content'(id INTEGER PRIMARY KEY, c0, c1, c2);
+INSERT INTO symbols_fts_content VALUES(1,'S1','pkg1 S1','S1 is a struct.');
+INSERT INTO symbols_fts_content VALUES(2,'','pkg1 F','');
+CREATE TABLE IF NOT EXISTS 'symbols_fts_docsize'(id INTEGER PRIMARY KEY, sz BLOB);
+INSERT INTO symbols_fts_docsize VALUES(1,X'010204');
+INSERT INTO symbols_fts_docsize VALUES(2,X'000200');
+CREATE TABLE IF NOT EXISTS 'symbols_fts_config'(k PRIMARY KEY, v) WITHOUT ROWID;
+INSERT INTO symbols_fts_config VALUES('version',4);
+INSERT INTO sqlite_schema(type,name,tbl_name,rootpage,sql)VALUES('table','documents_fts','documents_fts',0,'CREATE VIRTUAL TABLE documents_fts USING fts5(text)');
+CREATE TABLE IF NOT EXISTS 'documents_fts_data'(id INTEGER PRIMARY KEY, block BLOB);
+INSERT INTO documents_fts_data VALUES(1,X'');
+INSERT INTO documents_fts_data VALUES(10,X'00000000000000');
+CREATE TABLE IF NOT EXISTS 'documents_fts_idx'(segid, term, pgno, PRIMARY KEY(segid, term)) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS 'documents_fts_content'(id INTEGER PRIMARY KEY, c0);
+CREATE TABLE IF NOT EXISTS 'documents_fts_docsize'(id INTEGER PRIMARY KEY, sz BLOB);
+CREATE TABLE IF NOT EXISTS 'documents_fts_config'(k PRIMARY KEY, v) WITHOUT ROWID;
+INSERT INTO documents_fts_config VALUES('version',4);
+CREATE INDEX idx_chunks_line_range ON chunks(document_id, start_line, end_line);
+CREATE INDEX idx_mentions_symbol_id_role ON mentions(symbol_id, role);
+CREATE INDEX idx_defn_enclosing_ranges_symbol_id ON defn_enclosing_ranges(symbol_id);
+CREATE INDEX idx_defn_enclosing_ranges_document ON defn_enclosing_ranges(document_id, start_line, end_line);
+CREATE INDEX idx_chunks_doc_id ON chunks(document_id);
+CREATE INDEX idx_global_symbols_symbol ON global_symbols(symbol);
+CREATE INDEX idx_document_symbols_symbol_id ON document_symbols(symbol_id);
+CREATE INDEX idx_relationships_related_symbol_id ON relationships(related_symbol_id);
+CREATE INDEX idx_indexes_repo ON indexes(repo, id);
+PRAGMA writable_schema=OFF;
+PRAGMA user_version = 3;
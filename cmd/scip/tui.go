@@ -1,17 +1,21 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/urfave/cli/v2"
+	"github.com/sourcegraph/scip/bindings/go/scip"
 	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+	"github.com/urfave/cli/v2"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"google.golang.org/protobuf/proto"
@@ -19,82 +23,104 @@ import (
 
 const rstDefaultPath = "~/.rsts"
 
-var (
-	columnStyle = lipgloss.NewStyle().
-			BorderForeground(lipgloss.Color("240")).
-			BorderStyle(lipgloss.NormalBorder()).
-			Padding(0, 1)
-
-	activeColumnStyle = lipgloss.NewStyle().
-				BorderForeground(lipgloss.Color("63")).
-				BorderStyle(lipgloss.NormalBorder()).
-				Padding(0, 1)
-
-	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("5")).
-			Bold(true)
-
-	helpStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("8"))
-
-	depStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("6"))
-
-	refStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("3"))
-)
-
 // View modes
 const (
 	modeThreePane = iota
 	modeSymbol
+	modeCallGraph
+	modeDiagnostics
+	modeCompare
+	modeBookmarks
+	modeHistory
 )
 
 // Three-pane TUI model
 type model struct {
-	repos       list.Model
-	files       list.Model
-	symbols     list.Model
-	deps        list.Model
-	refs        list.Model
-	viewport    viewport.Model
-	mode        int
-	active      int // 0: repos, 1: files, 2: symbols
-	width       int
-	height      int
-	rstPath     string
-	symbol      *symbolDetail
-	symbolStack []symbolJump
+	repos        list.Model
+	files        list.Model
+	symbols      list.Model
+	deps         list.Model
+	refs         list.Model
+	viewport     viewport.Model
+	mode         int
+	active       int // 0: repos, 1: files, 2: symbols
+	width        int
+	height       int
+	store        rstStore
+	projectRoot  string // Overrides the project root recorded in RSTs
+	symbol       *symbolDetail
+	symbolStack  []symbolJump
+	status       string
+	refreshed    string // Status line for the last live reload
+	pendingFile  string // File to select once the files list has loaded
+	pendingSym   string // Symbol to select once the symbols list has loaded
+	rstModTimes  map[string]time.Time
+	watchEvery   time.Duration // How often RSTs are polled for changes, 0 to not watch them
+	callGraph    *callGraph
+	compare      *comparison
+	comparePaths []string // Old and new RST compared in modeCompare
+	keys         keyMap
+	panes        []int // Relative widths of the repos, files and symbols panes
+	diagnostics  list.Model
+	code         highlightedCode
+	codeOcc      int // Selected dependency occurrence in code, -1 if none
+
+	state        tuiState // Bookmarks and history, persisted in the RST directory
+	stateChanged bool     // Whether state must be saved once the message is handled
+	stateSaver   *stateSaver
+	bookmarks    list.Model
+	history      list.Model
+	note         textinput.Model
+	noteOpen     bool
+	noteTarget   location // Symbol being bookmarked while the note prompt is open
+
+	finder         list.Model
+	finderOpen     bool
+	finderAllRepos bool
 }
 
 type symbolJump struct {
 	name      string
 	signature string
 	line      int
+	repo      string
 	filePath  string
+	language  string
 	deps      []string
 	refs      []string
 	code      string
+	symbol    string
+	symbolKey string
 }
 
 // List items
 type repoItem struct{ name string }
-type fileItem struct{ name string }
+type fileItem struct {
+	name        string
+	diagnostics diagnosticCounts
+}
 type symbolItem struct {
 	name      string
+	symbol    string // Full SCIP symbol
 	signature string
 	line      int
 }
 type refItem struct {
-	name string
-	kind string // "dep" or "ref"
+	name   string
+	symbol string // Full SCIP symbol
+	kind   string // "dep" or "ref"
 }
 
 func (i repoItem) Title() string       { return i.name }
 func (i repoItem) Description() string { return "" }
 func (i repoItem) FilterValue() string { return i.name }
 
-func (i fileItem) Title() string       { return i.name }
+func (i fileItem) Title() string {
+	if counts := i.diagnostics.String(); counts != "" {
+		return i.name + "  " + counts
+	}
+	return i.name
+}
 func (i fileItem) Description() string { return "" }
 func (i fileItem) FilterValue() string { return i.name }
 
@@ -102,7 +128,7 @@ func (i symbolItem) Title() string       { return i.name }
 func (i symbolItem) Description() string { return fmt.Sprintf("%s (line %d)", i.signature, i.line) }
 func (i symbolItem) FilterValue() string { return i.name }
 
-func (i refItem) Title() string       { return i.name }
+func (i refItem) Title() string { return i.name }
 func (i refItem) Description() string {
 	if i.kind == "dep" {
 		return "dependency"
@@ -149,74 +175,206 @@ func newModel() model {
 		viewport: vp,
 		mode:     modeThreePane,
 		active:   0,
-		rstPath:  expandHome(rstDefaultPath),
+		store:    rstDir(expandHome(rstDefaultPath)),
+		finder:   newFinder(),
+		keys:     defaultKeyMap(),
+		panes:    defaultPanes,
+
+		diagnostics: newDiagnostics(),
+		bookmarks:   newLocationList("Bookmarks", "bookmark", "bookmarks"),
+		history:     newLocationList("History", "visit", "visits"),
+		note:        newNoteInput(),
+		stateSaver:  &stateSaver{},
+		watchEvery:  rstWatchInterval,
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return loadRepos(m.rstPath)
+	if m.mode == modeCompare {
+		return loadComparison(m.comparePaths[0], m.comparePaths[1], m.projectRoot)
+	}
+	return tea.Batch(loadRepos(m.store), watchRSTs(m.store, m.watchEvery), loadTUIState(m.store))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if m.mode == modeSymbol {
+	updated, cmd := m.update(msg)
+	if m, ok := updated.(model); ok && m.stateChanged {
+		m.stateChanged = false
+		return m, tea.Batch(cmd, m.saveState())
+	}
+	return updated, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if size, ok := msg.(tea.WindowSizeMsg); ok {
+		// Size every view, so that switching modes keeps the layout.
+		m.resize(size.Width, size.Height)
+		return m, nil
+	}
+	if mouse, ok := msg.(tea.MouseMsg); ok {
+		return m.updateMouse(mouse)
+	}
+	if m.finderOpen {
+		switch msg.(type) {
+		case reposLoadedMsg, filesLoadedMsg, symbolsLoadedMsg, symbolDetailMsg, errMsg,
+			rstWatchMsg, symbolsRefreshedMsg, callGraphMsg, diagnosticsLoadedMsg, diagnosticFileMsg,
+			tuiStateMsg:
+		default:
+			return m.updateFinder(msg)
+		}
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.noteOpen {
+		return m.updateNotePrompt(keyMsg)
+	}
+	switch msg := msg.(type) {
+	case tuiStateMsg:
+		m.mergeState(msg.state)
+		return m, nil
+	case rstWatchMsg:
+		return m.handleRSTChanges(msg)
+	case symbolsRefreshedMsg:
+		return m.applySymbolsRefresh(msg)
+	case reposLoadedMsg, filesLoadedMsg, symbolsLoadedMsg:
+		// Keep the three-pane lists up to date in every mode
+		return m.updateThreePaneMode(msg)
+	case callGraphMsg:
+		m.callGraph = newCallGraph(msg)
+		m.mode = modeCallGraph
+		return m, nil
+	case editorTargetMsg:
+		return m, openEditor(msg.path, msg.line)
+	case diagnosticsLoadedMsg:
+		m.diagnostics.Title = fmt.Sprintf("Diagnostics in %s", msg.repo)
+		m.diagnostics.SetItems(msg.items)
+		m.mode = modeDiagnostics
+		return m, nil
+	case diagnosticFileMsg:
+		cmd := m.openFinderItem(finderItem{repo: msg.repo, path: msg.path})
+		m.active = 1
+		return m, cmd
+	}
+	switch m.mode {
+	case modeSymbol:
 		return m.updateSymbolMode(msg)
+	case modeCallGraph:
+		return m.updateCallGraphMode(msg)
+	case modeDiagnostics:
+		return m.updateDiagnosticsMode(msg)
+	case modeCompare:
+		return m.updateCompareMode(msg)
+	case modeBookmarks, modeHistory:
+		return m.updateLocationsMode(msg)
 	}
 	return m.updateThreePaneMode(msg)
 }
 
+func (m *model) resize(width, height int) {
+	m.width = width
+	m.height = height
+
+	h := height - 4
+	total := 0
+	for _, p := range m.panes {
+		total += p
+	}
+	// Pane widths include the border and padding of columnStyle.
+	m.repos.SetSize(max(width*m.panes[0]/total-columnChrome, 1), h)
+	m.files.SetSize(max(width*m.panes[1]/total-columnChrome, 1), h)
+	m.symbols.SetSize(max(width*m.panes[2]/total-columnChrome, 1), h)
+
+	m.viewport.Width = width
+	m.viewport.Height = height - 8
+	m.deps.SetSize(width, 6)
+	m.refs.SetSize(width, 6)
+
+	m.finder.SetSize(width*3/5, height*7/10)
+	m.diagnostics.SetSize(width, height-2)
+	m.bookmarks.SetSize(width, height-2)
+	m.history.SetSize(width, height-2)
+	if m.compare != nil {
+		m.compare.resize(width, height, m.panes)
+	}
+}
+
 func (m model) updateThreePaneMode(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
 	switch msg := msg.(type) {
-	case tea.WindowSizeMsg:
-		m.width = msg.Width
-		m.height = msg.Height
-		h := msg.Height - 4
-		colWidth := msg.Width / 10
-		m.repos.SetSize(colWidth*2, h)  // 20%
-		m.files.SetSize(colWidth*4, h)  // 40%
-		m.symbols.SetSize(colWidth*4, h) // 40%
-		return m, nil
-
 	case reposLoadedMsg:
+		// Keep the selected repo when the list is reloaded
+		selected, _ := m.repos.SelectedItem().(repoItem)
 		m.repos.SetItems(msg.items)
 		if len(msg.items) > 0 {
-			repo := msg.items[0].(repoItem)
-			cmd = loadFiles(m.rstPath, repo.name)
+			idx := max(0, indexOfItem(msg.items, func(it list.Item) bool {
+				return it.(repoItem).name == selected.name
+			}))
+			m.repos.Select(idx)
+			repo := msg.items[idx].(repoItem)
+			cmd = loadFiles(m.store, repo.name)
 		}
 		return m, cmd
 
 	case filesLoadedMsg:
 		m.files.SetItems(msg.items)
 		if len(msg.items) > 0 {
+			idx := 0
+			if m.pendingFile != "" {
+				idx = max(0, indexOfItem(msg.items, func(it list.Item) bool {
+					return it.(fileItem).name == m.pendingFile
+				}))
+				m.pendingFile = ""
+			}
+			m.files.Select(idx)
 			repo := m.repos.SelectedItem().(repoItem)
-			file := msg.items[0].(fileItem)
-			cmd = loadSymbols(m.rstPath, repo.name, file.name)
+			file := msg.items[idx].(fileItem)
+			cmd = loadSymbols(m.store, repo.name, file.name)
 		}
 		return m, cmd
 
 	case symbolsLoadedMsg:
 		m.symbols.SetItems(msg.items)
+		if m.pendingSym != "" {
+			if idx := indexOfItem(msg.items, func(it list.Item) bool {
+				return it.(symbolItem).symbol == m.pendingSym
+			}); idx >= 0 {
+				m.symbols.Select(idx)
+			}
+			m.pendingSym = ""
+		}
 		return m, nil
 
 	case symbolDetailMsg:
-		m.symbol = &msg.detail
+		m.showSymbol(msg.detail)
 		m.mode = modeSymbol
-		m.viewport.SetContent(msg.detail.code)
-		m.deps.SetItems(makeDepsItems(msg.detail.deps))
-		m.refs.SetItems(makeRefsItems(msg.detail.refs))
 		m.active = 0 // 0: code view
 		return m, nil
 
 	case errMsg:
-		fmt.Fprintf(os.Stderr, "Error: %v\n", msg.err)
+		m.status = fmt.Sprintf("Error: %v", msg.err)
 		return m, nil
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "ctrl+c":
+		switch {
+		case key.Matches(msg, m.keys.Quit):
 			return m, tea.Quit
-		case "j":
+		case key.Matches(msg, m.keys.Find):
+			return m, m.openFinder()
+		case key.Matches(msg, m.keys.Edit):
+			return m, m.editSelection()
+		case key.Matches(msg, m.keys.Diagnostics):
+			if repo, ok := m.repos.SelectedItem().(repoItem); ok {
+				return m, loadDiagnostics(m.store, repo.name)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Bookmark):
+			return m, m.openNotePrompt()
+		case key.Matches(msg, m.keys.Bookmarks):
+			m.showBookmarks()
+			return m, nil
+		case key.Matches(msg, m.keys.History):
+			m.showHistory()
+			return m, nil
+		case key.Matches(msg, m.keys.Down):
 			switch m.active {
 			case 0:
 				m.repos.CursorDown()
@@ -225,18 +383,8 @@ func (m model) updateThreePaneMode(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case 2:
 				m.symbols.CursorDown()
 			}
-			// Sync selection and load data
-			if len(m.repos.Items()) > 0 && m.active == 0 {
-				repo := m.repos.SelectedItem().(repoItem)
-				cmd = loadFiles(m.rstPath, repo.name)
-			}
-			if len(m.files.Items()) > 0 && m.active == 1 {
-				repo := m.repos.SelectedItem().(repoItem)
-				file := m.files.SelectedItem().(fileItem)
-				cmd = loadSymbols(m.rstPath, repo.name, file.name)
-			}
-			return m, cmd
-		case "k":
+			return m, m.syncSelection()
+		case key.Matches(msg, m.keys.Up):
 			switch m.active {
 			case 0:
 				m.repos.CursorUp()
@@ -245,132 +393,146 @@ func (m model) updateThreePaneMode(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case 2:
 				m.symbols.CursorUp()
 			}
-			// Sync selection and load data
-			if len(m.repos.Items()) > 0 && m.active == 0 {
-				repo := m.repos.SelectedItem().(repoItem)
-				cmd = loadFiles(m.rstPath, repo.name)
-			}
-			if len(m.files.Items()) > 0 && m.active == 1 {
-				repo := m.repos.SelectedItem().(repoItem)
-				file := m.files.SelectedItem().(fileItem)
-				cmd = loadSymbols(m.rstPath, repo.name, file.name)
-			}
-			return m, cmd
-		case "h":
+			return m, m.syncSelection()
+		case key.Matches(msg, m.keys.Left):
 			// Move focus left (no wrap)
 			if m.active > 0 {
 				m.active--
 			}
-		case "l":
+		case key.Matches(msg, m.keys.Right):
 			if m.active < 2 {
 				m.active++
 			} else if len(m.symbols.Items()) > 0 {
 				// Enter symbol detail
 				sym := m.symbols.SelectedItem().(symbolItem)
-				file := m.files.SelectedItem().(fileItem)
 				repo := m.repos.SelectedItem().(repoItem)
-				cmd = loadSymbolDetail(m.rstPath, repo.name, file.name, sym.name, sym.line)
+				cmd = loadSymbolDetail(m.store, repo.name, sym.symbol)
 			}
-		case "enter":
+		case key.Matches(msg, m.keys.Select):
 			if m.active == 2 && len(m.symbols.Items()) > 0 {
 				sym := m.symbols.SelectedItem().(symbolItem)
-				file := m.files.SelectedItem().(fileItem)
 				repo := m.repos.SelectedItem().(repoItem)
-				cmd = loadSymbolDetail(m.rstPath, repo.name, file.name, sym.name, sym.line)
+				cmd = loadSymbolDetail(m.store, repo.name, sym.symbol)
 			}
 		}
 
 		// Sync selection when switching focus
-		if len(m.repos.Items()) > 0 && m.active == 0 {
-			repo := m.repos.SelectedItem().(repoItem)
-			cmd = loadFiles(m.rstPath, repo.name)
-		}
-		if len(m.files.Items()) > 0 && m.active == 1 {
-			repo := m.repos.SelectedItem().(repoItem)
-			file := m.files.SelectedItem().(fileItem)
-			cmd = loadSymbols(m.rstPath, repo.name, file.name)
+		if sync := m.syncSelection(); sync != nil {
+			cmd = sync
 		}
 	}
 
 	return m, cmd
 }
 
+// syncSelection loads the files or symbols of the selection in the focused
+// pane.
+func (m *model) syncSelection() tea.Cmd {
+	if len(m.repos.Items()) > 0 && m.active == 0 {
+		repo := m.repos.SelectedItem().(repoItem)
+		return loadFiles(m.store, repo.name)
+	}
+	if len(m.files.Items()) > 0 && m.active == 1 {
+		repo := m.repos.SelectedItem().(repoItem)
+		file := m.files.SelectedItem().(fileItem)
+		return loadSymbols(m.store, repo.name, file.name)
+	}
+	return nil
+}
+
 func (m model) updateSymbolMode(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
 	switch msg := msg.(type) {
-	case tea.WindowSizeMsg:
-		m.width = msg.Width
-		m.height = msg.Height
-		m.viewport.Width = msg.Width
-		m.viewport.Height = msg.Height - 8
-		m.deps.SetSize(msg.Width, 6)
-		m.refs.SetSize(msg.Width, 6)
+	case symbolDetailMsg:
+		// Push the current location so that "h" can return to it, even
+		// when the new symbol lives in another file or repo.
+		if m.symbol != nil {
+			m.symbolStack = append(m.symbolStack, m.symbol.jump())
+		}
+		m.showSymbol(msg.detail)
+		m.active = 0
+		return m, nil
+
+	case errMsg:
+		m.status = fmt.Sprintf("Error: %v", msg.err)
 		return m, nil
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "esc":
+		m.status = ""
+		switch {
+		case key.Matches(msg, m.keys.Find):
+			return m, m.openFinder()
+		case key.Matches(msg, m.keys.Back):
 			m.mode = modeThreePane
 			m.symbol = nil
 			m.symbolStack = nil
 			m.active = 2 // Return focus to symbols column
 			return m, nil
-		case "h":
+		case key.Matches(msg, m.keys.Left):
 			// Pop from stack if available, else return to three-pane
 			if len(m.symbolStack) > 0 {
 				prev := m.symbolStack[len(m.symbolStack)-1]
 				m.symbolStack = m.symbolStack[:len(m.symbolStack)-1]
-				m.symbol = &symbolDetail{
-					name:      prev.name,
-					signature: prev.signature,
-					filePath:  prev.filePath,
-					line:      prev.line,
-					deps:      prev.deps,
-					refs:      prev.refs,
-					code:      prev.code,
-				}
-				m.viewport.SetContent(prev.code)
-				m.deps.SetItems(makeDepsItems(prev.deps))
-				m.refs.SetItems(makeRefsItems(prev.refs))
+				m.showSymbol(prev.detail())
 			} else {
 				m.mode = modeThreePane
 				m.symbol = nil
 				m.active = 2 // Return focus to symbols column
 			}
 			return m, nil
-		case "r":
+		case key.Matches(msg, m.keys.Deps):
 			m.active = 1 // 1: deps list
-		case "R":
+		case key.Matches(msg, m.keys.Refs):
 			m.active = 2 // 2: refs list
-		case "j":
+		case key.Matches(msg, m.keys.Down):
 			if m.active == 0 {
 				m.viewport.LineDown(1)
 			} else {
 				m.scrollList(1)
 			}
-		case "k":
+		case key.Matches(msg, m.keys.Up):
 			if m.active == 0 {
 				m.viewport.LineUp(1)
 			} else {
 				m.scrollList(-1)
 			}
-		case "gg":
+		case key.Matches(msg, m.keys.Top):
 			m.viewport.GotoTop()
-		case "G":
+		case key.Matches(msg, m.keys.Bottom):
 			m.viewport.GotoBottom()
-		case "l", "enter":
+		case key.Matches(msg, m.keys.Edit):
+			cmd = m.editSelection()
+		case key.Matches(msg, m.keys.Bookmark):
+			cmd = m.openNotePrompt()
+		case key.Matches(msg, m.keys.Bookmarks):
+			m.showBookmarks()
+		case key.Matches(msg, m.keys.History):
+			m.showHistory()
+		case key.Matches(msg, m.keys.Callees):
+			cmd = loadCallGraph(m.store, m.symbol.repo, m.symbol.symbol, callees)
+		case key.Matches(msg, m.keys.Callers):
+			cmd = loadCallGraph(m.store, m.symbol.repo, m.symbol.symbol, callers)
+		case key.Matches(msg, m.keys.NextOccurrence):
+			m.selectCodeOccurrence(1)
+		case key.Matches(msg, m.keys.PrevOccurrence):
+			m.selectCodeOccurrence(-1)
+		case key.Matches(msg, m.keys.Right, m.keys.Select):
 			// Jump to selected dep/ref
 			switch m.active {
+			case 0:
+				if m.codeOcc >= 0 {
+					cmd = m.jumpToSymbol(m.code.occs[m.codeOcc].symbol)
+				}
 			case 1:
 				if len(m.deps.Items()) > 0 {
 					item := m.deps.SelectedItem().(refItem)
-					cmd = m.jumpToSymbol(item.name)
+					cmd = m.jumpToSymbol(item.symbol)
 				}
 			case 2:
 				if len(m.refs.Items()) > 0 {
 					item := m.refs.SelectedItem().(refItem)
-					cmd = m.jumpToSymbol(item.name)
+					cmd = m.jumpToSymbol(item.symbol)
 				}
 			}
 		}
@@ -416,50 +578,110 @@ func (m *model) scrollList(delta int) {
 	list.Select(newIdx)
 }
 
-func (m *model) jumpToSymbol(name string) tea.Cmd {
-	// Push current symbol to stack
-	if m.symbol != nil {
-		m.symbolStack = append(m.symbolStack, symbolJump{
-			name:      m.symbol.name,
-			signature: m.symbol.signature,
-			line:      m.symbol.line,
-			filePath:  m.symbol.filePath,
-			deps:      m.symbol.deps,
-			refs:      m.symbol.refs,
-			code:      m.symbol.code,
-		})
+// selectCodeOccurrence moves the selection between dependency occurrences
+// in the code view and scrolls the selected one into view.
+func (m *model) selectCodeOccurrence(delta int) {
+	if len(m.code.occs) == 0 {
+		return
+	}
+	m.active = 0
+	if m.codeOcc < 0 && delta < 0 {
+		m.codeOcc = 0
+	}
+	m.codeOcc = (m.codeOcc + delta + len(m.code.occs)) % len(m.code.occs)
+	m.viewport.SetContent(m.code.render(m.codeOcc))
+	line := m.code.occs[m.codeOcc].line
+	if line < m.viewport.YOffset || line >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(line - m.viewport.Height/2)
+	}
+}
+
+// jumpToSymbol loads the detail for a full SCIP symbol. The current symbol
+// is pushed onto symbolStack once the target has been resolved.
+func (m *model) jumpToSymbol(symbol string) tea.Cmd {
+	return loadSymbolDetail(m.store, m.currentRepo(), symbol)
+}
+
+// currentRepo returns the repo of the symbol being viewed, falling back to
+// the repo selected in the three-pane view.
+func (m *model) currentRepo() string {
+	if m.mode != modeThreePane && m.symbol != nil {
+		return m.symbol.repo
+	}
+	if item, ok := m.repos.SelectedItem().(repoItem); ok {
+		return item.name
 	}
-	// Load new symbol detail
-	return loadSymbolDetail(m.rstPath, m.repos.SelectedItem().(repoItem).name, "", name, 0)
+	return ""
+}
+
+// showSymbol makes detail the current symbol of the symbol view.
+func (m *model) showSymbol(detail symbolDetail) {
+	m.symbol = &detail
+	m.code = highlightCode(detail.code, detail.language, detail.line, detail.deps)
+	m.codeOcc = -1
+	m.viewport.SetContent(m.code.render(m.codeOcc))
+	m.viewport.GotoTop()
+	m.deps.SetItems(makeDepsItems(detail.deps))
+	m.refs.SetItems(makeRefsItems(detail.refs))
+	m.recordVisit(detail)
 }
 
 func (m model) View() string {
-	if m.mode == modeSymbol {
+	if m.finderOpen {
+		return m.viewFinder()
+	}
+	if m.noteOpen {
+		return m.viewNotePrompt()
+	}
+	switch m.mode {
+	case modeSymbol:
 		return m.viewSymbolPage()
+	case modeCallGraph:
+		return m.viewCallGraph()
+	case modeDiagnostics:
+		return m.viewDiagnostics()
+	case modeCompare:
+		return m.viewCompare()
+	case modeBookmarks, modeHistory:
+		return m.viewLocations()
 	}
 	return m.viewThreePane()
 }
 
 func (m model) viewThreePane() string {
-	repos := columnStyle.Render(m.repos.View())
-	files := columnStyle.Render(m.files.View())
+	repos := renderColumn(columnStyle, m.repos)
+	files := renderColumn(columnStyle, m.files)
 
 	// Only render symbols when focused on middle or right pane
 	var symbols string
 	if m.active >= 1 && len(m.symbols.Items()) > 0 {
-		symbols = columnStyle.Render(m.symbols.View())
+		symbols = renderColumn(columnStyle, m.symbols)
 	}
 
 	switch m.active {
 	case 0:
-		repos = activeColumnStyle.Render(m.repos.View())
+		repos = renderColumn(activeColumnStyle, m.repos)
 	case 1:
-		files = activeColumnStyle.Render(m.files.View())
+		files = renderColumn(activeColumnStyle, m.files)
 	case 2:
-		symbols = activeColumnStyle.Render(m.symbols.View())
+		symbols = renderColumn(activeColumnStyle, m.symbols)
 	}
 
-	help := helpStyle.Render("h/l: focus | j/k: move | enter/l: select | q: quit | h: back")
+	k := m.keys
+	help := helpStyle.Render(strings.Join([]string{
+		keyHelp("focus", k.Left, k.Right),
+		keyHelp("move", k.Down, k.Up),
+		keyHelp("select", k.Select, k.Right),
+		keyHelp("find", k.Find),
+		keyHelp("edit", k.Edit),
+		keyHelp("diagnostics", k.Diagnostics),
+		keyHelp("bookmarks/history", k.Bookmarks, k.History),
+		keyHelp("quit", k.Quit),
+		keyHelp("back", k.Left),
+	}, " | "))
+	if status := m.statusLine(); status != "" {
+		help = lipgloss.JoinVertical(lipgloss.Left, help, helpStyle.Render(status))
+	}
 
 	// Two or three pane layout
 	if m.active >= 1 {
@@ -476,9 +698,28 @@ func (m model) viewThreePane() string {
 	)
 }
 
+// renderColumn renders l with the border of style at the width set by
+// resize, so that the panes keep their proportions.
+func renderColumn(style lipgloss.Style, l list.Model) string {
+	return style.Width(l.Width() + columnChrome - 2).Render(l.View())
+}
+
 func (m model) viewSymbolPage() string {
-	header := fmt.Sprintf("Symbol: %s (%s) | Press q/h to back, r: deps, R: refs, j/k: move, l/enter: jump",
-		m.symbol.name, m.symbol.signature)
+	k := m.keys
+	help := strings.Join([]string{
+		keyHelp("back", k.Back, k.Left),
+		keyHelp("deps", k.Deps),
+		keyHelp("refs", k.Refs),
+		keyHelp("deps in code", k.NextOccurrence, k.PrevOccurrence),
+		keyHelp("callees/callers", k.Callees, k.Callers),
+		keyHelp("edit", k.Edit),
+		keyHelp("bookmark", k.Bookmark),
+		keyHelp("move", k.Down, k.Up),
+		keyHelp("jump", k.Right, k.Select),
+		keyHelp("find", k.Find),
+	}, ", ")
+	header := fmt.Sprintf("Symbol: %s (%s) | %s:%d | %s",
+		m.symbol.name, m.symbol.signature, m.symbol.filePath, m.symbol.line, help)
 
 	codeView := columnStyle.Render(m.viewport.View())
 
@@ -502,46 +743,50 @@ func (m model) viewSymbolPage() string {
 		titleStyle.Render(header),
 		codeView,
 		lists,
+		helpStyle.Render(m.statusLine()),
 	)
 }
 
+// statusLine combines the last error with the live reload status.
+func (m model) statusLine() string {
+	switch {
+	case m.status == "":
+		return m.refreshed
+	case m.refreshed == "":
+		return m.status
+	}
+	return m.status + " | " + m.refreshed
+}
+
 // Commands to load data
 
-func loadRepos(rstPath string) tea.Cmd {
+func loadRepos(store rstStore) tea.Cmd {
 	return func() tea.Msg {
-		entries, err := os.ReadDir(rstPath)
+		rstFiles, err := store.list()
 		if err != nil {
 			return errMsg{err}
 		}
 
 		var items []list.Item
-		for _, e := range entries {
-			if !e.IsDir() && strings.HasSuffix(e.Name(), ".rst") {
-				name := rstFileToRepoName(e.Name())
-				items = append(items, repoItem{name: name})
-			}
+		for _, rstFile := range rstFiles {
+			name := rstFileToRepoName(rstFile)
+			items = append(items, repoItem{name: name})
 		}
 
 		return reposLoadedMsg{items: items}
 	}
 }
 
-func loadFiles(rstPath, repo string) tea.Cmd {
+func loadFiles(store rstStore, repo string) tea.Cmd {
 	return func() tea.Msg {
-		rstFile := filepath.Join(rstPath, repoToRSTFile(repo))
-		data, err := os.ReadFile(rstFile)
+		r, err := store.read(repoToRSTFile(repo))
 		if err != nil {
 			return errMsg{err}
 		}
 
-		var r rst.RST
-		if err := proto.Unmarshal(data, &r); err != nil {
-			return errMsg{err}
-		}
-
 		var items []list.Item
-		for path := range r.Documents {
-			items = append(items, fileItem{name: path})
+		for path, doc := range r.Documents {
+			items = append(items, fileItem{name: path, diagnostics: countDiagnostics(doc.Diagnostics)})
 		}
 		// Sort by path for consistent order
 		sort.Slice(items, func(i, j int) bool {
@@ -552,19 +797,13 @@ func loadFiles(rstPath, repo string) tea.Cmd {
 	}
 }
 
-func loadSymbols(rstPath, repo, filePath string) tea.Cmd {
+func loadSymbols(store rstStore, repo, filePath string) tea.Cmd {
 	return func() tea.Msg {
-		rstFile := filepath.Join(rstPath, repoToRSTFile(repo))
-		data, err := os.ReadFile(rstFile)
+		r, err := store.read(repoToRSTFile(repo))
 		if err != nil {
 			return errMsg{err}
 		}
 
-		var r rst.RST
-		if err := proto.Unmarshal(data, &r); err != nil {
-			return errMsg{err}
-		}
-
 		doc, ok := r.Documents[filePath]
 		if !ok {
 			return errMsg{fmt.Errorf("file not found: %s", filePath)}
@@ -574,6 +813,7 @@ func loadSymbols(rstPath, repo, filePath string) tea.Cmd {
 		for symKey, sym := range doc.Symbols {
 			items = append(items, symbolItem{
 				name:      extractSymbolName(symKey),
+				symbol:    symKey,
 				signature: sym.Signature,
 				line:      int(sym.Line),
 			})
@@ -588,71 +828,121 @@ func loadSymbols(rstPath, repo, filePath string) tea.Cmd {
 }
 
 type symbolDetail struct {
-	name         string
-	signature    string
-	filePath     string
-	line         int
-	deps         []string
-	refs         []string
-	code         string
-	symbolKey    string
+	name      string
+	signature string
+	repo      string
+	filePath  string
+	language  string
+	line      int
+	deps      []string
+	refs      []string
+	code      string
+	symbol    string
+	symbolKey string
 }
 
-func loadSymbolDetail(rstPath, repo, filePath, symbolName string, line int) tea.Cmd {
+func (d *symbolDetail) jump() symbolJump {
+	return symbolJump{
+		name:      d.name,
+		signature: d.signature,
+		line:      d.line,
+		repo:      d.repo,
+		filePath:  d.filePath,
+		language:  d.language,
+		deps:      d.deps,
+		refs:      d.refs,
+		code:      d.code,
+		symbol:    d.symbol,
+		symbolKey: d.symbolKey,
+	}
+}
+
+func (j symbolJump) detail() symbolDetail {
+	return symbolDetail{
+		name:      j.name,
+		signature: j.signature,
+		repo:      j.repo,
+		filePath:  j.filePath,
+		language:  j.language,
+		line:      j.line,
+		deps:      j.deps,
+		refs:      j.refs,
+		code:      j.code,
+		symbol:    j.symbol,
+		symbolKey: j.symbolKey,
+	}
+}
+
+// loadSymbolDetail resolves a full SCIP symbol to its definition. The RST of
+// repo is searched first, followed by every other RST in store, so that
+// dependencies defined in other files or repos can be followed.
+func loadSymbolDetail(store rstStore, repo, symbol string) tea.Cmd {
 	return func() tea.Msg {
-		rstFile := filepath.Join(rstPath, repoToRSTFile(repo))
-		data, err := os.ReadFile(rstFile)
+		candidates := []string{}
+		if repo != "" {
+			candidates = append(candidates, repoToRSTFile(repo))
+		}
+		rstFiles, err := store.list()
 		if err != nil {
 			return errMsg{err}
 		}
-
-		var r rst.RST
-		if err := proto.Unmarshal(data, &r); err != nil {
-			return errMsg{err}
+		for _, rstFile := range rstFiles {
+			if rstFile != repoToRSTFile(repo) {
+				candidates = append(candidates, rstFile)
+			}
 		}
 
-		// Find the document and symbol
-		var foundDoc *rst.Document
-		var foundSym *rst.Symbol
-		var foundPath string
-
-		for path, doc := range r.Documents {
-			if filePath != "" && path != filePath {
-				continue
-			}
-			for symKey, sym := range doc.Symbols {
-				baseName := extractSymbolName(symKey)
-				if baseName == symbolName || baseName == symbolName+"()" {
-					if line == 0 || int(sym.Line) == line {
-						foundDoc = doc
-						foundSym = sym
-						foundPath = path
-						break
-					}
+		for _, candidate := range candidates {
+			r, err := store.read(candidate)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
 				}
+				return errMsg{err}
 			}
-			if foundDoc != nil {
-				break
+			if detail, ok := findSymbolDetail(r, symbol); ok {
+				detail.repo = rstFileToRepoName(candidate)
+				return symbolDetailMsg{detail: detail}
 			}
 		}
 
-		if foundDoc == nil || foundSym == nil {
-			return errMsg{fmt.Errorf("symbol not found: %s", symbolName)}
-		}
+		return errMsg{fmt.Errorf("symbol not found: %s", extractSymbolName(symbol))}
+	}
+}
 
-		return symbolDetailMsg{
-			detail: symbolDetail{
-				name:      symbolName,
-				signature: foundSym.Signature,
-				filePath:  foundPath,
-				line:      int(foundSym.Line),
-				deps:      foundSym.DependenceOn,
-				refs:      foundSym.ReferenceBy,
-				code:      foundSym.Code,
-				symbolKey: extractSymbolKey(foundSym.Symbol),
-			},
+// findSymbolDetail looks up the definition of symbol across all documents of r.
+func findSymbolDetail(r *rst.RST, symbol string) (symbolDetail, bool) {
+	for path, doc := range r.Documents {
+		sym, ok := doc.Symbols[symbol]
+		if !ok {
+			continue
 		}
+		return symbolDetail{
+			name:      extractSymbolName(symbol),
+			signature: sym.Signature,
+			filePath:  path,
+			language:  r.GetMetadata().GetLanguage(),
+			line:      int(sym.Line),
+			deps:      sym.DependenceOn,
+			refs:      sym.ReferenceBy,
+			code:      sym.Code,
+			symbol:    symbol,
+			symbolKey: extractSymbolKey(sym.Symbol),
+		}, true
+	}
+	return symbolDetail{}, false
+}
+
+func readRSTFile(path string) (*rst.RST, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r rst.RST
+	if err := proto.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal RST from %s: %w", path, err)
 	}
+	return &r, nil
 }
 
 func extractSymbolKey(scipSymbol string) string {
@@ -668,7 +958,7 @@ func extractSymbolKey(scipSymbol string) string {
 func makeDepsItems(deps []string) []list.Item {
 	var items []list.Item
 	for _, dep := range deps {
-		items = append(items, refItem{name: extractSymbolName(dep), kind: "dep"})
+		items = append(items, refItem{name: extractSymbolName(dep), symbol: dep, kind: "dep"})
 	}
 	return items
 }
@@ -676,7 +966,7 @@ func makeDepsItems(deps []string) []list.Item {
 func makeRefsItems(refs []string) []list.Item {
 	var items []list.Item
 	for _, ref := range refs {
-		items = append(items, refItem{name: extractSymbolName(ref), kind: "ref"})
+		items = append(items, refItem{name: extractSymbolName(ref), symbol: ref, kind: "ref"})
 	}
 	return items
 }
@@ -690,20 +980,41 @@ type errMsg struct{ err error }
 
 // Helper functions
 
+// The TUI names repos after their RST files without the .rst extension.
+// 'scip parse' writes an RST per language, named <repo>.<language>.rst, so
+// the name includes the language, which tells the RSTs of a repo apart.
+
 func repoToRSTFile(repo string) string {
-	name := repo
-	name = strings.ReplaceAll(name, ".", "_")
-	name = strings.ReplaceAll(name, "/", "_")
-	return name + ".go.rst"
+	return repo + ".rst"
 }
 
 func rstFileToRepoName(fileName string) string {
-	name := strings.TrimSuffix(fileName, ".go.rst")
-	name = strings.ReplaceAll(name, "_", ".")
-	return name
+	return strings.TrimSuffix(fileName, ".rst")
+}
+
+// buildMemoryRSTs builds the RSTs of the SCIP index at indexPath without
+// writing them to disk.
+func buildMemoryRSTs(indexPath, repoID, projectRoot string) (memoryRSTs, error) {
+	index, err := readFromOption(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if projectRoot != "" {
+		if index.Metadata == nil {
+			index.Metadata = &scip.Metadata{}
+		}
+		index.Metadata.ProjectRoot = projectRoot
+	}
+	rsts, err := buildRSTs(index, repoID, false)
+	if err != nil {
+		return nil, err
+	}
+	return memoryRSTs(rsts), nil
 }
 
 func tuiCommand() cli.Command {
+	var projectRoot, from, repoID, configPath string
+	var compare bool
 	return cli.Command{
 		Name:  "tui",
 		Usage: "Interactive TUI for code navigation",
@@ -712,24 +1023,157 @@ Left pane: Repos (RST files in ~/.rsts)
 Middle pane: Files in selected repo
 Right pane: Symbols in selected file
 
+With --from, the RSTs are built in memory from a SCIP index instead, so
+no prior 'scip parse' is needed:
+  scip tui --from index.scip
+
+With --compare, two versions of a repo are compared instead, for example
+before and after upgrading an indexer. Both arguments are RST files or
+SCIP indexes:
+  scip tui --compare old.go.rst new.go.rst
+Added (+), removed (-) and changed (~) files and symbols are listed, with a
+unified diff of the code, signature and edges of the selected symbol.
+Symbols are matched without their package version; packages whose version
+changed are listed in the header.
+
 Keybindings (three-pane):
   h/l - Move focus left/right (no wrap)
   j/k - Move selection up/down
   enter/l - Select symbol
   h - Move focus left
+  / or ctrl+p - Find files and symbols
+  e - Open selected file or symbol in $EDITOR
+  d - Show diagnostics of the selected repo
+  b - Bookmark the selected symbol
+  B/H - Show bookmarks/history
   q - Quit
 
+RST files that change on disk, for example after re-running 'scip parse',
+are reloaded automatically while keeping the current selection.
+
 Keybindings (symbol detail):
   q - Back to three-pane
   h - Go back to previous symbol
   r - Focus dependencies list
   R - Focus references list
+  n/N - Select next/previous dependency in code
+  c/C - Show call graph of callees/callers
+  e - Open symbol in $EDITOR
+  b - Bookmark symbol, with an optional note
+  B/H - Show bookmarks/history
   j/k - Scroll/move
-  gg/G - Go to top/bottom
-  l/enter - Jump to selected`,
+  g/G - Go to top/bottom
+  l/enter - Jump to selected
+  / or ctrl+p - Find files and symbols
+
+Keybindings (call graph):
+  j/k - Move selection
+  l/space - Expand node
+  h - Collapse node or move to parent
+  tab - Switch between callees and callers
+  enter - Open selected symbol
+  q - Back to symbol detail
+
+Keybindings (diagnostics):
+  j/k - Move selection
+  / - Filter diagnostics
+  enter/l - Jump to the symbol containing the diagnostic
+  e - Open diagnostic location in $EDITOR
+  q - Back to three-pane view
+
+Keybindings (bookmarks and history):
+  j/k - Move selection
+  / - Filter by symbol, file or note
+  enter/l - Open symbol
+  e - Open symbol in $EDITOR
+  x - Delete entry
+  B/H - Switch between bookmarks and history
+  q - Back to three-pane view
+
+Bookmarks and the history of visited symbols are kept in tui-state.json in
+the RST directory, so they survive restarts. With --from they only last
+for the session.
+
+Keybindings (compare):
+  h/l - Move focus between files, symbols and diff
+  j/k - Move selection or scroll the diff
+  g/G - Go to top/bottom of the diff
+  q - Quit
+
+Keybindings (finder):
+  type - Fuzzy filter files and symbols
+  up/down, ctrl+k/ctrl+j - Move selection
+  tab - Toggle between selected repo and all repos
+  enter - Open selected file or symbol
+  esc - Close finder
+
+The mouse wheel scrolls the pane under the cursor. Clicking focuses a pane
+and selects an item; clicking the selected item opens it.
+
+The keybindings above are the defaults. They, the colors and the pane
+proportions can be changed in ~/.config/scip/tui.yaml. Keys which type
+text, such as j, are typed into the query of the finder. For example:
+  keys:
+    down: [j, ctrl+n]
+    quit: [ctrl+c]
+  theme:
+    active_border: "#ff8800"
+  panes: [1, 2, 2]
+
+Actions: quit, back, find, edit, diagnostics, bookmark, bookmarks,
+history, delete, up, down, left, right, select, deps, refs, top, bottom,
+callees, callers, next_occurrence, prev_occurrence, expand, toggle.
+Colors: border, active_border, title, help, dependency, reference,
+keyword, string, comment, number, type, line_number, occurrence,
+tree_cursor, cycle, error, warning, info.
+Panes are the relative widths of the repos, files and symbols panes.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "from",
+				Usage:       "Path to a SCIP index to browse instead of the RSTs in ~/.rsts",
+				Destination: &from,
+			},
+			&cli.StringFlag{
+				Name:        "repo",
+				Usage:       "Repository identifier for --from (auto-detected from SCIP index if not specified)",
+				Destination: &repoID,
+			},
+			projectRootFlag(&projectRoot),
+			&cli.BoolFlag{
+				Name:        "compare",
+				Usage:       "Compare the two RSTs or SCIP indexes given as arguments",
+				Destination: &compare,
+			},
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "Path to the TUI config file (default: ~/.config/scip/tui.yaml)",
+				Destination: &configPath,
+			},
+		},
 		Action: func(c *cli.Context) error {
 			m := newModel()
-			p := tea.NewProgram(m, tea.WithAltScreen())
+			m.projectRoot = projectRoot
+			config, err := loadTUIConfig(cmp.Or(configPath, defaultTUIConfigPath()), configPath != "")
+			if err != nil {
+				return err
+			}
+			if err := m.applyConfig(config); err != nil {
+				return err
+			}
+			if compare {
+				if c.NArg() != 2 {
+					return fmt.Errorf("--compare expects two RSTs, got %d arguments", c.NArg())
+				}
+				m.mode = modeCompare
+				m.comparePaths = []string{c.Args().Get(0), c.Args().Get(1)}
+			} else if from != "" {
+				store, err := buildMemoryRSTs(from, repoID, projectRoot)
+				if err != nil {
+					return err
+				}
+				m.store = store
+			}
+			p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
 			if err := p.Start(); err != nil {
 				return fmt.Errorf("failed to start TUI: %w", err)
 			}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tuiStateFile is the name of the file in the RST directory that keeps the
+// bookmarks and navigation history between sessions. It does not end in
+// .rst, so it is not listed as a repo.
+const tuiStateFile = "tui-state.json"
+
+// maxHistory is the number of visited symbols that are remembered.
+const maxHistory = 200
+
+// tuiState is what the TUI remembers about an RST directory.
+type tuiState struct {
+	Bookmarks []bookmark `json:"bookmarks"`
+	// History lists visited symbols, most recent first.
+	History []location `json:"history"`
+}
+
+// location identifies a symbol in the RSTs of a repo.
+type location struct {
+	Repo   string `json:"repo"`
+	File   string `json:"file"`
+	Symbol string `json:"symbol"`
+	Line   int    `json:"line"`
+}
+
+type bookmark struct {
+	location
+	Note string `json:"note,omitempty"`
+}
+
+func (l location) same(other location) bool {
+	return l.Repo == other.Repo && l.Symbol == other.Symbol
+}
+
+// tuiStatePath returns where the state of store is persisted. RSTs built in
+// memory have no directory, so their state only lasts for the session.
+func tuiStatePath(store rstStore) string {
+	dir, ok := store.(rstDir)
+	if !ok {
+		return ""
+	}
+	return filepath.Join(string(dir), tuiStateFile)
+}
+
+type tuiStateMsg struct{ state tuiState }
+
+func loadTUIState(store rstStore) tea.Cmd {
+	path := tuiStatePath(store)
+	if path == "" {
+		return nil
+	}
+	return func() tea.Msg {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return errMsg{err}
+		}
+		var state tuiState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return errMsg{fmt.Errorf("failed to parse %s: %w", path, err)}
+		}
+		return tuiStateMsg{state: state}
+	}
+}
+
+// saveState returns a command writing the bookmarks and history next to
+// the RSTs, so that Update doesn't wait for the disk. Update calls it once
+// per message which sets stateChanged.
+func (m *model) saveState() tea.Cmd {
+	path := tuiStatePath(m.store)
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.state, "", "  ")
+	if err != nil {
+		m.status = fmt.Sprintf("Error: failed to save bookmarks and history: %v", err)
+		return nil
+	}
+	saver := m.stateSaver
+	saver.saves++
+	save := saver.saves
+	return func() tea.Msg {
+		if err := saver.write(path, data, save); err != nil {
+			return errMsg{fmt.Errorf("failed to save bookmarks and history: %w", err)}
+		}
+		return nil
+	}
+}
+
+// stateSaver orders the writes of the state file. The commands of saveState
+// run concurrently, so a save is skipped if a later one was written first.
+type stateSaver struct {
+	saves int // Number of saves started, only used by Update
+
+	mu      sync.Mutex
+	written int // Latest save written
+}
+
+func (s *stateSaver) write(path string, data []byte, save int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if save <= s.written {
+		return nil
+	}
+	// Write to a temporary file first, like 'scip parse' does for RSTs.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	s.written = save
+	return nil
+}
+
+// mergeState adds the state read from disk to what was recorded while it
+// was loading.
+func (m *model) mergeState(loaded tuiState) {
+	for _, b := range loaded.Bookmarks {
+		if m.bookmarkIndex(b.location) < 0 {
+			m.state.Bookmarks = append(m.state.Bookmarks, b)
+		}
+	}
+	for _, visit := range loaded.History {
+		if !containsLocation(m.state.History, visit) {
+			m.state.History = append(m.state.History, visit)
+		}
+	}
+	m.state.History = m.state.History[:min(len(m.state.History), maxHistory)]
+}
+
+func containsLocation(locations []location, l location) bool {
+	for _, other := range locations {
+		if other.same(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *model) bookmarkIndex(l location) int {
+	for i, b := range m.state.Bookmarks {
+		if b.same(l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordVisit moves the symbol of detail to the front of the history.
+func (m *model) recordVisit(detail symbolDetail) {
+	visit := location{Repo: detail.repo, File: detail.filePath, Symbol: detail.symbol, Line: detail.line}
+	if len(m.state.History) > 0 && m.state.History[0] == visit {
+		return
+	}
+	history := []location{visit}
+	for _, l := range m.state.History {
+		if !l.same(visit) && len(history) < maxHistory {
+			history = append(history, l)
+		}
+	}
+	m.state.History = history
+	m.stateChanged = true
+}
+
+// locationItem is a bookmark or history entry listed in their panes.
+type locationItem struct {
+	bookmark
+}
+
+func (i locationItem) Title() string { return extractSymbolName(i.Symbol) }
+
+func (i locationItem) Description() string {
+	desc := fmt.Sprintf("%s · %s:%d", i.Repo, i.File, i.Line)
+	if i.Note != "" {
+		desc += " · " + i.Note
+	}
+	return desc
+}
+
+func (i locationItem) FilterValue() string {
+	return strings.Join([]string{extractSymbolName(i.Symbol), i.File, i.Note}, " ")
+}
+
+func newLocationList(title, itemName, itemsName string) list.Model {
+	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	l.Title = title
+	l.SetShowHelp(false)
+	l.SetStatusBarItemName(itemName, itemsName)
+	return l
+}
+
+func newNoteInput() textinput.Model {
+	note := textinput.New()
+	note.Prompt = "Note: "
+	note.Placeholder = "optional"
+	note.CharLimit = 200
+	return note
+}
+
+// bookmarkTarget returns the symbol to bookmark: the one being viewed, or
+// the one selected in the symbols pane.
+func (m *model) bookmarkTarget() (location, bool) {
+	if m.mode == modeSymbol && m.symbol != nil {
+		d := m.symbol
+		return location{Repo: d.repo, File: d.filePath, Symbol: d.symbol, Line: d.line}, true
+	}
+	if m.mode != modeThreePane || m.active != 2 {
+		return location{}, false
+	}
+	repo, ok1 := m.repos.SelectedItem().(repoItem)
+	file, ok2 := m.files.SelectedItem().(fileItem)
+	sym, ok3 := m.symbols.SelectedItem().(symbolItem)
+	if !ok1 || !ok2 || !ok3 {
+		return location{}, false
+	}
+	return location{Repo: repo.name, File: file.name, Symbol: sym.symbol, Line: sym.line}, true
+}
+
+// openNotePrompt asks for the note of a new bookmark, pre-filled with the
+// note of an existing bookmark of the same symbol.
+func (m *model) openNotePrompt() tea.Cmd {
+	target, ok := m.bookmarkTarget()
+	if !ok {
+		return nil
+	}
+	m.noteTarget = target
+	m.noteOpen = true
+	m.note.Reset()
+	if i := m.bookmarkIndex(target); i >= 0 {
+		m.note.SetValue(m.state.Bookmarks[i].Note)
+	}
+	return m.note.Focus()
+}
+
+func (m model) updateNotePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.noteOpen = false
+		m.note.Blur()
+		return m, nil
+	case tea.KeyEnter:
+		m.noteOpen = false
+		m.note.Blur()
+		b := bookmark{location: m.noteTarget, Note: strings.TrimSpace(m.note.Value())}
+		if i := m.bookmarkIndex(b.location); i >= 0 {
+			m.state.Bookmarks[i] = b
+		} else {
+			m.state.Bookmarks = append(m.state.Bookmarks, b)
+		}
+		m.stateChanged = true
+		if m.status == "" {
+			m.status = fmt.Sprintf("Bookmarked %s", extractSymbolName(b.Symbol))
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.note, cmd = m.note.Update(msg)
+	return m, cmd
+}
+
+func (m model) viewNotePrompt() string {
+	title := titleStyle.Render("Bookmark " + extractSymbolName(m.noteTarget.Symbol))
+	help := helpStyle.Render("enter: save | esc: cancel")
+	box := activeColumnStyle.Width(m.width * 3 / 5).Render(
+		lipgloss.JoinVertical(lipgloss.Left, title, "", m.note.View(), "", help))
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
+
+// showBookmarks switches to the bookmarks pane.
+func (m *model) showBookmarks() {
+	items := make([]list.Item, len(m.state.Bookmarks))
+	for i, b := range m.state.Bookmarks {
+		items[i] = locationItem{b}
+	}
+	m.bookmarks.ResetFilter()
+	m.bookmarks.SetItems(items)
+	m.mode = modeBookmarks
+}
+
+// showHistory switches to the history pane.
+func (m *model) showHistory() {
+	items := make([]list.Item, len(m.state.History))
+	for i, l := range m.state.History {
+		items[i] = locationItem{bookmark{location: l}}
+	}
+	m.history.ResetFilter()
+	m.history.SetItems(items)
+	m.history.Select(0)
+	m.mode = modeHistory
+}
+
+// locationList returns the list of the bookmarks or history pane.
+func (m *model) locationList() *list.Model {
+	if m.mode == modeHistory {
+		return &m.history
+	}
+	return &m.bookmarks
+}
+
+// deleteLocation removes the selected entry from the bookmarks or history.
+func (m *model) deleteLocation() {
+	l := m.locationList()
+	item, ok := l.SelectedItem().(locationItem)
+	if !ok {
+		return
+	}
+	if m.mode == modeHistory {
+		var history []location
+		for _, visit := range m.state.History {
+			if !visit.same(item.location) {
+				history = append(history, visit)
+			}
+		}
+		m.state.History = history
+	} else if i := m.bookmarkIndex(item.location); i >= 0 {
+		m.state.Bookmarks = append(m.state.Bookmarks[:i], m.state.Bookmarks[i+1:]...)
+	}
+	idx := l.Index()
+	if m.mode == modeHistory {
+		m.showHistory()
+	} else {
+		m.showBookmarks()
+	}
+	l.Select(min(idx, len(l.Items())-1))
+	m.stateChanged = true
+}
+
+func (m model) updateLocationsMode(msg tea.Msg) (tea.Model, tea.Cmd) {
+	l := m.locationList()
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case symbolDetailMsg:
+		m.symbol = nil
+		m.symbolStack = nil
+		m.showSymbol(msg.detail)
+		m.mode = modeSymbol
+		m.active = 0
+		return m, nil
+
+	case errMsg:
+		m.status = fmt.Sprintf("Error: %v", msg.err)
+		return m, nil
+
+	case tea.KeyMsg:
+		m.status = ""
+		if l.FilterState() == list.Filtering {
+			break
+		}
+		item, selected := l.SelectedItem().(locationItem)
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.mode = modeThreePane
+			return m, nil
+		case key.Matches(msg, m.keys.Select, m.keys.Right):
+			if selected {
+				return m, loadSymbolDetail(m.store, item.Repo, item.Symbol)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Edit):
+			if selected {
+				return m, resolveEditorTarget(m.store, item.Repo, m.projectRoot, item.File, item.Line)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Delete):
+			m.deleteLocation()
+			return m, nil
+		case key.Matches(msg, m.keys.Bookmarks):
+			m.showBookmarks()
+			return m, nil
+		case key.Matches(msg, m.keys.History):
+			m.showHistory()
+			return m, nil
+		}
+	}
+
+	*l, cmd = l.Update(msg)
+	return m, cmd
+}
+
+func (m model) viewLocations() string {
+	k := m.keys
+	help := helpStyle.Render(strings.Join([]string{
+		keyHelp("move", k.Down, k.Up),
+		"/: filter",
+		keyHelp("open", k.Select, k.Right),
+		keyHelp("edit", k.Edit),
+		keyHelp("delete", k.Delete),
+		keyHelp("bookmarks", k.Bookmarks),
+		keyHelp("history", k.History),
+		keyHelp("back", k.Back),
+	}, " | "))
+	l := m.locationList()
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		l.View(),
+		help,
+		helpStyle.Render(m.statusLine()),
+	)
+}
+
+// mouseLocations moves the selection with the wheel. A click selects an
+// entry and a click on the selected one opens it.
+func (m model) mouseLocations(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	l := m.locationList()
+	switch wheelDelta(msg) {
+	case -1:
+		l.CursorUp()
+		return m, nil
+	case 1:
+		l.CursorDown()
+		return m, nil
+	}
+	if !isLeftClick(msg) {
+		return m, nil
+	}
+	idx, ok := listIndexAt(*l, msg.Y, defaultItemStride)
+	if !ok {
+		return m, nil
+	}
+	if idx == l.Index() {
+		if item, ok := l.SelectedItem().(locationItem); ok {
+			return m, loadSymbolDetail(m.store, item.Repo, item.Symbol)
+		}
+		return m, nil
+	}
+	l.Select(idx)
+	return m, nil
+}
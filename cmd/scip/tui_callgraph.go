@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/lipgloss"
+
+	tea "github.com/charmbracelet/bubbletea"
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+// Call graph directions
+const (
+	callees = iota // Follow dependence_on
+	callers        // Follow reference_by
+)
+
+// callGraphEntry locates a symbol definition in the loaded RSTs.
+type callGraphEntry struct {
+	repo string
+	path string
+	sym  *rst.Symbol
+}
+
+// callNode is a node of the collapsible call graph tree.
+type callNode struct {
+	symbol   string
+	depth    int
+	expanded bool
+	cycle    bool // The symbol already appears on the path from the root
+	parent   *callNode
+	children []*callNode
+}
+
+type callGraph struct {
+	root      *callNode
+	direction int
+	symbols   map[string]callGraphEntry
+	cursor    int
+}
+
+type callGraphMsg struct {
+	symbol    string
+	direction int
+	symbols   map[string]callGraphEntry
+}
+
+// loadCallGraph indexes the symbols of every RST in store, preferring
+// definitions from repo, and roots a call graph at symbol.
+func loadCallGraph(store rstStore, repo, symbol string, direction int) tea.Cmd {
+	return func() tea.Msg {
+		rstFiles, err := store.list()
+		if err != nil {
+			return errMsg{err}
+		}
+		symbols := map[string]callGraphEntry{}
+		add := func(rstFile string, preferred bool) error {
+			r, err := store.read(rstFile)
+			if err != nil {
+				return err
+			}
+			for path, doc := range r.Documents {
+				for symKey, sym := range doc.Symbols {
+					if _, ok := symbols[symKey]; ok && !preferred {
+						continue
+					}
+					symbols[symKey] = callGraphEntry{repo: rstFileToRepoName(rstFile), path: path, sym: sym}
+				}
+			}
+			return nil
+		}
+		for _, rstFile := range rstFiles {
+			if rstFile == repoToRSTFile(repo) {
+				continue
+			}
+			if err := add(rstFile, false); err != nil {
+				return errMsg{err}
+			}
+		}
+		if err := add(repoToRSTFile(repo), true); err != nil && !os.IsNotExist(err) {
+			return errMsg{err}
+		}
+		return callGraphMsg{symbol: symbol, direction: direction, symbols: symbols}
+	}
+}
+
+func newCallGraph(msg callGraphMsg) *callGraph {
+	g := &callGraph{
+		root:      &callNode{symbol: msg.symbol},
+		direction: msg.direction,
+		symbols:   msg.symbols,
+	}
+	g.expand(g.root)
+	return g
+}
+
+// edges returns the symbols adjacent to symbol in the graph's direction.
+func (g *callGraph) edges(symbol string) []string {
+	entry, ok := g.symbols[symbol]
+	if !ok {
+		return nil
+	}
+	if g.direction == callers {
+		return entry.sym.ReferenceBy
+	}
+	return entry.sym.DependenceOn
+}
+
+func (g *callGraph) expand(n *callNode) {
+	if n.cycle || len(g.edges(n.symbol)) == 0 {
+		return
+	}
+	n.expanded = true
+	if n.children != nil {
+		return
+	}
+	for _, edge := range g.edges(n.symbol) {
+		child := &callNode{symbol: edge, depth: n.depth + 1, parent: n}
+		for p := n; p != nil; p = p.parent {
+			if p.symbol == edge {
+				child.cycle = true
+				break
+			}
+		}
+		n.children = append(n.children, child)
+	}
+}
+
+// visible flattens the expanded part of the tree in display order.
+func (g *callGraph) visible() []*callNode {
+	var out []*callNode
+	var walk func(n *callNode)
+	walk = func(n *callNode) {
+		out = append(out, n)
+		if n.expanded {
+			for _, child := range n.children {
+				walk(child)
+			}
+		}
+	}
+	walk(g.root)
+	return out
+}
+
+func (g *callGraph) selected() *callNode {
+	rows := g.visible()
+	g.cursor = min(max(g.cursor, 0), len(rows)-1)
+	return rows[g.cursor]
+}
+
+func (m model) updateCallGraphMode(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case symbolDetailMsg:
+		if m.symbol != nil {
+			m.symbolStack = append(m.symbolStack, m.symbol.jump())
+		}
+		m.showSymbol(msg.detail)
+		m.mode = modeSymbol
+		m.active = 0
+		return m, nil
+
+	case errMsg:
+		m.status = fmt.Sprintf("Error: %v", msg.err)
+		return m, nil
+
+	case tea.KeyMsg:
+		m.status = ""
+		g := m.callGraph
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.mode = modeSymbol
+			m.callGraph = nil
+		case key.Matches(msg, m.keys.Down):
+			g.cursor++
+			g.selected()
+		case key.Matches(msg, m.keys.Up):
+			g.cursor--
+			g.selected()
+		case key.Matches(msg, m.keys.Right, m.keys.Expand):
+			g.expand(g.selected())
+		case key.Matches(msg, m.keys.Left):
+			n := g.selected()
+			if n.expanded {
+				n.expanded = false
+			} else if n.parent != nil {
+				rows := g.visible()
+				for i, row := range rows {
+					if row == n.parent {
+						g.cursor = i
+						break
+					}
+				}
+			}
+		case key.Matches(msg, m.keys.Toggle):
+			direction := callers
+			if g.direction == callers {
+				direction = callees
+			}
+			return m, loadCallGraph(m.store, m.currentRepo(), g.root.symbol, direction)
+		case key.Matches(msg, m.keys.Select):
+			return m, m.jumpToSymbol(g.selected().symbol)
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m model) viewCallGraph() string {
+	g := m.callGraph
+	title := "Callees"
+	if g.direction == callers {
+		title = "Callers"
+	}
+	header := titleStyle.Render(fmt.Sprintf("%s of %s", title, extractSymbolName(g.root.symbol)))
+	k := m.keys
+	help := helpStyle.Render(strings.Join([]string{
+		keyHelp("move", k.Down, k.Up),
+		keyHelp("expand", k.Right),
+		keyHelp("collapse/parent", k.Left),
+		keyHelp("callers/callees", k.Toggle),
+		keyHelp("open", k.Select),
+		keyHelp("back", k.Back),
+	}, " | "))
+
+	rows := g.visible()
+	height := m.callGraphHeight()
+	offset := g.offset(height)
+	var lines []string
+	for i := offset; i < len(rows) && i < offset+height; i++ {
+		lines = append(lines, m.callGraphRow(rows[i], i == g.cursor))
+	}
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		columnStyle.Render(strings.Join(lines, "\n")),
+		help,
+		helpStyle.Render(m.statusLine()),
+	)
+}
+
+// callGraphHeight is the number of tree rows that fit on screen.
+func (m model) callGraphHeight() int {
+	return max(m.height-4, 1)
+}
+
+// offset returns the first visible row, keeping the cursor centered.
+func (g *callGraph) offset(height int) int {
+	return min(max(g.cursor-height/2, 0), max(len(g.visible())-height, 0))
+}
+
+func (m model) callGraphRow(n *callNode, selected bool) string {
+	marker := "•"
+	switch {
+	case n.cycle:
+		marker = "↺"
+	case n.expanded:
+		marker = "▾"
+	case len(m.callGraph.edges(n.symbol)) > 0:
+		marker = "▸"
+	}
+	name := fmt.Sprintf("%s%s %s", strings.Repeat("  ", n.depth), marker, extractSymbolName(n.symbol))
+	if selected {
+		name = treeCursorStyle.Render(name)
+	}
+	location := "(external)"
+	if entry, ok := m.callGraph.symbols[n.symbol]; ok {
+		location = fmt.Sprintf("%s:%d", entry.path, entry.sym.Line)
+	}
+	suffix := helpStyle.Render(fmt.Sprintf("  [depth %d] %s", n.depth, location))
+	if n.cycle {
+		suffix += cycleStyle.Render("  cycle")
+	}
+	return name + suffix
+}
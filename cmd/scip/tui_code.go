@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/c"
+	"github.com/smacker/go-tree-sitter/cpp"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/java"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+
+	"github.com/sourcegraph/scip/bindings/go/scip"
+)
+
+// treeSitterLanguages maps the language recorded in an RST to the grammar
+// used for syntax highlighting in the TUI.
+var treeSitterLanguages = map[string]func() *sitter.Language{
+	"go":         golang.GetLanguage,
+	"python":     python.GetLanguage,
+	"javascript": javascript.GetLanguage,
+	"typescript": typescript.GetLanguage,
+	"rust":       rust.GetLanguage,
+	"java":       java.GetLanguage,
+	"c":          c.GetLanguage,
+	"cpp":        cpp.GetLanguage,
+}
+
+type tokenKind int
+
+const (
+	tokenPlain tokenKind = iota
+	tokenKeyword
+	tokenString
+	tokenComment
+	tokenNumber
+	tokenType
+	tokenOccurrence
+)
+
+type codeSpan struct {
+	text string
+	kind tokenKind
+	occ  int // Index into highlightedCode.occs for tokenOccurrence
+}
+
+// codeOccurrence is a mention of a dependency symbol inside a code snippet.
+type codeOccurrence struct {
+	symbol string
+	line   int // 0-based line within the snippet
+}
+
+// highlightedCode is a code snippet split into styled spans per line.
+type highlightedCode struct {
+	lines     [][]codeSpan
+	occs      []codeOccurrence
+	firstLine int // Line number of the first line of the snippet
+}
+
+// highlightCode tokenizes code for display, marking identifiers that match
+// one of deps as selectable occurrences. firstLine is the 1-based line number
+// of the first line of code.
+func highlightCode(code, language string, firstLine int, deps []string) highlightedCode {
+	if firstLine <= 0 {
+		firstLine = 1
+	}
+	depsByName := map[string]string{}
+	for _, dep := range deps {
+		name := symbolIdentifier(dep)
+		if _, ok := depsByName[name]; !ok && name != "" {
+			depsByName[name] = dep
+		}
+	}
+
+	var spans []rawSpan
+	if getLanguage, ok := treeSitterLanguages[language]; ok && code != "" {
+		root := sitter.Parse([]byte(code), getLanguage())
+		if root != nil {
+			spans = treeSitterSpans(root, code, depsByName)
+		}
+	} else {
+		spans = identifierSpans(code, depsByName)
+	}
+
+	h := highlightedCode{firstLine: firstLine}
+	line := []codeSpan{}
+	emit := func(text string, kind tokenKind, symbol string) {
+		occ := -1
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				h.lines = append(h.lines, line)
+				line = []codeSpan{}
+			}
+			if part == "" {
+				continue
+			}
+			if kind == tokenOccurrence {
+				if occ == -1 {
+					occ = len(h.occs)
+					h.occs = append(h.occs, codeOccurrence{symbol: symbol, line: len(h.lines)})
+				}
+			}
+			line = append(line, codeSpan{text: strings.ReplaceAll(part, "\t", "    "), kind: kind, occ: occ})
+		}
+	}
+
+	pos := 0
+	for _, span := range spans {
+		if span.start < pos {
+			continue
+		}
+		emit(code[pos:span.start], tokenPlain, "")
+		emit(code[span.start:span.end], span.kind, span.symbol)
+		pos = span.end
+	}
+	emit(code[pos:], tokenPlain, "")
+	h.lines = append(h.lines, line)
+	return h
+}
+
+type rawSpan struct {
+	start, end int
+	kind       tokenKind
+	symbol     string
+}
+
+func treeSitterSpans(root *sitter.Node, code string, depsByName map[string]string) []rawSpan {
+	var spans []rawSpan
+	var walk func(n *sitter.Node)
+	walk = func(n *sitter.Node) {
+		nodeType := n.Type()
+		start, end := int(n.StartByte()), int(n.EndByte())
+		switch {
+		case strings.Contains(nodeType, "comment"):
+			spans = append(spans, rawSpan{start, end, tokenComment, ""})
+			return
+		case strings.Contains(nodeType, "string") || strings.Contains(nodeType, "char_literal"):
+			spans = append(spans, rawSpan{start, end, tokenString, ""})
+			return
+		}
+		if n.ChildCount() > 0 {
+			for i := 0; i < int(n.ChildCount()); i++ {
+				walk(n.Child(i))
+			}
+			return
+		}
+		text := code[start:end]
+		switch {
+		case strings.HasSuffix(nodeType, "identifier"):
+			if symbol, ok := depsByName[text]; ok {
+				spans = append(spans, rawSpan{start, end, tokenOccurrence, symbol})
+			} else if nodeType == "type_identifier" {
+				spans = append(spans, rawSpan{start, end, tokenType, ""})
+			}
+		case nodeType == "primitive_type" || nodeType == "predefined_type":
+			spans = append(spans, rawSpan{start, end, tokenType, ""})
+		case !n.IsNamed():
+			if isKeyword(nodeType) {
+				spans = append(spans, rawSpan{start, end, tokenKeyword, ""})
+			}
+		case strings.Contains(nodeType, "int_literal") || strings.Contains(nodeType, "integer") ||
+			strings.Contains(nodeType, "float") || strings.Contains(nodeType, "number"):
+			spans = append(spans, rawSpan{start, end, tokenNumber, ""})
+		}
+	}
+	walk(root)
+	return spans
+}
+
+var identifierRegexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// identifierSpans is the fallback for languages without a tree-sitter
+// grammar: only dependency occurrences are highlighted.
+func identifierSpans(code string, depsByName map[string]string) []rawSpan {
+	var spans []rawSpan
+	for _, loc := range identifierRegexp.FindAllStringIndex(code, -1) {
+		if symbol, ok := depsByName[code[loc[0]:loc[1]]]; ok {
+			spans = append(spans, rawSpan{loc[0], loc[1], tokenOccurrence, symbol})
+		}
+	}
+	return spans
+}
+
+// isKeyword reports whether an anonymous node type is a word, such as
+// "func" or "return", rather than punctuation.
+func isKeyword(nodeType string) bool {
+	for _, r := range nodeType {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return false
+		}
+	}
+	return nodeType != ""
+}
+
+// symbolIdentifier returns the name of the last descriptor of a SCIP symbol,
+// which is how the symbol is spelled in source code.
+func symbolIdentifier(symbol string) string {
+	if parsed, err := scip.ParseSymbol(symbol); err == nil && len(parsed.Descriptors) > 0 {
+		return parsed.Descriptors[len(parsed.Descriptors)-1].Name
+	}
+	name := extractSymbolName(symbol)
+	if i := strings.LastIndexAny(name, "#./"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// render returns the snippet with a line number gutter, highlighting the
+// occurrence at index selected.
+func (h highlightedCode) render(selected int) string {
+	width := len(fmt.Sprint(h.firstLine + len(h.lines) - 1))
+	var out strings.Builder
+	for i, line := range h.lines {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(lineNumberStyle.Render(fmt.Sprintf("%*d │ ", width, h.firstLine+i)))
+		for _, span := range line {
+			out.WriteString(span.style(selected).Render(span.text))
+		}
+	}
+	return out.String()
+}
+
+func (s codeSpan) style(selected int) lipgloss.Style {
+	switch s.kind {
+	case tokenKeyword:
+		return keywordStyle
+	case tokenString:
+		return stringStyle
+	case tokenComment:
+		return commentStyle
+	case tokenNumber:
+		return numberStyle
+	case tokenType:
+		return typeStyle
+	case tokenOccurrence:
+		if s.occ == selected {
+			return selectedOccurrenceStyle
+		}
+		return occurrenceStyle
+	}
+	return lipgloss.NewStyle()
+}
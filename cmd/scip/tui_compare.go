@@ -0,0 +1,612 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sourcegraph/scip/bindings/go/scip"
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+type diffStatus int
+
+const (
+	diffUnchanged diffStatus = iota
+	diffAdded
+	diffRemoved
+	diffChanged
+)
+
+func (s diffStatus) marker() string {
+	switch s {
+	case diffAdded:
+		return "+"
+	case diffRemoved:
+		return "-"
+	case diffChanged:
+		return "~"
+	}
+	return " "
+}
+
+func (s diffStatus) style() lipgloss.Style {
+	switch s {
+	case diffAdded:
+		return addedStyle
+	case diffRemoved:
+		return removedStyle
+	case diffChanged:
+		return changedStyle
+	}
+	return lipgloss.NewStyle()
+}
+
+// symbolDiff compares a symbol between the old and the new RST. old is nil
+// for added symbols and new is nil for removed ones. Symbols are matched
+// without their package version, so symbol and oldSymbol differ if only the
+// version changed.
+type symbolDiff struct {
+	symbol    string // The newest version of the symbol
+	oldSymbol string // Empty for added symbols
+	status    diffStatus
+	changes   []string // What changed: "version", "signature", "code" or "edges"
+	old       *rst.Symbol
+	new       *rst.Symbol
+}
+
+type fileDiff struct {
+	path    string
+	status  diffStatus
+	symbols []symbolDiff // Only symbols that differ
+}
+
+// compareRSTs lists the files and symbols that differ between old and new,
+// sorted by path and line.
+func compareRSTs(old, new *rst.RST) []fileDiff {
+	var paths []string
+	for path := range old.Documents {
+		paths = append(paths, path)
+	}
+	for path := range new.Documents {
+		if _, ok := old.Documents[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var files []fileDiff
+	for _, path := range paths {
+		oldDoc, newDoc := old.Documents[path], new.Documents[path]
+		file := fileDiff{path: path, status: diffChanged}
+		switch {
+		case oldDoc == nil:
+			file.status = diffAdded
+		case newDoc == nil:
+			file.status = diffRemoved
+		}
+		file.symbols = compareDocuments(oldDoc, newDoc)
+		if file.status == diffChanged && len(file.symbols) == 0 {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func compareDocuments(old, new *rst.Document) []symbolDiff {
+	oldSymbols, newSymbols := versionlessSymbols(old), versionlessSymbols(new)
+	var diffs []symbolDiff
+	for key, oldSym := range oldSymbols {
+		newSym, ok := newSymbols[key]
+		if !ok {
+			diffs = append(diffs, symbolDiff{symbol: oldSym.symbol, oldSymbol: oldSym.symbol, status: diffRemoved, old: oldSym.Symbol})
+			continue
+		}
+		// Version changes alone are listed once per package, see
+		// comparePackageVersions.
+		if changes := compareSymbols(oldSym.Symbol, newSym.Symbol); len(changes) > 0 {
+			if oldSym.symbol != newSym.symbol {
+				changes = append([]string{"version"}, changes...)
+			}
+			diffs = append(diffs, symbolDiff{
+				symbol: newSym.symbol, oldSymbol: oldSym.symbol, status: diffChanged, changes: changes,
+				old: oldSym.Symbol, new: newSym.Symbol,
+			})
+		}
+	}
+	for key, newSym := range newSymbols {
+		if _, ok := oldSymbols[key]; !ok {
+			diffs = append(diffs, symbolDiff{symbol: newSym.symbol, status: diffAdded, new: newSym.Symbol})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if li, lj := diffs[i].line(), diffs[j].line(); li != lj {
+			return li < lj
+		}
+		return diffs[i].symbol < diffs[j].symbol
+	})
+	return diffs
+}
+
+// comparePackageVersions lists the packages whose version differs between
+// old and new, as "name old → new".
+func comparePackageVersions(old, new *rst.RST) []string {
+	oldVersions, newVersions := packageVersions(old), packageVersions(new)
+	var changes []string
+	for name, oldVersion := range oldVersions {
+		if newVersion, ok := newVersions[name]; ok && newVersion != oldVersion {
+			changes = append(changes, fmt.Sprintf("%s %s → %s", name, oldVersion, newVersion))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// packageVersions maps the names of the packages defining the symbols of r
+// to their version.
+func packageVersions(r *rst.RST) map[string]string {
+	versions := map[string]string{}
+	for _, doc := range r.GetDocuments() {
+		for symbol := range doc.GetSymbols() {
+			parsed, err := scip.ParseSymbol(symbol)
+			if err != nil || parsed.Package == nil || parsed.Package.Version == "" {
+				continue
+			}
+			versions[parsed.Package.Name] = parsed.Package.Version
+		}
+	}
+	return versions
+}
+
+// keyedSymbol is a symbol of a document with its key in the document.
+type keyedSymbol struct {
+	symbol string
+	*rst.Symbol
+}
+
+// versionlessSymbols maps the symbols of doc by versionlessSymbol.
+func versionlessSymbols(doc *rst.Document) map[string]keyedSymbol {
+	symbols := map[string]keyedSymbol{}
+	for symbol, sym := range doc.GetSymbols() {
+		symbols[versionlessSymbol(symbol)] = keyedSymbol{symbol, sym}
+	}
+	return symbols
+}
+
+// versionlessSymbol returns symbol without its package version, so that
+// RSTs built at different versions of a package can be compared. Symbols
+// without a package, such as local symbols, are returned as is.
+func versionlessSymbol(symbol string) string {
+	parsed, err := scip.ParseSymbol(symbol)
+	if err != nil || parsed.Package == nil || parsed.Package.Version == "" {
+		return symbol
+	}
+	parsed.Package.Version = ""
+	return scip.VerboseSymbolFormatter.FormatSymbol(parsed)
+}
+
+// symbolVersion returns the package version of symbol, if any.
+func symbolVersion(symbol string) string {
+	parsed, err := scip.ParseSymbol(symbol)
+	if err != nil || parsed.Package == nil {
+		return ""
+	}
+	return parsed.Package.Version
+}
+
+// compareSymbols returns what differs between two versions of a symbol.
+// Line numbers are ignored, as they shift with every unrelated edit.
+func compareSymbols(old, new *rst.Symbol) []string {
+	var changes []string
+	if old.Signature != new.Signature {
+		changes = append(changes, "signature")
+	}
+	if old.Code != new.Code {
+		changes = append(changes, "code")
+	}
+	if !sameEdges(old.DependenceOn, new.DependenceOn) || !sameEdges(old.ReferenceBy, new.ReferenceBy) {
+		changes = append(changes, "edges")
+	}
+	return changes
+}
+
+func sameEdges(a, b []string) bool {
+	removed, added := edgeChanges(a, b)
+	return len(removed) == 0 && len(added) == 0
+}
+
+// line returns the line of the newest version of the symbol.
+func (d symbolDiff) line() int32 {
+	if d.new != nil {
+		return d.new.Line
+	}
+	return d.old.Line
+}
+
+// text renders the changes of the symbol: the signatures, a unified diff of
+// the code and the added and removed edges.
+func (d symbolDiff) text() string {
+	// The getters treat the missing side of added and removed symbols as empty.
+	oldSym, newSym := d.old, d.new
+
+	var lines []string
+	if d.oldSymbol != "" && d.new != nil && d.oldSymbol != d.symbol {
+		lines = append(lines, titleStyle.Render("Version:"))
+		lines = append(lines, "-"+symbolVersion(d.oldSymbol), "+"+symbolVersion(d.symbol), "")
+	}
+
+	if oldSym.GetSignature() != newSym.GetSignature() {
+		lines = append(lines, titleStyle.Render("Signature:"))
+		if oldSym.GetSignature() != "" {
+			lines = append(lines, "-"+oldSym.GetSignature())
+		}
+		if newSym.GetSignature() != "" {
+			lines = append(lines, "+"+newSym.GetSignature())
+		}
+		lines = append(lines, "")
+	}
+
+	if oldSym.GetCode() != newSym.GetCode() {
+		oldCode, newCode := withTrailingNewline(oldSym.GetCode()), withTrailingNewline(newSym.GetCode())
+		edits := myers.ComputeEdits(span.URIFromPath(d.symbol), oldCode, newCode)
+		unified := fmt.Sprint(gotextdiff.ToUnified("old", "new", oldCode, edits))
+		lines = append(lines, titleStyle.Render("Code:"))
+		lines = append(lines, strings.Split(strings.TrimSuffix(unified, "\n"), "\n")...)
+		lines = append(lines, "")
+	}
+
+	for _, edges := range []struct {
+		title    string
+		old, new []string
+	}{
+		{"Dependencies:", oldSym.GetDependenceOn(), newSym.GetDependenceOn()},
+		{"References:", oldSym.GetReferenceBy(), newSym.GetReferenceBy()},
+	} {
+		removed, added := edgeChanges(edges.old, edges.new)
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+		lines = append(lines, titleStyle.Render(edges.title))
+		for _, edge := range removed {
+			lines = append(lines, "-"+extractSymbolName(edge))
+		}
+		for _, edge := range added {
+			lines = append(lines, "+"+extractSymbolName(edge))
+		}
+		lines = append(lines, "")
+	}
+
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+			lines[i] = helpStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = addedStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = removedStyle.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func withTrailingNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
+
+// edgeChanges returns the edges only in old and the edges only in new.
+// Edges to the same symbol at another package version are the same edge.
+func edgeChanges(old, new []string) (removed, added []string) {
+	oldKeys, newKeys := versionlessEdges(old), versionlessEdges(new)
+	for _, edge := range old {
+		if !newKeys[versionlessSymbol(edge)] {
+			removed = append(removed, edge)
+		}
+	}
+	for _, edge := range new {
+		if !oldKeys[versionlessSymbol(edge)] {
+			added = append(added, edge)
+		}
+	}
+	return removed, added
+}
+
+func versionlessEdges(edges []string) map[string]bool {
+	keys := make(map[string]bool, len(edges))
+	for _, edge := range edges {
+		keys[versionlessSymbol(edge)] = true
+	}
+	return keys
+}
+
+type compareFileItem struct{ fileDiff }
+
+func (i compareFileItem) Title() string {
+	return i.status.style().Render(i.status.marker()) + " " + i.path
+}
+func (i compareFileItem) Description() string { return "" }
+func (i compareFileItem) FilterValue() string { return i.path }
+
+type compareSymbolItem struct{ symbolDiff }
+
+func (i compareSymbolItem) Title() string {
+	return i.status.style().Render(i.status.marker()) + " " + extractSymbolName(i.symbol)
+}
+func (i compareSymbolItem) Description() string {
+	switch i.status {
+	case diffAdded:
+		return fmt.Sprintf("added (line %d)", i.line())
+	case diffRemoved:
+		return fmt.Sprintf("removed (line %d)", i.line())
+	}
+	return fmt.Sprintf("%s (line %d)", strings.Join(i.changes, ", "), i.line())
+}
+func (i compareSymbolItem) FilterValue() string { return extractSymbolName(i.symbol) }
+
+// comparison is the state of the compare mode.
+type comparison struct {
+	oldName, newName string
+	versions         []string // See comparePackageVersions
+	files            list.Model
+	symbols          list.Model
+	diff             viewport.Model
+	active           int // 0: files, 1: symbols, 2: diff
+}
+
+type comparisonMsg struct {
+	oldName, newName string
+	versions         []string
+	files            []fileDiff
+}
+
+// loadComparison reads two RSTs of the same repo and compares them. Each
+// path is an RST file or a SCIP index with documents of one language.
+func loadComparison(oldPath, newPath, projectRoot string) tea.Cmd {
+	return func() tea.Msg {
+		old, err := readComparedRST(oldPath, projectRoot)
+		if err != nil {
+			return errMsg{err}
+		}
+		new, err := readComparedRST(newPath, projectRoot)
+		if err != nil {
+			return errMsg{err}
+		}
+		return comparisonMsg{
+			oldName:  oldPath,
+			newName:  newPath,
+			versions: comparePackageVersions(old, new),
+			files:    compareRSTs(old, new),
+		}
+	}
+}
+
+func readComparedRST(path, projectRoot string) (*rst.RST, error) {
+	if !strings.HasSuffix(path, ".scip") {
+		return readRSTFile(path)
+	}
+	rsts, err := buildMemoryRSTs(path, "", projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	languages := slices.Collect(maps.Values(rsts))
+	if len(languages) != 1 {
+		return nil, fmt.Errorf("%s has documents in %d languages; compare the RSTs from 'scip parse' instead", path, len(languages))
+	}
+	return languages[0], nil
+}
+
+func newComparison(msg comparisonMsg) *comparison {
+	singleDelegate := list.NewDefaultDelegate()
+	singleDelegate.ShowDescription = false
+	singleDelegate.SetSpacing(0)
+
+	c := &comparison{
+		oldName:  msg.oldName,
+		newName:  msg.newName,
+		versions: msg.versions,
+		files:    list.New(nil, singleDelegate, 0, 0),
+		symbols:  list.New(nil, list.NewDefaultDelegate(), 0, 0),
+		diff:     viewport.New(0, 0),
+	}
+	c.files.SetShowHelp(false)
+	c.files.SetFilteringEnabled(false)
+	c.files.SetStatusBarItemName("changed file", "changed files")
+	c.symbols.SetShowHelp(false)
+	c.symbols.SetFilteringEnabled(false)
+	c.symbols.SetStatusBarItemName("changed symbol", "changed symbols")
+
+	var added, removed, changed int
+	items := make([]list.Item, len(msg.files))
+	for i, file := range msg.files {
+		items[i] = compareFileItem{file}
+		switch file.status {
+		case diffAdded:
+			added++
+		case diffRemoved:
+			removed++
+		default:
+			changed++
+		}
+	}
+	c.files.Title = fmt.Sprintf("Files +%d -%d ~%d", added, removed, changed)
+	c.symbols.Title = "Symbols"
+	c.files.SetItems(items)
+	c.selectFile()
+	return c
+}
+
+// selectFile shows the symbols of the selected file.
+func (c *comparison) selectFile() {
+	var items []list.Item
+	if file, ok := c.files.SelectedItem().(compareFileItem); ok {
+		for _, sym := range file.symbols {
+			items = append(items, compareSymbolItem{sym})
+		}
+	}
+	c.symbols.SetItems(items)
+	c.symbols.Select(0)
+	c.selectSymbol()
+}
+
+// selectSymbol shows the diff of the selected symbol.
+func (c *comparison) selectSymbol() {
+	content := ""
+	if sym, ok := c.symbols.SelectedItem().(compareSymbolItem); ok {
+		content = sym.text()
+	}
+	c.diff.SetContent(content)
+	c.diff.GotoTop()
+}
+
+func (c *comparison) resize(width, height int, panes []int) {
+	total := panes[0] + panes[1] + panes[2]
+	h := height - 4
+	c.files.SetSize(max(width*panes[0]/total-columnChrome, 1), h)
+	c.symbols.SetSize(max(width*panes[1]/total-columnChrome, 1), h)
+	c.diff.Width = max(width*panes[2]/total-columnChrome, 1)
+	c.diff.Height = h
+}
+
+func (m model) updateCompareMode(msg tea.Msg) (tea.Model, tea.Cmd) {
+	c := m.compare
+	switch msg := msg.(type) {
+	case errMsg:
+		m.status = fmt.Sprintf("Error: %v", msg.err)
+		return m, nil
+	case comparisonMsg:
+		m.compare = newComparison(msg)
+		m.compare.resize(m.width, m.height, m.panes)
+		return m, nil
+	}
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if key.Matches(keyMsg, m.keys.Quit) {
+		return m, tea.Quit
+	}
+	if c == nil {
+		return m, nil
+	}
+	switch {
+	case key.Matches(keyMsg, m.keys.Left):
+		c.active = max(c.active-1, 0)
+	case key.Matches(keyMsg, m.keys.Right, m.keys.Select):
+		c.active = min(c.active+1, 2)
+	case key.Matches(keyMsg, m.keys.Down):
+		c.move(1)
+	case key.Matches(keyMsg, m.keys.Up):
+		c.move(-1)
+	case key.Matches(keyMsg, m.keys.Top):
+		c.diff.GotoTop()
+	case key.Matches(keyMsg, m.keys.Bottom):
+		c.diff.GotoBottom()
+	}
+	return m, nil
+}
+
+// move moves the selection of the focused column, or scrolls the diff.
+func (c *comparison) move(delta int) {
+	switch c.active {
+	case 0:
+		if delta < 0 {
+			c.files.CursorUp()
+		} else {
+			c.files.CursorDown()
+		}
+		c.selectFile()
+	case 1:
+		if delta < 0 {
+			c.symbols.CursorUp()
+		} else {
+			c.symbols.CursorDown()
+		}
+		c.selectSymbol()
+	case 2:
+		if delta < 0 {
+			c.diff.LineUp(1)
+		} else {
+			c.diff.LineDown(1)
+		}
+	}
+}
+
+// mouseCompare focuses the column under the mouse and scrolls it with the
+// wheel.
+func (m model) mouseCompare(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	c := m.compare
+	delta := wheelDelta(msg)
+	if c == nil || (delta == 0 && !isLeftClick(msg)) {
+		return m, nil
+	}
+	column, left := 2, 0
+	for i, width := range []int{c.files.Width(), c.symbols.Width()} {
+		left += width + columnChrome
+		if msg.X < left {
+			column = i
+			break
+		}
+	}
+	c.active = column
+	if delta != 0 {
+		if column == 2 {
+			delta *= mouseWheelLines
+		}
+		for range max(delta, -delta) {
+			c.move(delta)
+		}
+	}
+	return m, nil
+}
+
+func (m model) viewCompare() string {
+	c := m.compare
+	if c == nil {
+		return helpStyle.Render("Loading comparison... " + m.statusLine())
+	}
+	header := titleStyle.Render(fmt.Sprintf("Comparing %s → %s", c.oldName, c.newName))
+	if len(c.versions) > 0 {
+		header += " " + helpStyle.Render("("+strings.Join(c.versions, ", ")+")")
+	}
+
+	styles := []lipgloss.Style{columnStyle, columnStyle, columnStyle}
+	styles[c.active] = activeColumnStyle
+	diff := styles[2].Width(c.diff.Width + columnChrome - 2).Render(c.diff.View())
+	if len(c.files.Items()) == 0 {
+		diff = styles[2].Render("No differences")
+	}
+
+	k := m.keys
+	help := helpStyle.Render(strings.Join([]string{
+		keyHelp("focus", k.Left, k.Right),
+		keyHelp("move/scroll", k.Down, k.Up),
+		keyHelp("top/bottom", k.Top, k.Bottom),
+		keyHelp("quit", k.Quit),
+	}, " | "))
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		header,
+		lipgloss.JoinHorizontal(lipgloss.Top,
+			renderColumn(styles[0], c.files),
+			renderColumn(styles[1], c.symbols),
+			diff,
+		),
+		help,
+		helpStyle.Render(m.statusLine()),
+	)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+// tuiConfig is read from ~/.config/scip/tui.yaml. Every field is optional
+// and falls back to the defaults below.
+//
+//	keys:
+//	  quit: [q, ctrl+c]
+//	  down: [j, down, ctrl+n]
+//	theme:
+//	  active_border: "#ff8800"
+//	panes: [1, 2, 2]
+type tuiConfig struct {
+	// Keys maps action names to the keys that trigger them, see keyMap.
+	Keys map[string][]string `yaml:"keys"`
+	// Theme overrides colors of the default theme.
+	Theme theme `yaml:"theme"`
+	// Panes are the relative widths of the repos, files and symbols panes.
+	Panes []int `yaml:"panes"`
+}
+
+// theme holds the colors of the TUI as lipgloss color strings: ANSI
+// numbers such as "63" or hex values such as "#ff8800".
+type theme struct {
+	Border       string `yaml:"border"`
+	ActiveBorder string `yaml:"active_border"`
+	Title        string `yaml:"title"`
+	Help         string `yaml:"help"`
+	Dependency   string `yaml:"dependency"`
+	Reference    string `yaml:"reference"`
+	Keyword      string `yaml:"keyword"`
+	String       string `yaml:"string"`
+	Comment      string `yaml:"comment"`
+	Number       string `yaml:"number"`
+	Type         string `yaml:"type"`
+	LineNumber   string `yaml:"line_number"`
+	Occurrence   string `yaml:"occurrence"`
+	TreeCursor   string `yaml:"tree_cursor"`
+	Cycle        string `yaml:"cycle"`
+	Error        string `yaml:"error"`
+	Warning      string `yaml:"warning"`
+	Info         string `yaml:"info"`
+	Added        string `yaml:"added"`
+	Removed      string `yaml:"removed"`
+	Changed      string `yaml:"changed"`
+}
+
+var defaultTheme = theme{
+	Border:       "240",
+	ActiveBorder: "63",
+	Title:        "5",
+	Help:         "8",
+	Dependency:   "6",
+	Reference:    "3",
+	Keyword:      "5",
+	String:       "2",
+	Comment:      "8",
+	Number:       "3",
+	Type:         "4",
+	LineNumber:   "240",
+	Occurrence:   "6",
+	TreeCursor:   "63",
+	Cycle:        "1",
+	Error:        "1",
+	Warning:      "3",
+	Info:         "4",
+	Added:        "2",
+	Removed:      "1",
+	Changed:      "3",
+}
+
+// defaultPanes splits the three-pane view 20/40/40.
+var defaultPanes = []int{2, 4, 4}
+
+var (
+	columnStyle       lipgloss.Style
+	activeColumnStyle lipgloss.Style
+	titleStyle        lipgloss.Style
+	helpStyle         lipgloss.Style
+	depStyle          lipgloss.Style
+	refStyle          lipgloss.Style
+
+	keywordStyle            lipgloss.Style
+	stringStyle             lipgloss.Style
+	commentStyle            lipgloss.Style
+	numberStyle             lipgloss.Style
+	typeStyle               lipgloss.Style
+	lineNumberStyle         lipgloss.Style
+	occurrenceStyle         lipgloss.Style
+	selectedOccurrenceStyle lipgloss.Style
+
+	treeCursorStyle lipgloss.Style
+	cycleStyle      lipgloss.Style
+
+	errorStyle   lipgloss.Style
+	warningStyle lipgloss.Style
+	infoStyle    lipgloss.Style
+
+	addedStyle   lipgloss.Style
+	removedStyle lipgloss.Style
+	changedStyle lipgloss.Style
+)
+
+func init() {
+	applyTheme(defaultTheme)
+}
+
+// applyTheme rebuilds the styles used across the TUI from t.
+func applyTheme(t theme) {
+	color := func(c string) lipgloss.Color { return lipgloss.Color(c) }
+	fg := func(c string) lipgloss.Style { return lipgloss.NewStyle().Foreground(color(c)) }
+
+	columnStyle = lipgloss.NewStyle().
+		BorderForeground(color(t.Border)).
+		BorderStyle(lipgloss.NormalBorder()).
+		Padding(0, 1)
+	activeColumnStyle = columnStyle.BorderForeground(color(t.ActiveBorder))
+	titleStyle = fg(t.Title).Bold(true)
+	helpStyle = fg(t.Help)
+	depStyle = fg(t.Dependency)
+	refStyle = fg(t.Reference)
+
+	keywordStyle = fg(t.Keyword)
+	stringStyle = fg(t.String)
+	commentStyle = fg(t.Comment).Italic(true)
+	numberStyle = fg(t.Number)
+	typeStyle = fg(t.Type)
+	lineNumberStyle = fg(t.LineNumber)
+	occurrenceStyle = fg(t.Occurrence).Underline(true)
+	selectedOccurrenceStyle = occurrenceStyle.Reverse(true)
+
+	treeCursorStyle = fg(t.TreeCursor).Bold(true)
+	cycleStyle = fg(t.Cycle)
+
+	errorStyle = fg(t.Error).Bold(true)
+	warningStyle = fg(t.Warning)
+	infoStyle = fg(t.Info)
+
+	addedStyle = fg(t.Added)
+	removedStyle = fg(t.Removed)
+	changedStyle = fg(t.Changed)
+}
+
+// keyMap holds the key bindings of the TUI. Bindings are shared between
+// views, e.g. "down" moves the selection in every list.
+type keyMap struct {
+	Quit           key.Binding
+	Back           key.Binding
+	Find           key.Binding
+	Edit           key.Binding
+	Diagnostics    key.Binding
+	Bookmark       key.Binding
+	Bookmarks      key.Binding
+	History        key.Binding
+	Delete         key.Binding
+	Up             key.Binding
+	Down           key.Binding
+	Left           key.Binding
+	Right          key.Binding
+	Select         key.Binding
+	Deps           key.Binding
+	Refs           key.Binding
+	Top            key.Binding
+	Bottom         key.Binding
+	Callees        key.Binding
+	Callers        key.Binding
+	NextOccurrence key.Binding
+	PrevOccurrence key.Binding
+	Expand         key.Binding
+	Toggle         key.Binding
+}
+
+func defaultKeyMap() keyMap {
+	keys := func(k ...string) key.Binding { return key.NewBinding(key.WithKeys(k...)) }
+	return keyMap{
+		Quit:           keys("q", "ctrl+c"),
+		Back:           keys("q", "esc"),
+		Find:           keys("/", "ctrl+p"),
+		Edit:           keys("e"),
+		Diagnostics:    keys("d"),
+		Bookmark:       keys("b"),
+		Bookmarks:      keys("B"),
+		History:        keys("H"),
+		Delete:         keys("x", "delete"),
+		Up:             keys("k", "up", "ctrl+k"),
+		Down:           keys("j", "down", "ctrl+j", "ctrl+n"),
+		Left:           keys("h", "left"),
+		Right:          keys("l", "right"),
+		Select:         keys("enter"),
+		Deps:           keys("r"),
+		Refs:           keys("R"),
+		Top:            keys("g", "home"),
+		Bottom:         keys("G", "end"),
+		Callees:        keys("c"),
+		Callers:        keys("C"),
+		NextOccurrence: keys("n"),
+		PrevOccurrence: keys("N"),
+		Expand:         keys(" "),
+		Toggle:         keys("tab"),
+	}
+}
+
+// bindings maps the action names used in the config file to the bindings.
+func (k *keyMap) bindings() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"quit":            &k.Quit,
+		"back":            &k.Back,
+		"find":            &k.Find,
+		"edit":            &k.Edit,
+		"diagnostics":     &k.Diagnostics,
+		"bookmark":        &k.Bookmark,
+		"bookmarks":       &k.Bookmarks,
+		"history":         &k.History,
+		"delete":          &k.Delete,
+		"up":              &k.Up,
+		"down":            &k.Down,
+		"left":            &k.Left,
+		"right":           &k.Right,
+		"select":          &k.Select,
+		"deps":            &k.Deps,
+		"refs":            &k.Refs,
+		"top":             &k.Top,
+		"bottom":          &k.Bottom,
+		"callees":         &k.Callees,
+		"callers":         &k.Callers,
+		"next_occurrence": &k.NextOccurrence,
+		"prev_occurrence": &k.PrevOccurrence,
+		"expand":          &k.Expand,
+		"toggle":          &k.Toggle,
+	}
+}
+
+// keyName returns the first key of b for help texts.
+func keyName(b key.Binding) string {
+	if keys := b.Keys(); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// keyHelp renders the first key of each binding and a description for help
+// texts, e.g. "h/l: focus".
+func keyHelp(desc string, bindings ...key.Binding) string {
+	names := make([]string, len(bindings))
+	for i, b := range bindings {
+		names[i] = keyName(b)
+	}
+	return strings.Join(names, "/") + ": " + desc
+}
+
+// defaultTUIConfigPath returns $XDG_CONFIG_HOME/scip/tui.yaml, falling back
+// to ~/.config/scip/tui.yaml.
+func defaultTUIConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "scip", "tui.yaml")
+	}
+	return expandHome("~/.config/scip/tui.yaml")
+}
+
+// loadTUIConfig reads the config file at path. A missing file is not an
+// error unless required is set.
+func loadTUIConfig(path string, required bool) (tuiConfig, error) {
+	// Colors missing from the file keep their default.
+	config := tuiConfig{Theme: defaultTheme}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return config, nil
+		}
+		return config, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse TUI config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// applyConfig applies the key bindings, theme and pane proportions of
+// config on top of the defaults.
+func (m *model) applyConfig(config tuiConfig) error {
+	bindings := m.keys.bindings()
+	for action, keys := range config.Keys {
+		binding, ok := bindings[action]
+		if !ok {
+			return fmt.Errorf("unknown action %q in key bindings", action)
+		}
+		if len(keys) == 0 {
+			binding.SetEnabled(false)
+			continue
+		}
+		binding.SetKeys(keys...)
+	}
+	for _, l := range []*list.Model{&m.diagnostics, &m.bookmarks, &m.history} {
+		l.KeyMap.CursorUp = m.keys.Up
+		l.KeyMap.CursorDown = m.keys.Down
+	}
+
+	applyTheme(config.Theme)
+
+	if len(config.Panes) > 0 {
+		if len(config.Panes) != 3 {
+			return fmt.Errorf("panes must have 3 entries, got %d", len(config.Panes))
+		}
+		for _, p := range config.Panes {
+			if p <= 0 {
+				return fmt.Errorf("pane proportions must be positive, got %v", config.Panes)
+			}
+		}
+		m.panes = config.Panes
+	}
+	return nil
+}
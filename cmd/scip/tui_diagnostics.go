@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sourcegraph/scip/bindings/go/scip"
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+// diagnosticCounts counts the diagnostics of a file by severity.
+type diagnosticCounts struct {
+	errors   int
+	warnings int
+	others   int // Information, hints and unspecified severities
+}
+
+func countDiagnostics(diagnostics []*rst.Diagnostic) diagnosticCounts {
+	var counts diagnosticCounts
+	for _, diag := range diagnostics {
+		switch diag.Severity {
+		case scip.Severity_Error.String():
+			counts.errors++
+		case scip.Severity_Warning.String():
+			counts.warnings++
+		default:
+			counts.others++
+		}
+	}
+	return counts
+}
+
+// String renders the counts for the Files column, e.g. "E2 W1".
+func (c diagnosticCounts) String() string {
+	var parts []string
+	if c.errors > 0 {
+		parts = append(parts, fmt.Sprintf("E%d", c.errors))
+	}
+	if c.warnings > 0 {
+		parts = append(parts, fmt.Sprintf("W%d", c.warnings))
+	}
+	if c.others > 0 {
+		parts = append(parts, fmt.Sprintf("I%d", c.others))
+	}
+	return strings.Join(parts, " ")
+}
+
+// severityRank orders severities from most to least severe, with
+// unspecified severities last.
+func severityRank(severity string) int {
+	rank, ok := scip.Severity_value[severity]
+	if !ok || rank == 0 {
+		return len(scip.Severity_value)
+	}
+	return int(rank)
+}
+
+// diagnosticItem is a diagnostic listed in the diagnostics pane.
+type diagnosticItem struct {
+	repo string
+	path string
+	diag *rst.Diagnostic
+}
+
+func (i diagnosticItem) Title() string {
+	var style lipgloss.Style
+	switch i.diag.Severity {
+	case scip.Severity_Error.String():
+		style = errorStyle
+	case scip.Severity_Warning.String():
+		style = warningStyle
+	default:
+		style = infoStyle
+	}
+	return fmt.Sprintf("%s %s", style.Render(i.diag.Severity), i.diag.Message)
+}
+
+func (i diagnosticItem) Description() string {
+	desc := fmt.Sprintf("%s:%d:%d", i.path, i.diag.Line, i.diag.Column)
+	for _, s := range []string{i.diag.Source, i.diag.Code, strings.Join(i.diag.Tags, ",")} {
+		if s != "" {
+			desc += " · " + s
+		}
+	}
+	return desc
+}
+
+func (i diagnosticItem) FilterValue() string { return i.diag.Message + " " + i.path }
+
+type diagnosticsLoadedMsg struct {
+	repo  string
+	items []list.Item
+}
+
+// diagnosticFileMsg selects a file in the three-pane view when a diagnostic
+// is not inside any symbol.
+type diagnosticFileMsg struct {
+	repo string
+	path string
+}
+
+func newDiagnostics() list.Model {
+	diagnostics := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	diagnostics.Title = "Diagnostics"
+	diagnostics.SetShowHelp(false)
+	diagnostics.SetStatusBarItemName("diagnostic", "diagnostics")
+	return diagnostics
+}
+
+// loadDiagnostics lists the diagnostics of every file of repo, most severe
+// first.
+func loadDiagnostics(store rstStore, repo string) tea.Cmd {
+	return func() tea.Msg {
+		r, err := store.read(repoToRSTFile(repo))
+		if err != nil {
+			return errMsg{err}
+		}
+		var items []diagnosticItem
+		for path, doc := range r.Documents {
+			for _, diag := range doc.Diagnostics {
+				items = append(items, diagnosticItem{repo: repo, path: path, diag: diag})
+			}
+		}
+		sort.Slice(items, func(i, j int) bool {
+			a, b := items[i], items[j]
+			if ra, rb := severityRank(a.diag.Severity), severityRank(b.diag.Severity); ra != rb {
+				return ra < rb
+			}
+			if a.path != b.path {
+				return a.path < b.path
+			}
+			return a.diag.Line < b.diag.Line
+		})
+		listItems := make([]list.Item, len(items))
+		for i, item := range items {
+			listItems[i] = item
+		}
+		return diagnosticsLoadedMsg{repo: repo, items: listItems}
+	}
+}
+
+// jumpToDiagnostic opens the symbol whose code contains the diagnostic, or
+// selects its file when no symbol contains it.
+func jumpToDiagnostic(store rstStore, item diagnosticItem) tea.Cmd {
+	return func() tea.Msg {
+		r, err := store.read(repoToRSTFile(item.repo))
+		if err != nil {
+			return errMsg{err}
+		}
+		doc, ok := r.Documents[item.path]
+		if !ok {
+			return errMsg{fmt.Errorf("file not found: %s", item.path)}
+		}
+		enclosing := enclosingSymbol(doc, item.diag.Line)
+		if enclosing == "" {
+			return diagnosticFileMsg{repo: item.repo, path: item.path}
+		}
+		detail, _ := findSymbolDetail(r, enclosing)
+		detail.repo = item.repo
+		return symbolDetailMsg{detail: detail}
+	}
+}
+
+// enclosingSymbol returns the symbol whose code spans the 1-based line, or
+// "" if there is none. Symbols without code only span their first line.
+// When symbols are nested, the innermost one, which starts last, is
+// returned, and symbols which start on the same line are ordered by their
+// end and then by name, so that the result doesn't depend on map order.
+func enclosingSymbol(doc *rst.Document, line int32) string {
+	var enclosing string
+	var start, end int32
+	for symKey, sym := range doc.Symbols {
+		symStart, symEnd := sym.Line, sym.Line+int32(strings.Count(sym.Code, "\n"))
+		if sym.Line == 0 || line < symStart || line > symEnd {
+			continue
+		}
+		if enclosing == "" || symStart > start ||
+			(symStart == start && (symEnd < end || (symEnd == end && symKey < enclosing))) {
+			enclosing, start, end = symKey, symStart, symEnd
+		}
+	}
+	return enclosing
+}
+
+func (m model) updateDiagnosticsMode(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case symbolDetailMsg:
+		// Push the current location, so that "h" returns to it.
+		if m.symbol != nil {
+			m.symbolStack = append(m.symbolStack, m.symbol.jump())
+		}
+		m.showSymbol(msg.detail)
+		m.mode = modeSymbol
+		m.active = 0
+		return m, nil
+
+	case errMsg:
+		m.status = fmt.Sprintf("Error: %v", msg.err)
+		return m, nil
+
+	case tea.KeyMsg:
+		m.status = ""
+		if m.diagnostics.FilterState() == list.Filtering {
+			break
+		}
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.mode = modeThreePane
+			return m, nil
+		case key.Matches(msg, m.keys.Select, m.keys.Right):
+			if item, ok := m.diagnostics.SelectedItem().(diagnosticItem); ok {
+				return m, jumpToDiagnostic(m.store, item)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Edit):
+			if item, ok := m.diagnostics.SelectedItem().(diagnosticItem); ok {
+				return m, resolveEditorTarget(m.store, item.repo, m.projectRoot, item.path, int(item.diag.Line))
+			}
+			return m, nil
+		}
+	}
+
+	m.diagnostics, cmd = m.diagnostics.Update(msg)
+	return m, cmd
+}
+
+func (m model) viewDiagnostics() string {
+	k := m.keys
+	help := helpStyle.Render(strings.Join([]string{
+		keyHelp("move", k.Down, k.Up),
+		"/: filter",
+		keyHelp("jump", k.Select, k.Right),
+		keyHelp("edit", k.Edit),
+		keyHelp("back", k.Back),
+	}, " | "))
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		m.diagnostics.View(),
+		help,
+		helpStyle.Render(m.statusLine()),
+	)
+}
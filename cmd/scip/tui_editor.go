@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editorTargetMsg is sent once a file has been resolved on disk and can be
+// opened in $EDITOR.
+type editorTargetMsg struct {
+	path string
+	line int
+}
+
+// resolveEditorTarget resolves relativePath against projectRoot, or against
+// the project root recorded in the RST of repo when projectRoot is empty.
+func resolveEditorTarget(store rstStore, repo, projectRoot, relativePath string, line int) tea.Cmd {
+	return func() tea.Msg {
+		path := relativePath
+		if !filepath.IsAbs(path) {
+			root := projectRoot
+			if root == "" {
+				r, err := store.read(repoToRSTFile(repo))
+				if err != nil {
+					return errMsg{err}
+				}
+				root = r.GetMetadata().GetProjectRoot()
+			}
+			if root == "" {
+				return errMsg{fmt.Errorf("no project root recorded for %s; re-run 'scip parse' or pass --project-root", repo)}
+			}
+			path = filepath.Join(stripFilePrefix(root), relativePath)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return errMsg{fmt.Errorf("file not found locally: %s", path)}
+		}
+		return editorTargetMsg{path: path, line: max(line, 1)}
+	}
+}
+
+// openEditor suspends the TUI and runs $EDITOR +line path.
+func openEditor(path string, line int) tea.Cmd {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	args := append(editor[1:], fmt.Sprintf("+%d", line), path)
+	return tea.ExecProcess(exec.Command(editor[0], args...), func(err error) tea.Msg {
+		if err != nil {
+			return errMsg{fmt.Errorf("running %s: %w", editor[0], err)}
+		}
+		return nil
+	})
+}
+
+// editSelection opens the file or symbol selected in the current view.
+func (m *model) editSelection() tea.Cmd {
+	if m.mode == modeSymbol && m.symbol != nil {
+		return resolveEditorTarget(m.store, m.symbol.repo, m.projectRoot, m.symbol.filePath, m.symbol.line)
+	}
+	repo, ok := m.repos.SelectedItem().(repoItem)
+	if !ok {
+		return nil
+	}
+	file, ok := m.files.SelectedItem().(fileItem)
+	if !ok || m.active == 0 {
+		return nil
+	}
+	line := 1
+	if sym, ok := m.symbols.SelectedItem().(symbolItem); ok && m.active == 2 {
+		line = sym.line
+	}
+	return resolveEditorTarget(m.store, repo.name, m.projectRoot, file.name, line)
+}
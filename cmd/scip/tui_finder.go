@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// finderItem is a file or symbol listed by the fuzzy finder overlay.
+type finderItem struct {
+	repo   string
+	path   string
+	symbol string // Full SCIP symbol; empty for files
+	name   string
+	line   int
+}
+
+func (i finderItem) Title() string {
+	if i.symbol == "" {
+		return i.path
+	}
+	return i.name
+}
+
+func (i finderItem) Description() string {
+	if i.symbol == "" {
+		return fmt.Sprintf("file · %s", i.repo)
+	}
+	return fmt.Sprintf("symbol · %s · %s:%d", i.repo, i.path, i.line)
+}
+
+// FilterValue includes the path for symbols so that queries like
+// "convert Converter" narrow down on a file as well.
+func (i finderItem) FilterValue() string {
+	if i.symbol == "" {
+		return i.path
+	}
+	return i.name + " " + i.path
+}
+
+type finderItemsMsg struct{ items []list.Item }
+
+func newFinder() list.Model {
+	finder := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	finder.SetShowHelp(false)
+	finder.SetStatusBarItemName("match", "matches")
+	return finder
+}
+
+// openFinder shows the finder overlay and starts loading its items.
+func (m *model) openFinder() tea.Cmd {
+	m.finderOpen = true
+	m.finder.ResetFilter()
+	m.finder.SetItems(nil)
+	// Enter the list's own filtering mode right away so that keys typed
+	// while the items are loading already narrow down the results.
+	m.finder.SetFilterState(list.Filtering)
+	m.setFinderTitle()
+	return loadFinderItems(m.store, m.currentRepo(), m.finderAllRepos)
+}
+
+func (m *model) setFinderTitle() {
+	if m.finderAllRepos {
+		m.finder.Title = "Find in all repos"
+	} else {
+		m.finder.Title = fmt.Sprintf("Find in %s", m.currentRepo())
+	}
+}
+
+func (m model) updateFinder(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case finderItemsMsg:
+		// The list is already filtering, so this re-applies the current query.
+		return m, m.finder.SetItems(msg.items)
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, finderBinding(m.keys.Back)):
+			m.finderOpen = false
+			m.finder.ResetFilter()
+			return m, nil
+		case key.Matches(msg, finderBinding(m.keys.Toggle)):
+			m.finderAllRepos = !m.finderAllRepos
+			m.setFinderTitle()
+			return m, loadFinderItems(m.store, m.currentRepo(), m.finderAllRepos)
+		case key.Matches(msg, finderBinding(m.keys.Up)):
+			m.finder.CursorUp()
+			return m, nil
+		case key.Matches(msg, finderBinding(m.keys.Down)):
+			m.finder.CursorDown()
+			return m, nil
+		case key.Matches(msg, finderBinding(m.keys.Select)):
+			item, ok := m.finder.SelectedItem().(finderItem)
+			if !ok {
+				return m, nil
+			}
+			m.finderOpen = false
+			m.finder.ResetFilter()
+			return m, m.openFinderItem(item)
+		}
+	}
+
+	m.finder, cmd = m.finder.Update(msg)
+	return m, cmd
+}
+
+// finderBinding returns the keys of b which don't type text, such as esc
+// or ctrl+n, as the other keys are typed into the query of the finder.
+func finderBinding(b key.Binding) key.Binding {
+	if !b.Enabled() {
+		return key.Binding{}
+	}
+	var keys []string
+	for _, k := range b.Keys() {
+		if len([]rune(k)) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	return key.NewBinding(key.WithKeys(keys...))
+}
+
+// openFinderItem jumps to the symbol detail view for symbols, and selects the
+// file in the three-pane view for files.
+func (m *model) openFinderItem(item finderItem) tea.Cmd {
+	if item.symbol != "" {
+		return loadSymbolDetail(m.store, item.repo, item.symbol)
+	}
+
+	m.mode = modeThreePane
+	m.symbol = nil
+	m.symbolStack = nil
+	if idx := indexOfItem(m.repos.Items(), func(it list.Item) bool {
+		return it.(repoItem).name == item.repo
+	}); idx >= 0 {
+		m.repos.Select(idx)
+	}
+	m.pendingFile = item.path
+	m.active = 2
+	return loadFiles(m.store, item.repo)
+}
+
+func (m model) viewFinder() string {
+	k := m.keys
+	help := []string{"type: filter"}
+	for _, action := range []struct {
+		desc     string
+		bindings []key.Binding
+	}{
+		{"move", []key.Binding{finderBinding(k.Up), finderBinding(k.Down)}},
+		{"toggle all repos", []key.Binding{finderBinding(k.Toggle)}},
+		{"open", []key.Binding{finderBinding(k.Select)}},
+		{"close", []key.Binding{finderBinding(k.Back)}},
+	} {
+		// Actions whose keys all type text can't be used in the finder.
+		if !slices.ContainsFunc(action.bindings, func(b key.Binding) bool { return keyName(b) == "" }) {
+			help = append(help, keyHelp(action.desc, action.bindings...))
+		}
+	}
+	box := activeColumnStyle.Render(lipgloss.JoinVertical(lipgloss.Left, m.finder.View(),
+		helpStyle.Render(strings.Join(help, " | "))))
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
+
+// loadFinderItems lists every file and symbol of repo, or of every RST in
+// store when allRepos is set.
+func loadFinderItems(store rstStore, repo string, allRepos bool) tea.Cmd {
+	return func() tea.Msg {
+		var rstFiles []string
+		if allRepos {
+			var err error
+			rstFiles, err = store.list()
+			if err != nil {
+				return errMsg{err}
+			}
+		} else if repo != "" {
+			rstFiles = append(rstFiles, repoToRSTFile(repo))
+		}
+
+		var items []list.Item
+		for _, rstFile := range rstFiles {
+			r, err := store.read(rstFile)
+			if err != nil {
+				return errMsg{err}
+			}
+			repoName := rstFileToRepoName(rstFile)
+			var paths []string
+			for path := range r.Documents {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				items = append(items, finderItem{repo: repoName, path: path})
+			}
+			for _, path := range paths {
+				var symbols []finderItem
+				for symKey, sym := range r.Documents[path].Symbols {
+					symbols = append(symbols, finderItem{
+						repo:   repoName,
+						path:   path,
+						symbol: symKey,
+						name:   extractSymbolName(symKey),
+						line:   int(sym.Line),
+					})
+				}
+				sort.Slice(symbols, func(i, j int) bool { return symbols[i].line < symbols[j].line })
+				for _, sym := range symbols {
+					items = append(items, sym)
+				}
+			}
+		}
+		return finderItemsMsg{items: items}
+	}
+}
+
+func indexOfItem(items []list.Item, match func(list.Item) bool) int {
+	for i, it := range items {
+		if match(it) {
+			return i
+		}
+	}
+	return -1
+}
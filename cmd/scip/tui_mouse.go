@@ -0,0 +1,215 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/list"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// listHeaderHeight is the number of rows above the first item of a
+	// list: title, blank line, status bar and blank line.
+	listHeaderHeight = 4
+	// columnChrome is the width of the border and padding of columnStyle.
+	columnChrome = 4
+	// mouseWheelLines is how far the code view scrolls per wheel step.
+	mouseWheelLines = 3
+)
+
+// Rows taken by one item of the single-line and default list delegates,
+// including spacing.
+const (
+	singleItemStride  = 1
+	defaultItemStride = 3
+)
+
+// listIndexAt returns the index of the item of l rendered at row, counted
+// from the top of the list.
+func listIndexAt(l list.Model, row, stride int) (int, bool) {
+	row -= listHeaderHeight
+	if row < 0 {
+		return 0, false
+	}
+	idx := l.Paginator.Page*l.Paginator.PerPage + row/stride
+	if idx >= len(l.VisibleItems()) {
+		return 0, false
+	}
+	return idx, true
+}
+
+func wheelDelta(msg tea.MouseMsg) int {
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		return -1
+	case tea.MouseButtonWheelDown:
+		return 1
+	}
+	return 0
+}
+
+func isLeftClick(msg tea.MouseMsg) bool {
+	return msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft
+}
+
+func (m model) updateMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.finderOpen {
+		switch wheelDelta(msg) {
+		case -1:
+			m.finder.CursorUp()
+		case 1:
+			m.finder.CursorDown()
+		}
+		return m, nil
+	}
+	switch m.mode {
+	case modeSymbol:
+		return m.mouseSymbol(msg)
+	case modeCallGraph:
+		return m.mouseCallGraph(msg)
+	case modeDiagnostics:
+		return m.mouseDiagnostics(msg)
+	case modeCompare:
+		return m.mouseCompare(msg)
+	case modeBookmarks, modeHistory:
+		return m.mouseLocations(msg)
+	}
+	return m.mouseThreePane(msg)
+}
+
+// mouseThreePane focuses the pane under the mouse. The wheel moves its
+// selection, a click selects an item and a click on the selected symbol
+// opens it.
+func (m model) mouseThreePane(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	panes := []*list.Model{&m.repos, &m.files, &m.symbols}
+	strides := []int{singleItemStride, singleItemStride, defaultItemStride}
+	pane, left := -1, 0
+	for i, l := range panes {
+		right := left + l.Width() + columnChrome
+		if msg.X >= left && msg.X < right {
+			pane = i
+			break
+		}
+		left = right
+	}
+	// The symbols pane is hidden while the repos pane is focused.
+	if pane < 0 || (pane == 2 && m.active == 0) {
+		return m, nil
+	}
+	l := panes[pane]
+
+	if delta := wheelDelta(msg); delta != 0 {
+		m.active = pane
+		if delta < 0 {
+			l.CursorUp()
+		} else {
+			l.CursorDown()
+		}
+		return m, m.syncSelection()
+	}
+	if !isLeftClick(msg) {
+		return m, nil
+	}
+	m.active = pane
+	// Rows are counted inside the column border.
+	idx, ok := listIndexAt(*l, msg.Y-1, strides[pane])
+	if !ok {
+		return m, nil
+	}
+	if pane == 2 && idx == l.Index() {
+		sym := l.SelectedItem().(symbolItem)
+		repo := m.repos.SelectedItem().(repoItem)
+		return m, loadSymbolDetail(m.store, repo.name, sym.symbol)
+	}
+	l.Select(idx)
+	return m, m.syncSelection()
+}
+
+// mouseSymbol scrolls the code view or the dependency and reference lists
+// under the mouse, and focuses them on click.
+func (m model) mouseSymbol(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	// Below the header: the bordered code view, then the deps and refs lists.
+	codeEnd := 1 + m.viewport.Height + 2
+	depsEnd := codeEnd + m.deps.Height()
+	area := 2
+	switch {
+	case msg.Y < codeEnd:
+		area = 0
+	case msg.Y < depsEnd:
+		area = 1
+	}
+
+	if delta := wheelDelta(msg); delta != 0 {
+		if area == 0 {
+			if delta < 0 {
+				m.viewport.LineUp(mouseWheelLines)
+			} else {
+				m.viewport.LineDown(mouseWheelLines)
+			}
+			return m, nil
+		}
+		m.active = area
+		m.scrollList(delta)
+		return m, nil
+	}
+	if isLeftClick(msg) && msg.Y > 0 {
+		m.active = area
+	}
+	return m, nil
+}
+
+// mouseCallGraph moves the cursor with the wheel. A click selects a row
+// and a click on the selected row opens its symbol.
+func (m model) mouseCallGraph(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	g := m.callGraph
+	if delta := wheelDelta(msg); delta != 0 {
+		g.cursor += delta
+		g.selected()
+		return m, nil
+	}
+	if !isLeftClick(msg) {
+		return m, nil
+	}
+	// Rows start below the header and the top border.
+	row := msg.Y - 2
+	height := m.callGraphHeight()
+	if row < 0 || row >= height {
+		return m, nil
+	}
+	idx := g.offset(height) + row
+	if idx >= len(g.visible()) {
+		return m, nil
+	}
+	if idx == g.cursor {
+		return m, m.jumpToSymbol(g.selected().symbol)
+	}
+	g.cursor = idx
+	return m, nil
+}
+
+// mouseDiagnostics moves the selection with the wheel. A click selects a
+// diagnostic and a click on the selected one jumps to it.
+func (m model) mouseDiagnostics(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	switch wheelDelta(msg) {
+	case -1:
+		m.diagnostics.CursorUp()
+		return m, nil
+	case 1:
+		m.diagnostics.CursorDown()
+		return m, nil
+	}
+	if !isLeftClick(msg) {
+		return m, nil
+	}
+	idx, ok := listIndexAt(m.diagnostics, msg.Y, defaultItemStride)
+	if !ok {
+		return m, nil
+	}
+	if idx == m.diagnostics.Index() {
+		if item, ok := m.diagnostics.SelectedItem().(diagnosticItem); ok {
+			return m, jumpToDiagnostic(m.store, item)
+		}
+		return m, nil
+	}
+	m.diagnostics.Select(idx)
+	return m, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+// rstStore provides the RSTs browsed by the TUI, named like the files
+// written by 'scip parse'.
+type rstStore interface {
+	// list returns the names of all RSTs in the store.
+	list() ([]string, error)
+	// read returns the RST with the given name. Missing RSTs are reported
+	// with an error satisfying os.IsNotExist.
+	read(rstFile string) (*rst.RST, error)
+}
+
+// rstDir is the directory 'scip parse' writes RSTs to, usually ~/.rsts.
+type rstDir string
+
+func (d rstDir) list() ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".rst") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d rstDir) read(rstFile string) (*rst.RST, error) {
+	return readRSTFile(filepath.Join(string(d), rstFile))
+}
+
+// memoryRSTs holds RSTs built in memory by 'scip tui --from'.
+type memoryRSTs map[string]*rst.RST
+
+func (s memoryRSTs) list() ([]string, error) {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s memoryRSTs) read(rstFile string) (*rst.RST, error) {
+	r, ok := s[rstFile]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: rstFile, Err: os.ErrNotExist}
+	}
+	return r, nil
+}
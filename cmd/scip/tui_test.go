@@ -0,0 +1,522 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/hexops/autogold/v2"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sourcegraph/scip/bindings/go/scip"
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	tuiMain    = "scip-go gomod example.com/demo v1 `example.com/demo/cmd`/main()."
+	tuiStart   = "scip-go gomod example.com/demo v1 `example.com/demo/server`/Start()."
+	tuiHandle  = "scip-go gomod example.com/demo v1 `example.com/demo/server`/handle()."
+	tuiLogf    = "scip-go gomod example.com/lib v1 `example.com/lib/log`/Logf()."
+	tuiVersion = "scip-go gomod example.com/lib v1 `example.com/lib/log`/Version."
+)
+
+// tuiFixture returns two small repositories, where demo calls
+// into lib.
+func tuiFixture() memoryRSTs {
+	demo := &rst.RST{
+		Metadata: &rst.Metadata{Repo: "demo", Language: "go"},
+		Documents: map[string]*rst.Document{
+			"cmd/main.go": {
+				RelativePath: "cmd/main.go",
+				Symbols: map[string]*rst.Symbol{
+					tuiMain: {
+						Symbol:       tuiMain,
+						Kind:         "Function",
+						Signature:    "func main()",
+						Line:         5,
+						DependenceOn: []string{tuiStart, tuiLogf},
+						Code:         "func main() {\n\tlog.Logf(\"starting\")\n\tserver.Start()\n}",
+					},
+				},
+			},
+			"server/server.go": {
+				RelativePath: "server/server.go",
+				Symbols: map[string]*rst.Symbol{
+					tuiStart: {
+						Symbol:       tuiStart,
+						Kind:         "Function",
+						Signature:    "func Start()",
+						Line:         3,
+						ReferenceBy:  []string{tuiMain},
+						DependenceOn: []string{tuiHandle},
+						Code:         "func Start() {\n\thandle()\n}",
+					},
+					tuiHandle: {
+						Symbol:      tuiHandle,
+						Kind:        "Function",
+						Signature:   "func handle()",
+						Line:        7,
+						ReferenceBy: []string{tuiStart},
+						Code:        "func handle() {\n\tvar unused int\n}",
+					},
+				},
+				Diagnostics: []*rst.Diagnostic{
+					{Severity: "Error", Code: "UnusedVar", Message: "declared and not used: unused", Source: "compiler", Line: 8, Column: 6, Tags: []string{"Unnecessary"}},
+					{Severity: "Warning", Message: "exported function without comment", Source: "lint", Line: 3, Column: 6},
+				},
+			},
+		},
+	}
+	lib := &rst.RST{
+		Metadata: &rst.Metadata{Repo: "lib", Language: "go"},
+		Documents: map[string]*rst.Document{
+			"log/log.go": {
+				RelativePath: "log/log.go",
+				Symbols: map[string]*rst.Symbol{
+					tuiLogf: {
+						Symbol:      tuiLogf,
+						Kind:        "Function",
+						Signature:   "func Logf(format string, args ...any)",
+						Line:        4,
+						ReferenceBy: []string{tuiMain},
+						Code:        "func Logf(format string, args ...any) {}",
+					},
+					tuiVersion: {
+						Symbol:    tuiVersion,
+						Kind:      "Constant",
+						Signature: "const Version = 2",
+						Line:      2,
+						Code:      "const Version = 2",
+					},
+				},
+			},
+		},
+	}
+	return memoryRSTs{
+		repoToRSTFile("demo"): demo,
+		repoToRSTFile("lib"):  lib,
+	}
+}
+
+// tuiHarness drives the TUI model without a terminal: messages are fed to
+// Update and the commands they return are run synchronously.
+type tuiHarness struct {
+	t     *testing.T
+	model tea.Model
+	quit  bool
+}
+
+// tuiCommandTimeout only guards against commands which never finish. The
+// harness turns off the timers of the TUI, so that every command finishes
+// and views don't depend on wall-clock time.
+const tuiCommandTimeout = 10 * time.Second
+
+func newTUIHarness(t *testing.T, m model, width, height int) *tuiHarness {
+	t.Helper()
+	m.watchEvery = 0
+	m.finder.FilterInput.Cursor.SetMode(cursor.CursorStatic)
+	m.note.Cursor.SetMode(cursor.CursorStatic)
+	h := &tuiHarness{t: t, model: m}
+	h.send(tea.WindowSizeMsg{Width: width, Height: height})
+	h.run(m.Init())
+	return h
+}
+
+// send feeds msgs to the model, followed by the messages of the commands
+// they produce.
+func (h *tuiHarness) send(msgs ...tea.Msg) {
+	h.t.Helper()
+	queue := append([]tea.Msg{}, msgs...)
+	for steps := 0; len(queue) > 0; steps++ {
+		if steps > 1000 {
+			h.t.Fatal("TUI did not settle after 1000 messages")
+		}
+		msg := queue[0]
+		queue = queue[1:]
+		var cmd tea.Cmd
+		h.model, cmd = h.model.Update(msg)
+		queue = append(queue, h.collect(cmd)...)
+	}
+}
+
+func (h *tuiHarness) run(cmd tea.Cmd) {
+	h.t.Helper()
+	h.send(h.collect(cmd)...)
+}
+
+// collect runs cmd and returns the messages it produced.
+func (h *tuiHarness) collect(cmd tea.Cmd) []tea.Msg {
+	h.t.Helper()
+	if cmd == nil {
+		return nil
+	}
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+	var msg tea.Msg
+	select {
+	case msg = <-done:
+	case <-time.After(tuiCommandTimeout):
+		h.t.Fatalf("TUI command did not finish within %s", tuiCommandTimeout)
+	}
+	switch msg := msg.(type) {
+	case nil:
+		return nil
+	case tea.BatchMsg:
+		var msgs []tea.Msg
+		for _, c := range msg {
+			msgs = append(msgs, h.collect(c)...)
+		}
+		return msgs
+	case tea.QuitMsg:
+		h.quit = true
+		return nil
+	}
+	return []tea.Msg{msg}
+}
+
+// press sends one key message per key name, e.g. "j", "enter" or "ctrl+p".
+func (h *tuiHarness) press(keys ...string) {
+	h.t.Helper()
+	for _, k := range keys {
+		h.send(keyMsg(k))
+	}
+}
+
+// typeText sends one key message per rune of s.
+func (h *tuiHarness) typeText(s string) {
+	h.t.Helper()
+	for _, r := range s {
+		h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+}
+
+// view renders the model without colors and trailing spaces.
+func (h *tuiHarness) view() string {
+	lines := strings.Split(ansi.Strip(h.model.View()), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var namedKeys = map[string]tea.KeyType{
+	"enter":     tea.KeyEnter,
+	"esc":       tea.KeyEsc,
+	"tab":       tea.KeyTab,
+	"space":     tea.KeySpace,
+	"backspace": tea.KeyBackspace,
+	"up":        tea.KeyUp,
+	"down":      tea.KeyDown,
+	"left":      tea.KeyLeft,
+	"right":     tea.KeyRight,
+	"home":      tea.KeyHome,
+	"end":       tea.KeyEnd,
+	"ctrl+c":    tea.KeyCtrlC,
+	"ctrl+p":    tea.KeyCtrlP,
+	"ctrl+t":    tea.KeyCtrlT,
+	"ctrl+o":    tea.KeyCtrlO,
+}
+
+func keyMsg(name string) tea.KeyMsg {
+	if t, ok := namedKeys[name]; ok {
+		return tea.KeyMsg{Type: t}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(name)}
+}
+
+func TestTUI(t *testing.T) {
+	testCases := []struct {
+		name  string
+		steps func(h *tuiHarness)
+	}{
+		{"repos", func(h *tuiHarness) {}},
+		{"files", func(h *tuiHarness) {
+			h.press("l")
+		}},
+		{"symbols", func(h *tuiHarness) {
+			h.press("l", "j", "l")
+		}},
+		{"symbol_detail", func(h *tuiHarness) {
+			h.press("l", "l", "enter")
+		}},
+		{"follow_dependency", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "r", "enter")
+		}},
+		{"back_from_dependency", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "r", "enter", "h")
+		}},
+		{"next_occurrence", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "n", "n")
+		}},
+		{"callees", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "c", "j", "space")
+		}},
+		{"callers", func(h *tuiHarness) {
+			h.press("l", "j", "l", "j", "enter", "C", "j", "space")
+		}},
+		{"finder", func(h *tuiHarness) {
+			h.press("ctrl+p")
+			h.typeText("sta")
+		}},
+		{"finder_all_repos", func(h *tuiHarness) {
+			h.press("/", "tab")
+			h.typeText("log")
+		}},
+		{"finder_open", func(h *tuiHarness) {
+			h.press("/")
+			h.typeText("handle")
+			h.press("enter")
+		}},
+		{"diagnostics", func(h *tuiHarness) {
+			h.press("d")
+		}},
+		{"diagnostic_jump", func(h *tuiHarness) {
+			h.press("d", "enter")
+		}},
+		{"bookmark_note", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "b")
+			h.typeText("entry point")
+		}},
+		{"bookmarks", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "b")
+			h.typeText("entry point")
+			h.press("enter", "esc", "h", "j", "l", "j", "b", "enter", "B")
+		}},
+		{"history", func(h *tuiHarness) {
+			h.press("l", "l", "enter", "r", "enter", "j", "enter", "H")
+		}},
+		{"resize", func(h *tuiHarness) {
+			h.press("l")
+			h.send(tea.WindowSizeMsg{Width: 60, Height: 16})
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newModel()
+			m.store = tuiFixture()
+			h := newTUIHarness(t, m, 100, 30)
+			tc.steps(h)
+			autogold.ExpectFile(t, autogold.Raw(h.view()))
+		})
+	}
+}
+
+func TestTUIEnclosingSymbol(t *testing.T) {
+	doc := tuiFixture()[repoToRSTFile("demo")].Documents["server/server.go"]
+	doc.Symbols["scip-go gomod example.com/demo v1 `example.com/demo/server`/handle().(x)"] = &rst.Symbol{
+		Line: 8, Code: "x := 1",
+	}
+	require.Equal(t, tuiStart, enclosingSymbol(doc, 5))
+	// Between Start and handle.
+	require.Equal(t, "", enclosingSymbol(doc, 6))
+	require.Equal(t, tuiHandle, enclosingSymbol(doc, 7))
+	// The innermost symbol wins.
+	require.Equal(t, "scip-go gomod example.com/demo v1 `example.com/demo/server`/handle().(x)", enclosingSymbol(doc, 8))
+	require.Equal(t, "", enclosingSymbol(doc, 10))
+}
+
+func TestTUIFinderKeys(t *testing.T) {
+	m := newModel()
+	m.store = tuiFixture()
+	require.NoError(t, m.applyConfig(tuiConfig{Keys: map[string][]string{
+		"toggle": {"ctrl+t"},
+		"select": {"ctrl+o"},
+		"back":   {"q"},
+	}}))
+	h := newTUIHarness(t, m, 100, 30)
+	h.press("/", "tab")
+	require.False(t, h.model.(model).finderAllRepos)
+	h.press("ctrl+t")
+	require.True(t, h.model.(model).finderAllRepos)
+	require.Contains(t, h.view(), "up/down: move | ctrl+t: toggle all repos | ctrl+o: open │")
+	// q, the only key of back, is typed into the query.
+	h.typeText("q")
+	require.Contains(t, h.view(), "Filter: q")
+	h.press("backspace")
+	h.typeText("logf")
+	h.press("enter")
+	require.True(t, h.model.(model).finderOpen)
+	h.press("ctrl+o")
+	require.False(t, h.model.(model).finderOpen)
+	require.Contains(t, h.view(), "Symbol: Logf")
+}
+
+func TestTUIQuit(t *testing.T) {
+	m := newModel()
+	m.store = tuiFixture()
+	h := newTUIHarness(t, m, 100, 30)
+	h.press("l", "l", "enter", "q")
+	require.False(t, h.quit, "q in the symbol view should go back")
+	h.press("q")
+	require.True(t, h.quit, "q in the three-pane view should quit")
+}
+
+// TestTUIFrom browses indexes which 'scip tui --from' converts to RSTs,
+// which are named after the language of their documents.
+func TestTUIFrom(t *testing.T) {
+	const start = "scip-typescript npm demo 1.0.0 src/`app.ts`/start()."
+	for _, tc := range []struct{ language, repo string }{
+		{"typescript", "demo.typescript"},
+		{"", "demo.unknown"},
+	} {
+		t.Run(tc.repo, func(t *testing.T) {
+			index := &scip.Index{Documents: []*scip.Document{{
+				Language:     tc.language,
+				RelativePath: "src/app.ts",
+				Symbols:      []*scip.SymbolInformation{{Symbol: start, Kind: scip.SymbolInformation_Function}},
+				Occurrences: []*scip.Occurrence{{
+					Range:       []int32{2, 16, 21},
+					Symbol:      start,
+					SymbolRoles: int32(scip.SymbolRole_Definition),
+					Diagnostics: []*scip.Diagnostic{{Severity: scip.Severity_Warning, Message: "unused"}},
+				}},
+			}}}
+			data, err := proto.Marshal(index)
+			require.NoError(t, err)
+			indexPath := filepath.Join(t.TempDir(), "index.scip")
+			require.NoError(t, os.WriteFile(indexPath, data, 0o644))
+			store, err := buildMemoryRSTs(indexPath, "demo", "")
+			require.NoError(t, err)
+
+			m := newModel()
+			m.store = store
+			h := newTUIHarness(t, m, 160, 30)
+			require.Contains(t, h.view(), tc.repo)
+			h.press("l", "l", "enter")
+			view := h.view()
+			require.NotContains(t, view, "Error")
+			require.Contains(t, view, "start")
+			require.Contains(t, view, "src/app.ts")
+
+			h.press("esc", "d")
+			view = h.view()
+			require.NotContains(t, view, "Error")
+			require.Contains(t, view, "unused")
+
+			h.press("esc", "ctrl+p")
+			h.typeText("start")
+			h.press("enter")
+			view = h.view()
+			require.NotContains(t, view, "Error")
+			require.Contains(t, view, "src/app.ts")
+		})
+	}
+}
+
+func TestTUIStatePersisted(t *testing.T) {
+	dir := t.TempDir()
+	for name, r := range tuiFixture() {
+		require.NoError(t, writeRST(filepath.Join(dir, name), r))
+	}
+
+	m := newModel()
+	m.store = rstDir(dir)
+	h := newTUIHarness(t, m, 100, 30)
+	h.press("l", "l", "enter", "r", "enter", "b")
+	h.typeText("serves requests")
+	h.press("enter", "q")
+
+	// A new session of the same RST directory sees the bookmark and history.
+	m = newModel()
+	m.store = rstDir(dir)
+	h = newTUIHarness(t, m, 100, 30)
+	state := h.model.(model).state
+	require.Equal(t, []bookmark{{
+		location: location{Repo: "demo", File: "server/server.go", Symbol: tuiStart, Line: 3},
+		Note:     "serves requests",
+	}}, state.Bookmarks)
+	require.Equal(t, []location{
+		{Repo: "demo", File: "server/server.go", Symbol: tuiStart, Line: 3},
+		{Repo: "demo", File: "cmd/main.go", Symbol: tuiMain, Line: 5},
+	}, state.History)
+
+	h.press("B", "x")
+	h.press("H", "enter")
+	state = h.model.(model).state
+	require.Empty(t, state.Bookmarks)
+	require.Equal(t, tuiStart, state.History[0].Symbol)
+	data, err := os.ReadFile(filepath.Join(dir, tuiStateFile))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "serves requests")
+}
+
+func TestTUICompare(t *testing.T) {
+	fixture := tuiFixture()
+	old := fixture[repoToRSTFile("demo")]
+	new := proto.Clone(old).(*rst.RST)
+	server := new.Documents["server/server.go"]
+	start := server.Symbols[tuiStart]
+	start.Code = "func Start() {\n\tlog.Logf(\"serving\")\n\thandle()\n}"
+	start.DependenceOn = append(start.DependenceOn, tuiLogf)
+	delete(server.Symbols, tuiHandle)
+	delete(new.Documents, "cmd/main.go")
+
+	m := newModel()
+	m.mode = modeCompare
+	h := &tuiHarness{t: t, model: m}
+	h.send(
+		tea.WindowSizeMsg{Width: 120, Height: 30},
+		comparisonMsg{oldName: "old.rst", newName: "new.rst", files: compareRSTs(old, new)},
+	)
+	t.Run("files", func(t *testing.T) {
+		autogold.ExpectFile(t, autogold.Raw(h.view()))
+	})
+	h.press("j", "l")
+	t.Run("changed_symbol", func(t *testing.T) {
+		h.press("l")
+		autogold.ExpectFile(t, autogold.Raw(h.view()))
+	})
+}
+
+func TestTUICompare_Versions(t *testing.T) {
+	old := tuiFixture()[repoToRSTFile("demo")]
+	bump := func(symbol string) string {
+		return strings.Replace(symbol, "example.com/demo v1", "example.com/demo v2", 1)
+	}
+	new := proto.Clone(old).(*rst.RST)
+	for _, doc := range new.Documents {
+		symbols := map[string]*rst.Symbol{}
+		for symbol, sym := range doc.Symbols {
+			sym.Symbol = bump(symbol)
+			for i := range sym.DependenceOn {
+				sym.DependenceOn[i] = bump(sym.DependenceOn[i])
+			}
+			for i := range sym.ReferenceBy {
+				sym.ReferenceBy[i] = bump(sym.ReferenceBy[i])
+			}
+			symbols[sym.Symbol] = sym
+		}
+		doc.Symbols = symbols
+	}
+	new.Documents["server/server.go"].Symbols[bump(tuiStart)].Code = "func Start() {\n\thandle()\n\thandle()\n}"
+
+	require.Equal(t, []string{"example.com/demo v1 → v2"}, comparePackageVersions(old, new))
+	files := compareRSTs(old, new)
+	require.Len(t, files, 1)
+	require.Equal(t, "server/server.go", files[0].path)
+	require.Len(t, files[0].symbols, 1)
+	diff := files[0].symbols[0]
+	require.Equal(t, bump(tuiStart), diff.symbol)
+	require.Equal(t, tuiStart, diff.oldSymbol)
+	require.Equal(t, []string{"version", "code"}, diff.changes)
+	text := ansi.Strip(diff.text())
+	require.Contains(t, text, "Version:\n-v1\n+v2\n")
+	require.NotContains(t, text, "Dependencies:")
+}
+
+func TestTUIStateSaveOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), tuiStateFile)
+	var saver stateSaver
+	require.NoError(t, saver.write(path, []byte("second"), 2))
+	// The commands of earlier saves may finish later.
+	require.NoError(t, saver.write(path, []byte("first"), 1))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	rst "github.com/sourcegraph/scip/cmd/scip/rst"
+)
+
+// rstWatchInterval is how often the RST directory is polled for changes by
+// default.
+// Polling keeps working across the tmp + rename that 'scip parse' does.
+const rstWatchInterval = time.Second
+
+type rstWatchMsg struct {
+	// modTimes maps RST file names to their modification time. It is nil
+	// when the directory could not be read.
+	modTimes map[string]time.Time
+}
+
+type symbolsRefreshedMsg struct {
+	current *symbolDetail
+	stack   []symbolJump
+}
+
+// watchRSTs polls the RST directory for changes every interval. RSTs built
+// in memory never change, so they are not watched.
+func watchRSTs(store rstStore, interval time.Duration) tea.Cmd {
+	dir, ok := store.(rstDir)
+	if !ok || interval == 0 {
+		return nil
+	}
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		return rstWatchMsg{modTimes: scanRSTModTimes(string(dir))}
+	})
+}
+
+func scanRSTModTimes(rstPath string) map[string]time.Time {
+	entries, err := os.ReadDir(rstPath)
+	if err != nil {
+		return nil
+	}
+	modTimes := map[string]time.Time{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".rst") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		modTimes[e.Name()] = info.ModTime()
+	}
+	return modTimes
+}
+
+// handleRSTChanges reloads the repos whose RST changed since the last scan,
+// keeping the current selection and navigation stack.
+func (m model) handleRSTChanges(msg rstWatchMsg) (tea.Model, tea.Cmd) {
+	next := watchRSTs(m.store, m.watchEvery)
+	if msg.modTimes == nil {
+		return m, next
+	}
+	if m.rstModTimes == nil {
+		m.rstModTimes = msg.modTimes
+		return m, next
+	}
+
+	changed := map[string]bool{}
+	reposChanged := false
+	for name, modTime := range msg.modTimes {
+		prev, ok := m.rstModTimes[name]
+		if !ok {
+			reposChanged = true
+		}
+		if !ok || !prev.Equal(modTime) {
+			changed[rstFileToRepoName(name)] = true
+		}
+	}
+	for name := range m.rstModTimes {
+		if _, ok := msg.modTimes[name]; !ok {
+			reposChanged = true
+			changed[rstFileToRepoName(name)] = true
+		}
+	}
+	m.rstModTimes = msg.modTimes
+	if len(changed) == 0 {
+		return m, next
+	}
+
+	cmds := []tea.Cmd{next}
+	selectedRepo, _ := m.repos.SelectedItem().(repoItem)
+	if reposChanged || changed[selectedRepo.name] {
+		if file, ok := m.files.SelectedItem().(fileItem); ok {
+			m.pendingFile = file.name
+		}
+		if sym, ok := m.symbols.SelectedItem().(symbolItem); ok {
+			m.pendingSym = sym.symbol
+		}
+		if reposChanged {
+			cmds = append(cmds, loadRepos(m.store))
+		} else {
+			cmds = append(cmds, loadFiles(m.store, selectedRepo.name))
+		}
+	}
+	if m.symbol != nil {
+		cmds = append(cmds, refreshSymbols(m.store, m.symbol.jump(), m.symbolStack, changed))
+	}
+
+	var repos []string
+	for repo := range changed {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	m.refreshed = fmt.Sprintf("Reloaded %s at %s", strings.Join(repos, ", "), time.Now().Format("15:04:05"))
+	return m, tea.Batch(cmds...)
+}
+
+// applySymbolsRefresh swaps in the reloaded symbol and navigation stack,
+// unless the user navigated elsewhere while they were being loaded.
+func (m model) applySymbolsRefresh(msg symbolsRefreshedMsg) (tea.Model, tea.Cmd) {
+	if m.symbol == nil || msg.current == nil || m.symbol.symbol != msg.current.symbol ||
+		len(m.symbolStack) != len(msg.stack) {
+		return m, nil
+	}
+	yOffset, codeOcc := m.viewport.YOffset, m.codeOcc
+	m.showSymbol(*msg.current)
+	if codeOcc < len(m.code.occs) {
+		m.codeOcc = codeOcc
+		m.viewport.SetContent(m.code.render(m.codeOcc))
+	}
+	m.viewport.SetYOffset(yOffset)
+	m.symbolStack = msg.stack
+	return m, nil
+}
+
+// refreshSymbols re-resolves the current symbol and every entry of the
+// navigation stack that belongs to one of the changed repos. Entries whose
+// symbol no longer exists keep their previous contents.
+func refreshSymbols(store rstStore, current symbolJump, stack []symbolJump, changed map[string]bool) tea.Cmd {
+	return func() tea.Msg {
+		rsts := map[string]*rst.RST{}
+		refresh := func(j symbolJump) symbolJump {
+			if !changed[j.repo] || j.symbol == "" {
+				return j
+			}
+			r, ok := rsts[j.repo]
+			if !ok {
+				r, _ = store.read(repoToRSTFile(j.repo))
+				rsts[j.repo] = r
+			}
+			if r == nil {
+				return j
+			}
+			detail, ok := findSymbolDetail(r, j.symbol)
+			if !ok {
+				return j
+			}
+			detail.repo = j.repo
+			return detail.jump()
+		}
+
+		refreshed := refresh(current).detail()
+		newStack := make([]symbolJump, len(stack))
+		for i, j := range stack {
+			newStack[i] = refresh(j)
+		}
+		return symbolsRefreshedMsg{current: &refreshed, stack: newStack}
+	}
+}